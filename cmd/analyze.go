@@ -2,10 +2,12 @@ package cmd
 
 import (
 	"fmt"
-	"os/exec"
+	"io"
+	"maps"
+	"os"
 	"path/filepath"
 	"regexp"
-	"strconv"
+	"slices"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -16,16 +18,79 @@ type FileChange struct {
 	LinesAdded   int
 	LinesDeleted int
 	Complexity   int
+	Status       string // git status letter: A, M, D, R, C or T
+	OldPath      string // path before a rename or copy
+	Binary       bool   // binary files have no line counts
+	SizeDelta    int64  // change in bytes of a binary file
+	Hunks        []Hunk // loaded for the hunk strategy; see Partial
+
+	blobs       [2]string // old and new blob; a null or missing new blob is in the working tree
+	hunkCount   int       // hunks in the file's whole diff
+	patchHeader string    // diff --git, ---, +++ lines for hunkPatch
 }
 
+// File statuses, as reported by git diff --name-status.
+const (
+	statusAdded    = "A"
+	statusModified = "M"
+	statusDeleted  = "D"
+	statusRenamed  = "R"
+	statusCopied   = "C"
+)
+
 func (f *FileChange) TotalLines() int {
 	return f.LinesAdded + f.LinesDeleted
 }
 
+// Summary describes the change for file lists in PR bodies, e.g.
+// "(+10/-2 lines)" or "(binary, +1.5 KB)".
+func (f *FileChange) Summary() string {
+	switch {
+	case f.Binary && f.Status == statusDeleted:
+		return "(binary, deleted)"
+	case f.Binary:
+		return fmt.Sprintf("(binary, %s)", formatSizeDelta(f.SizeDelta))
+	case f.Status == statusDeleted:
+		return fmt.Sprintf("(deleted, -%d lines)", f.LinesDeleted)
+	case f.Status == statusRenamed:
+		return fmt.Sprintf("(renamed, +%d/-%d lines)", f.LinesAdded, f.LinesDeleted)
+	case f.Partial():
+		return fmt.Sprintf("(%d of %d hunks, +%d/-%d lines)", len(f.Hunks), f.hunkCount, f.LinesAdded, f.LinesDeleted)
+	default:
+		return fmt.Sprintf("(+%d/-%d lines)", f.LinesAdded, f.LinesDeleted)
+	}
+}
+
+// formatSizeDelta formats a signed byte count, e.g. "+1.5 KB" or "-200 B".
+func formatSizeDelta(n int64) string {
+	sign := "+"
+	if n < 0 {
+		sign, n = "-", -n
+	}
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%s%.1f MB", sign, float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%s%.1f KB", sign, float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%s%d B", sign, n)
+	}
+}
+
+// Paths returns the paths a commit of this change touches: a rename also
+// removes its old path.
+func (f *FileChange) Paths() []string {
+	if f.Status == statusRenamed && f.OldPath != "" {
+		return []string{f.OldPath, f.Path}
+	}
+	return []string{f.Path}
+}
+
 type FileGroup struct {
-	Name  string
-	Files []FileChange
-	Order int
+	Name      string
+	Files     []FileChange
+	Order     int
+	DependsOn []GroupDependency // see linkDependencies
 }
 
 func (g *FileGroup) TotalLines() int {
@@ -36,11 +101,16 @@ func (g *FileGroup) TotalLines() int {
 	return total
 }
 
-func (g *FileGroup) RiskLevel() string {
+func (g *FileGroup) Complexity() int {
 	complexity := 0
 	for _, f := range g.Files {
 		complexity += f.Complexity
 	}
+	return complexity
+}
+
+func (g *FileGroup) RiskLevel() string {
+	complexity := g.Complexity()
 	switch {
 	case complexity < 50:
 		return "低" // low
@@ -52,12 +122,28 @@ func (g *FileGroup) RiskLevel() string {
 }
 
 var (
+	analyzeBase      string
 	analyzeBranch    string
 	analyzePR        int
 	analyzeThreshold int
 	analyzeStrategy  string
+	analyzeParts     int
+	analyzeModeFlags diffModeFlags
+	analyzeOutput    string
 )
 
+// analysisReport is the output of prki analyze.
+type analysisReport struct {
+	reportHeader `yaml:",inline"`
+	TotalFiles   int              `json:"totalFiles" yaml:"totalFiles"`
+	TotalLines   int              `json:"totalLines" yaml:"totalLines"`
+	Threshold    int              `json:"threshold" yaml:"threshold"`
+	NeedsSplit   bool             `json:"needsSplit" yaml:"needsSplit"`
+	Files        []fileChangeView `json:"files" yaml:"files"`
+	Groups       []fileGroupView  `json:"groups" yaml:"groups"`
+	Warnings     []string         `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+}
+
 var analyzeCmd = &cobra.Command{
 	Use:   "analyze",
 	Short: "Analyze changes and propose a split plan",
@@ -66,100 +152,124 @@ var analyzeCmd = &cobra.Command{
 Examples:
   prki analyze
   prki analyze --branch feature/payment
+  prki analyze --base develop
+  prki analyze --pr 123
+  prki analyze --unstaged
+  prki analyze --staged
+  prki analyze --worktree
   prki analyze --threshold 300
-  prki analyze --strategy directory`,
+  prki analyze --strategy directory
+  prki analyze --parts 3
+  prki analyze --output json`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		files, err := getChangedFiles(analyzeBranch)
-		if err != nil {
-			return fmt.Errorf("failed to get changed files: %w", err)
+		if err := validateOutput(analyzeOutput); err != nil {
+			return err
 		}
 
-		if len(files) == 0 {
-			fmt.Println("No changed files found.")
-			return nil
+		var files []FileChange
+		var err error
+		if analyzePR > 0 {
+			files, err = getPRChangedFiles(analyzePR, analyzeStrategy == "hunk")
+		} else {
+			files, err = getChangedFiles(diffOptions{Base: analyzeBase, Branch: analyzeBranch, Mode: analyzeModeFlags.mode(), Hunks: analyzeStrategy == "hunk"})
 		}
-
-		calculateComplexity(files)
-		groups := groupFiles(files, analyzeStrategy)
-
-		totalLines := 0
-		for _, f := range files {
-			totalLines += f.TotalLines()
+		if err != nil {
+			return fmt.Errorf("failed to get changed files: %w", err)
 		}
 
-		fmt.Print("\n🌳 Analyzing PR tree...\n\n")
-		fmt.Printf("Current changes: %d files, %d lines\n\n", len(files), totalLines)
-
-		if totalLines < analyzeThreshold {
-			fmt.Printf("✓ Change size looks fine (%d lines < threshold %d)\n", totalLines, analyzeThreshold)
-			return nil
+		measureComplexity(files)
+		read := changeReader(analyzeModeFlags.mode(), analyzeBranch)
+		if analyzePR > 0 {
+			read = changeReader(modeBranch, fmt.Sprintf("refs/prki/pr/%d/head", analyzePR))
 		}
-
-		riskLabel := map[string]string{"低": "low", "中": "medium", "高": "high"}
-		fmt.Println("Split proposal:")
-		for _, g := range groups {
-			risk := g.RiskLevel()
-			riskEmoji := map[string]string{"低": "✓", "中": "⚠️", "高": "🔴"}[risk]
-			fmt.Printf("  ├─ %s %s\n", g.Name, riskEmoji)
-			fmt.Printf("  │   - %d files, %d lines\n", len(g.Files), g.TotalLines())
-			fmt.Printf("  │   - complexity: %s\n", riskLabel[risk])
-			for i, f := range g.Files {
-				if i >= 3 {
-					fmt.Printf("  │     ... and %d more\n", len(g.Files)-3)
-					break
-				}
-				fmt.Printf("  │     • %s\n", f.Path)
-			}
-			fmt.Println("  │")
+		groups, err := groupChanges(files, analyzeStrategy, analyzeParts, read)
+		if err != nil {
+			return err
 		}
-
-		fmt.Printf("\nRecommendation: split into %d child PR(s)\n", len(groups))
-		return nil
+		report := newAnalysisReport(files, groups, analyzeThreshold)
+		return writeReport(os.Stdout, analyzeOutput, report, func(w io.Writer) error {
+			writeAnalysisText(w, report)
+			return nil
+		})
 	},
 }
 
-func getChangedFiles(branch string) ([]FileChange, error) {
-	var diffCmd string
-	if branch != "" {
-		diffCmd = fmt.Sprintf("git diff main..%s --numstat", branch)
-	} else {
-		diffCmd = "git diff main..HEAD --numstat"
+func newAnalysisReport(files []FileChange, groups []FileGroup, threshold int) analysisReport {
+	totalLines := 0
+	for _, f := range files {
+		totalLines += f.TotalLines()
 	}
+	return analysisReport{
+		reportHeader: newReportHeader("analysis"),
+		TotalFiles:   len(files),
+		TotalLines:   totalLines,
+		Threshold:    threshold,
+		NeedsSplit:   len(files) > 0 && overLimit(totalLines, threshold),
+		Files:        newFileChangeViews(files),
+		Groups:       newFileGroupViews(groups),
+		Warnings:     dependencyWarnings(groups),
+	}
+}
 
-	parts := strings.Fields(diffCmd)
-	out, err := exec.Command(parts[0], parts[1:]...).Output()
-	if err != nil {
-		// stagingされた変更も試みる
-		out, err = exec.Command("git", "diff", "--cached", "--numstat").Output()
-		if err != nil {
-			return nil, err
-		}
+func writeAnalysisText(w io.Writer, r analysisReport) {
+	if r.TotalFiles == 0 {
+		fmt.Fprintln(w, "No changed files found.")
+		return
 	}
 
-	var files []FileChange
-	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
-		if line == "" {
-			continue
-		}
-		parts := strings.Fields(line)
-		if len(parts) < 3 {
-			continue
-		}
-		if parts[0] == "-" || parts[1] == "-" {
-			continue // バイナリファイルはスキップ
+	fmt.Fprint(w, "\n🌳 Analyzing PR tree...\n\n")
+	fmt.Fprintf(w, "Current changes: %d files, %d lines\n\n", r.TotalFiles, r.TotalLines)
+
+	if !r.NeedsSplit {
+		fmt.Fprintf(w, "✓ Change size looks fine (%d lines <= threshold %d)\n", r.TotalLines, r.Threshold)
+		return
+	}
+
+	fmt.Fprintln(w, "Split proposal:")
+	for _, g := range r.Groups {
+		riskEmoji := map[string]string{"low": "✓", "medium": "⚠️", "high": "🔴"}[g.RiskLevel]
+		fmt.Fprintf(w, "  ├─ %s %s\n", g.Name, riskEmoji)
+		fmt.Fprintf(w, "  │   - %d files, %d lines\n", len(g.Files), g.Lines)
+		fmt.Fprintf(w, "  │   - complexity: %s\n", g.RiskLevel)
+		if len(g.DependsOn) > 0 {
+			var names []string
+			for _, d := range g.DependsOn {
+				names = append(names, d.Group)
+			}
+			fmt.Fprintf(w, "  │   - depends on: %s\n", strings.Join(names, ", "))
 		}
-		added, err1 := strconv.Atoi(parts[0])
-		deleted, err2 := strconv.Atoi(parts[1])
-		if err1 != nil || err2 != nil {
-			continue
+		for i, f := range g.Files {
+			if i >= 3 {
+				fmt.Fprintf(w, "  │     ... and %d more\n", len(g.Files)-3)
+				break
+			}
+			if len(f.Hunks) > 0 {
+				fmt.Fprintf(w, "  │     • %s (hunks %s)\n", f.Path, joinInts(f.Hunks))
+			} else {
+				fmt.Fprintf(w, "  │     • %s\n", f.Path)
+			}
 		}
-		files = append(files, FileChange{
-			Path:         parts[2],
-			LinesAdded:   added,
-			LinesDeleted: deleted,
-		})
+		fmt.Fprintln(w, "  │")
+	}
+
+	var order []string
+	for _, g := range r.Groups {
+		order = append(order, g.Name)
+	}
+	writeDependencyNotes(w, order, r.Warnings)
+	fmt.Fprintf(w, "\nRecommendation: split into %d child PR(s)\n", len(r.Groups))
+}
+
+// writeDependencyNotes shows the review and merge order and the dependency
+// warnings, if there are any.
+func writeDependencyNotes(w io.Writer, order, warnings []string) {
+	if len(warnings) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nReview and merge in this order: %s\n", strings.Join(order, " → "))
+	for _, warning := range warnings {
+		fmt.Fprintf(w, "  ⚠ %s\n", warning)
 	}
-	return files, nil
 }
 
 func calculateComplexity(files []FileChange) {
@@ -185,9 +295,20 @@ func groupFiles(files []FileChange, strategy string) []FileGroup {
 		return groupByDirectory(files)
 	case "filetype":
 		return groupByFileType(files)
+	case "hunk":
+		return groupByHunk(files)
 	default:
-		return groupBySemantic(files)
+		return groupByConfig(files)
+	}
+}
+
+// groupByConfig groups files by the configured grouping rules, or by the
+// built-in semantic buckets when there are none.
+func groupByConfig(files []FileChange) []FileGroup {
+	if rules := activeConfig.groupingRules(); len(rules) > 0 {
+		return groupByRules(files, rules)
 	}
+	return groupBySemantic(files)
 }
 
 func groupBySemantic(files []FileChange) []FileGroup {
@@ -197,6 +318,7 @@ func groupBySemantic(files []FileChange) []FileGroup {
 		"UI & Components":         {},
 		"Tests":                   {},
 		"Documentation":           {},
+		"Assets":                  {},
 	}
 	order := map[string]int{
 		"Infrastructure & Config": 1,
@@ -204,11 +326,14 @@ func groupBySemantic(files []FileChange) []FileGroup {
 		"UI & Components":         3,
 		"Tests":                   4,
 		"Documentation":           5,
+		"Assets":                  6,
 	}
 
 	for _, f := range files {
 		p := strings.ToLower(f.Path)
 		switch {
+		case f.Binary:
+			buckets["Assets"] = append(buckets["Assets"], f)
 		case isTestFile(p):
 			buckets["Tests"] = append(buckets["Tests"], f)
 		case isConfigFile(p):
@@ -223,7 +348,7 @@ func groupBySemantic(files []FileChange) []FileGroup {
 	}
 
 	var groups []FileGroup
-	names := []string{"Infrastructure & Config", "Core Business Logic", "UI & Components", "Tests", "Documentation"}
+	names := []string{"Infrastructure & Config", "Core Business Logic", "UI & Components", "Tests", "Documentation", "Assets"}
 	for _, name := range names {
 		if len(buckets[name]) > 0 {
 			groups = append(groups, FileGroup{Name: name, Files: buckets[name], Order: order[name]})
@@ -239,10 +364,8 @@ func groupByDirectory(files []FileChange) []FileGroup {
 		buckets[dir] = append(buckets[dir], f)
 	}
 	var groups []FileGroup
-	i := 1
-	for dir, fs := range buckets {
-		groups = append(groups, FileGroup{Name: dir, Files: fs, Order: i})
-		i++
+	for i, dir := range slices.Sorted(maps.Keys(buckets)) {
+		groups = append(groups, FileGroup{Name: dir, Files: buckets[dir], Order: i + 1})
 	}
 	return groups
 }
@@ -257,10 +380,8 @@ func groupByFileType(files []FileChange) []FileGroup {
 		buckets[ext] = append(buckets[ext], f)
 	}
 	var groups []FileGroup
-	i := 1
-	for ext, fs := range buckets {
-		groups = append(groups, FileGroup{Name: ext, Files: fs, Order: i})
-		i++
+	for i, ext := range slices.Sorted(maps.Keys(buckets)) {
+		groups = append(groups, FileGroup{Name: ext, Files: buckets[ext], Order: i + 1})
 	}
 	return groups
 }
@@ -312,10 +433,19 @@ func isDocFile(p string) bool    { return matchAny(p, docPatterns) }
 func isUIFile(p string) bool     { return matchAny(p, uiPatterns) }
 
 func init() {
-	analyzeCmd.Flags().StringVar(&analyzeBranch, "branch", "", "Branch to analyze (default: current branch vs main)")
+	analyzeCmd.Flags().StringVar(&analyzeBase, "base", "", "Base branch to compare against (default: origin's default branch)")
+	analyzeCmd.Flags().StringVar(&analyzeBranch, "branch", "", "Branch to analyze (default: current branch)")
 	analyzeCmd.Flags().IntVar(&analyzePR, "pr", 0, "GitHub PR number to analyze")
 	analyzeCmd.Flags().IntVar(&analyzeThreshold, "threshold", 500, "Line count threshold to suggest splitting")
-	analyzeCmd.Flags().StringVar(&analyzeStrategy, "strategy", "semantic", "Grouping strategy (semantic|directory|filetype)")
+	analyzeCmd.Flags().StringVar(&analyzeStrategy, "strategy", "semantic", "Grouping strategy (semantic|directory|filetype|hunk|imports)")
+	analyzeCmd.Flags().IntVar(&analyzeParts, "parts", 0, "Merge or split the groups into exactly this many balanced child PRs (0: as the strategy groups them)")
+	analyzeModeFlags.register(analyzeCmd)
+	addOutputFlag(analyzeCmd, &analyzeOutput)
+	analyzeCmd.MarkFlagsMutuallyExclusive("branch", "pr")
+	analyzeCmd.MarkFlagsMutuallyExclusive("branch", "staged", "unstaged", "worktree")
+	analyzeCmd.MarkFlagsMutuallyExclusive("pr", "staged", "unstaged", "worktree")
+	analyzeCmd.MarkFlagsMutuallyExclusive("base", "pr")
+	analyzeCmd.MarkFlagsMutuallyExclusive("base", "staged", "unstaged", "worktree")
 
 	rootCmd.AddCommand(analyzeCmd)
 }
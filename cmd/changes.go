@@ -0,0 +1,360 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// diffMode selects which changes getChangedFiles reports.
+type diffMode int
+
+const (
+	modeBranch   diffMode = iota // commits on the branch since its merge-base with the base branch
+	modeStaged                   // index vs HEAD
+	modeUnstaged                 // working tree vs index, plus untracked files
+	modeWorktree                 // working tree vs HEAD, plus untracked files
+)
+
+// uncommitted reports whether the mode looks at changes that are not committed yet.
+func (m diffMode) uncommitted() bool {
+	return m != modeBranch
+}
+
+func (m diffMode) String() string {
+	switch m {
+	case modeStaged:
+		return "staged"
+	case modeUnstaged:
+		return "unstaged"
+	case modeWorktree:
+		return "worktree"
+	default:
+		return "branch"
+	}
+}
+
+// diffOptions describes which changes to analyze.
+type diffOptions struct {
+	Base   string // base branch; detected from the remote when empty
+	Branch string
+	Mode   diffMode
+	Hunks  bool // load the hunks of modified files, for the hunk strategy
+}
+
+// diffModeFlags holds the --staged/--unstaged/--worktree flags shared by commands.
+type diffModeFlags struct {
+	staged   bool
+	unstaged bool
+	worktree bool
+}
+
+func (f *diffModeFlags) register(c *cobra.Command) {
+	c.Flags().BoolVar(&f.staged, "staged", false, "Analyze staged changes (index vs HEAD)")
+	c.Flags().BoolVar(&f.unstaged, "unstaged", false, "Analyze unstaged changes and untracked files (working tree vs index)")
+	c.Flags().BoolVar(&f.worktree, "worktree", false, "Analyze all uncommitted changes and untracked files (working tree vs HEAD)")
+	c.MarkFlagsMutuallyExclusive("staged", "unstaged", "worktree")
+}
+
+func (f *diffModeFlags) mode() diffMode {
+	switch {
+	case f.staged:
+		return modeStaged
+	case f.unstaged:
+		return modeUnstaged
+	case f.worktree:
+		return modeWorktree
+	default:
+		return modeBranch
+	}
+}
+
+func getChangedFiles(opts diffOptions) ([]FileChange, error) {
+	var revs []string
+	switch opts.Mode {
+	case modeStaged:
+		revs = []string{"--cached"}
+	case modeUnstaged:
+		// no revision: working tree vs index
+	case modeWorktree:
+		revs = []string{"HEAD"}
+	default:
+		head := opts.Branch
+		if head == "" {
+			head = "HEAD"
+		}
+		base, err := resolveBase(opts.Base)
+		if err != nil {
+			return nil, err
+		}
+		mb, err := mergeBase(base, head)
+		if err != nil {
+			return nil, fmt.Errorf("%w (use --staged, --unstaged or --worktree for uncommitted changes)", err)
+		}
+		revs = []string{mb, head}
+	}
+
+	files, err := activeGit.Diff(revs...)
+	if err != nil {
+		return nil, err
+	}
+	if err := measureBinaries(files); err != nil {
+		return nil, err
+	}
+	if opts.Hunks {
+		// child branches start from HEAD for all uncommitted modes, so the
+		// hunks of unstaged changes are taken against HEAD as well
+		if opts.Mode == modeUnstaged {
+			revs = []string{"HEAD"}
+		}
+		if err := loadHunks(files, append([]string{"diff"}, revs...)); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Mode == modeUnstaged || opts.Mode == modeWorktree {
+		untracked, err := getUntrackedFiles()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, untracked...)
+	}
+	return files, nil
+}
+
+// baseCandidates are tried in order when the remote has no default branch set.
+var baseCandidates = []string{"origin/main", "origin/master", "main", "master"}
+
+// resolveBase returns the branch that changes are compared against: base
+// itself when given, otherwise the remote's default branch (origin/HEAD),
+// falling back to the first existing candidate in baseCandidates.
+func resolveBase(base string) (string, error) {
+	if base != "" {
+		if !refExists(base) {
+			return "", fmt.Errorf("base branch %q not found", base)
+		}
+		return base, nil
+	}
+	if ref, err := gitOutput("symbolic-ref", "--quiet", "--short", "refs/remotes/origin/HEAD"); err == nil && ref != "" {
+		return ref, nil
+	}
+	for _, c := range baseCandidates {
+		if refExists(c) {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("could not detect the base branch (tried origin/HEAD, %s); pass --base", strings.Join(baseCandidates, ", "))
+}
+
+// mergeBase returns the commit head forked from base, so diffs against it
+// only contain head's own changes even after base has moved on.
+func mergeBase(base, head string) (string, error) {
+	mb, err := activeGit.MergeBase(base, head)
+	if err != nil {
+		return "", fmt.Errorf("no merge-base between %s and %s: %w", base, head, err)
+	}
+	return mb, nil
+}
+
+func refExists(ref string) bool {
+	_, err := activeGit.RevParse(ref)
+	return err == nil
+}
+
+// getUntrackedFiles reports untracked, non-ignored files as pure additions.
+func getUntrackedFiles() ([]FileChange, error) {
+	root, err := repoRoot()
+	if err != nil {
+		return nil, err
+	}
+	out, err := gitOutput("-C", root, "ls-files", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return nil, err
+	}
+
+	var files []FileChange
+	for _, path := range splitNul(out) {
+		data, err := os.ReadFile(filepath.Join(root, path))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read untracked file %s: %w", path, err)
+		}
+		if isBinary(data) {
+			files = append(files, FileChange{Path: path, Status: statusAdded, Binary: true, SizeDelta: int64(len(data))})
+			continue
+		}
+		files = append(files, FileChange{Path: path, LinesAdded: countLines(data), Status: statusAdded})
+	}
+	return files, nil
+}
+
+// isBinary guesses like git does: a NUL byte in the first 8000 bytes.
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0
+}
+
+// measureBinaries sets the SizeDelta of binary files from the sizes of their
+// old and new blobs. An all-zero blob is a missing side (an added or deleted
+// file), or for unstaged changes the file in the working tree.
+func measureBinaries(files []FileChange) error {
+	var root string
+	for i := range files {
+		f := &files[i]
+		if !f.Binary {
+			continue
+		}
+		oldSize, err := blobSize(f.blobs[0])
+		if err != nil {
+			return err
+		}
+		newSize, err := blobSize(f.blobs[1])
+		if err != nil {
+			return err
+		}
+		if isNullSHA(f.blobs[1]) && f.Status != statusDeleted {
+			if root == "" {
+				if root, err = repoRoot(); err != nil {
+					return err
+				}
+			}
+			info, err := os.Stat(filepath.Join(root, f.Path))
+			if err != nil {
+				return fmt.Errorf("failed to stat %s: %w", f.Path, err)
+			}
+			newSize = info.Size()
+		}
+		f.SizeDelta = newSize - oldSize
+	}
+	return nil
+}
+
+func blobSize(sha string) (int64, error) {
+	if sha == "" || isNullSHA(sha) {
+		return 0, nil
+	}
+	out, err := gitOutput("cat-file", "-s", sha)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the size of blob %s: %w", shortSHA(sha), err)
+	}
+	return strconv.ParseInt(out, 10, 64)
+}
+
+func isNullSHA(sha string) bool {
+	return strings.Trim(sha, "0") == ""
+}
+
+// countLines counts lines the way git does, including a final line without newline.
+func countLines(data []byte) int {
+	n := bytes.Count(data, []byte("\n"))
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		n++
+	}
+	return n
+}
+
+// getPRChangedFiles fetches the base and head of a PR into
+// refs/prki/pr/<n>/* and returns the changes the PR introduces, without
+// touching the current checkout.
+func getPRChangedFiles(pr int, hunks bool) ([]FileChange, error) {
+	forge := currentForge(nil)
+	info, err := forge.PR(pr)
+	if err != nil {
+		return nil, err
+	}
+
+	baseRef := fmt.Sprintf("refs/prki/pr/%d/base", pr)
+	headRef := fmt.Sprintf("refs/prki/pr/%d/head", pr)
+	if err := gitSilent("fetch", "--quiet", "--no-tags", "origin",
+		fmt.Sprintf("+refs/heads/%s:%s", info.BaseRefName, baseRef),
+		fmt.Sprintf("+%s:%s", forge.HeadRef(pr), headRef),
+	); err != nil {
+		return nil, fmt.Errorf("failed to fetch PR #%d (%s <- %s): %w", pr, info.BaseRefName, info.HeadRefName, err)
+	}
+
+	// three-dot: only what the PR adds on top of its merge-base, like GitHub shows it
+	files, err := activeGit.Diff(baseRef + "..." + headRef)
+	if err != nil {
+		return nil, fmt.Errorf("git diff for PR #%d failed: %w", pr, err)
+	}
+	if err := measureBinaries(files); err != nil {
+		return nil, err
+	}
+	if hunks {
+		if err := loadHunks(files, []string{"diff", baseRef + "..." + headRef}); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// diffStatArgs make git diff report file statuses with rename detection
+// and line counts in one NUL-separated stream, see parseRawNumstat.
+var diffStatArgs = []string{"--raw", "--numstat", "-z", "-M", "--no-abbrev"}
+
+// parseRawNumstat converts `git diff --raw --numstat -z -M` output into
+// FileChanges. The --raw records carry each file's status and, for renames
+// and copies, its old path; the --numstat records that follow carry the line
+// counts. Files keep their blobs for measureBinaries and measureComplexity.
+func parseRawNumstat(out string) []FileChange {
+	type rawEntry struct{ status, oldPath, oldBlob, newBlob string }
+	raw := map[string]rawEntry{}
+	var files []FileChange
+
+	fields := strings.Split(out, "\x00")
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		switch {
+		case field == "":
+			continue
+		case strings.HasPrefix(field, ":"):
+			// :<old mode> <new mode> <old sha> <new sha> <status>\0<path>[\0<new path>]
+			meta := strings.Fields(field)
+			if len(meta) < 5 || i+1 >= len(fields) {
+				continue
+			}
+			e := rawEntry{status: meta[4][:1], oldBlob: meta[2], newBlob: meta[3]}
+			if (e.status == statusRenamed || e.status == statusCopied) && i+2 < len(fields) {
+				e.oldPath = fields[i+1]
+				raw[fields[i+2]] = e
+				i += 2
+			} else {
+				raw[fields[i+1]] = e
+				i++
+			}
+		default:
+			// <added>\t<deleted>\t<path>, or <added>\t<deleted>\t\0<old path>\0<new path> for renames
+			parts := strings.SplitN(field, "\t", 3)
+			if len(parts) < 3 {
+				continue
+			}
+			path := parts[2]
+			if path == "" && i+2 < len(fields) {
+				path = fields[i+2]
+				i += 2
+			}
+			f := FileChange{Path: path, Status: statusModified}
+			e, ok := raw[path]
+			if ok {
+				f.Status, f.OldPath = e.status, e.oldPath
+				f.blobs = [2]string{e.oldBlob, e.newBlob}
+			}
+			if parts[0] == "-" && parts[1] == "-" {
+				f.Binary = true
+				files = append(files, f)
+				continue
+			}
+			added, err1 := strconv.Atoi(parts[0])
+			deleted, err2 := strconv.Atoi(parts[1])
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			f.LinesAdded, f.LinesDeleted = added, deleted
+			files = append(files, f)
+		}
+	}
+	return files
+}
@@ -0,0 +1,309 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestParseRawNumstat(t *testing.T) {
+	out := ":100644 100644 1111111 2222222 M\x00cmd/analyze.go\x00" +
+		":100644 000000 3333333 0000000 D\x00README.md\x00" +
+		":100644 100644 4444444 5555555 M\x00logo.png\x00" +
+		":100644 100644 6666666 7777777 R087\x00old/name.go\x00new/name.go\x00" +
+		"10\t2\tcmd/analyze.go\x00" +
+		"0\t5\tREADME.md\x00" +
+		"-\t-\tlogo.png\x00" +
+		"3\t1\t\x00old/name.go\x00new/name.go\x00"
+	files := parseRawNumstat(out)
+
+	want := []FileChange{
+		{Path: "cmd/analyze.go", LinesAdded: 10, LinesDeleted: 2, Status: statusModified, blobs: [2]string{"1111111", "2222222"}},
+		{Path: "README.md", LinesDeleted: 5, Status: statusDeleted, blobs: [2]string{"3333333", "0000000"}},
+		{Path: "logo.png", Status: statusModified, Binary: true, blobs: [2]string{"4444444", "5555555"}},
+		{Path: "new/name.go", LinesAdded: 3, LinesDeleted: 1, Status: statusRenamed, OldPath: "old/name.go", blobs: [2]string{"6666666", "7777777"}},
+	}
+	if len(files) != len(want) {
+		t.Fatalf("got %d files, want %d: %+v", len(files), len(want), files)
+	}
+	for i := range want {
+		if !reflect.DeepEqual(files[i], want[i]) {
+			t.Errorf("files[%d] = %+v, want %+v", i, files[i], want[i])
+		}
+	}
+}
+
+func TestParseRawNumstat_UnusualPaths(t *testing.T) {
+	out := ":100644 100644 1111111 2222222 M\x00docs/My Design.md\x00" +
+		":100644 100644 3333333 4444444 R100\x00docs/tab\tname.md\x00docs/設計書.md\x00" +
+		"1\t1\tdocs/My Design.md\x00" +
+		"0\t0\t\x00docs/tab\tname.md\x00docs/設計書.md\x00"
+	files := parseRawNumstat(out)
+
+	if len(files) != 2 {
+		t.Fatalf("got %d files, want 2: %+v", len(files), files)
+	}
+	if files[0].Path != "docs/My Design.md" || files[0].TotalLines() != 2 {
+		t.Errorf("files[0] = %+v", files[0])
+	}
+	if files[1].Path != "docs/設計書.md" || files[1].OldPath != "docs/tab\tname.md" || files[1].Status != statusRenamed {
+		t.Errorf("files[1] = %+v", files[1])
+	}
+}
+
+func TestParseRawNumstat_Empty(t *testing.T) {
+	if files := parseRawNumstat(""); len(files) != 0 {
+		t.Errorf("expected no files, got %+v", files)
+	}
+}
+
+func TestFileChange_Paths(t *testing.T) {
+	tests := []struct {
+		f    FileChange
+		want []string
+	}{
+		{FileChange{Path: "a.go", Status: statusModified}, []string{"a.go"}},
+		{FileChange{Path: "a.go", Status: statusDeleted}, []string{"a.go"}},
+		{FileChange{Path: "b.go", Status: statusRenamed, OldPath: "a.go"}, []string{"a.go", "b.go"}},
+		{FileChange{Path: "b.go", Status: statusCopied, OldPath: "a.go"}, []string{"b.go"}},
+	}
+	for _, tt := range tests {
+		if got := tt.f.Paths(); !slices.Equal(got, tt.want) {
+			t.Errorf("%+v.Paths() = %q, want %q", tt.f, got, tt.want)
+		}
+	}
+}
+
+func TestGetChangedFiles_Binary(t *testing.T) {
+	dir := newTestRepo(t)
+	writeFile(t, dir, "logo.png", "\x89PNG\x00\x01\x02\x03")
+	writeFile(t, dir, "old.bin", "\x00gone")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "assets")
+	writeFile(t, dir, "logo.png", "\x89PNG\x00\x01\x02\x03\x04\x05\x06\x07\x08\x09")
+	runGit(t, dir, "rm", "-q", "old.bin")
+	writeFile(t, dir, "font.woff", "wOFF\x00\x00\x00")
+
+	files, err := getChangedFiles(diffOptions{Mode: modeWorktree})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]FileChange{}
+	for _, f := range files {
+		got[f.Path] = f
+	}
+	tests := []struct {
+		path   string
+		status string
+		delta  int64
+	}{
+		{"logo.png", statusModified, 6}, // unstaged: measured in the working tree
+		{"old.bin", statusDeleted, -5},
+		{"font.woff", statusAdded, 7}, // untracked
+	}
+	for _, tt := range tests {
+		f, ok := got[tt.path]
+		if !ok || !f.Binary || f.Status != tt.status || f.SizeDelta != tt.delta {
+			t.Errorf("%s = %+v, want binary %s with delta %d", tt.path, f, tt.status, tt.delta)
+		}
+	}
+
+	runGit(t, dir, "add", ".")
+	staged, err := getChangedFiles(diffOptions{Mode: modeStaged})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range staged {
+		if f.Path == "logo.png" && f.SizeDelta != 6 {
+			t.Errorf("staged logo.png delta = %d, want 6", f.SizeDelta)
+		}
+	}
+}
+
+func TestGetChangedFiles_RenamesAndDeletions(t *testing.T) {
+	dir := newTestRepo(t)
+	writeFile(t, dir, "old.txt", "one\ntwo\nthree\nfour\nfive\n")
+	writeFile(t, dir, "gone.txt", "bye\n")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "more")
+	runGit(t, dir, "mv", "old.txt", "new.txt")
+	runGit(t, dir, "rm", "-q", "gone.txt")
+
+	files, err := getChangedFiles(diffOptions{Mode: modeStaged})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]FileChange{}
+	for _, f := range files {
+		got[f.Path] = f
+	}
+	if f := got["new.txt"]; f.Status != statusRenamed || f.OldPath != "old.txt" || f.TotalLines() != 0 {
+		t.Errorf("new.txt = %+v, want a pure rename from old.txt", f)
+	}
+	if f := got["gone.txt"]; f.Status != statusDeleted || f.LinesDeleted != 1 {
+		t.Errorf("gone.txt = %+v, want a deletion", f)
+	}
+	if len(files) != 2 {
+		t.Errorf("got %d files, want 2: %+v", len(files), files)
+	}
+}
+
+func TestCountLines(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want int
+	}{
+		{"empty", "", 0},
+		{"single line with newline", "a\n", 1},
+		{"single line without newline", "a", 1},
+		{"two lines", "a\nb\n", 2},
+		{"trailing line without newline", "a\nb", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := countLines([]byte(tt.data)); got != tt.want {
+				t.Errorf("countLines(%q) = %d, want %d", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffModeFlags_Mode(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags diffModeFlags
+		want  diffMode
+	}{
+		{"default", diffModeFlags{}, modeBranch},
+		{"staged", diffModeFlags{staged: true}, modeStaged},
+		{"unstaged", diffModeFlags{unstaged: true}, modeUnstaged},
+		{"worktree", diffModeFlags{worktree: true}, modeWorktree},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.flags.mode(); got != tt.want {
+				t.Errorf("mode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetChangedFiles_Modes(t *testing.T) {
+	dir := newTestRepo(t)
+	writeFile(t, dir, "staged.go", "package a\n")
+	writeFile(t, dir, "edited.go", "package a\n\nfunc f() {}\n")
+	writeFile(t, dir, "new.txt", "one\ntwo\nthree")
+	runGit(t, dir, "add", "staged.go")
+
+	paths := func(files []FileChange) map[string]int {
+		m := map[string]int{}
+		for _, f := range files {
+			m[f.Path] = f.TotalLines()
+		}
+		return m
+	}
+
+	tests := []struct {
+		mode diffMode
+		want map[string]int
+	}{
+		{modeStaged, map[string]int{"staged.go": 1}},
+		{modeUnstaged, map[string]int{"edited.go": 2, "new.txt": 3}},
+		{modeWorktree, map[string]int{"staged.go": 1, "edited.go": 2, "new.txt": 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode.String(), func(t *testing.T) {
+			files, err := getChangedFiles(diffOptions{Mode: tt.mode})
+			if err != nil {
+				t.Fatalf("getChangedFiles: %v", err)
+			}
+			got := paths(files)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for p, lines := range tt.want {
+				if got[p] != lines {
+					t.Errorf("%s: got %d lines, want %d (all: %v)", p, got[p], lines, got)
+				}
+			}
+		})
+	}
+}
+
+func TestGetChangedFiles_UntrackedRespectsGitignore(t *testing.T) {
+	dir := newTestRepo(t)
+	writeFile(t, dir, ".gitignore", "*.log\n")
+	runGit(t, dir, "add", ".gitignore")
+	runGit(t, dir, "commit", "-q", "-m", "ignore logs")
+	writeFile(t, dir, "debug.log", "noise\n")
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, dir, "sub/new.go", "package sub\n")
+
+	files, err := getChangedFiles(diffOptions{Mode: modeUnstaged})
+	if err != nil {
+		t.Fatalf("getChangedFiles: %v", err)
+	}
+	if len(files) != 1 || files[0].Path != "sub/new.go" {
+		t.Errorf("got %+v, want only sub/new.go", files)
+	}
+}
+
+func TestResolveBase(t *testing.T) {
+	dir := newTestRepo(t)
+
+	if got, err := resolveBase(""); err != nil || got != "main" {
+		t.Errorf("resolveBase(\"\") = %q, %v; want main", got, err)
+	}
+
+	runGit(t, dir, "branch", "develop")
+	if got, err := resolveBase("develop"); err != nil || got != "develop" {
+		t.Errorf("resolveBase(develop) = %q, %v", got, err)
+	}
+	if _, err := resolveBase("no-such-branch"); err == nil {
+		t.Error("resolveBase(no-such-branch) should fail")
+	}
+
+	// the remote's default branch wins over local candidates
+	runGit(t, dir, "update-ref", "refs/remotes/origin/develop", "HEAD")
+	runGit(t, dir, "symbolic-ref", "refs/remotes/origin/HEAD", "refs/remotes/origin/develop")
+	if got, err := resolveBase(""); err != nil || got != "origin/develop" {
+		t.Errorf("resolveBase(\"\") = %q, %v; want origin/develop", got, err)
+	}
+}
+
+func TestResolveBase_NoCandidate(t *testing.T) {
+	dir := newTestRepo(t)
+	runGit(t, dir, "branch", "-m", "main", "trunk")
+
+	if _, err := resolveBase(""); err == nil {
+		t.Error("resolveBase should fail when no base branch can be detected")
+	}
+}
+
+func TestGetChangedFiles_IgnoresUpstreamCommits(t *testing.T) {
+	dir := newTestRepo(t)
+	runGit(t, dir, "checkout", "-q", "-b", "feature")
+	writeFile(t, dir, "feature.go", "package a\n")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "feature work")
+
+	// main moves on after the branch was cut
+	runGit(t, dir, "checkout", "-q", "main")
+	writeFile(t, dir, "upstream.go", "package a\n")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "upstream work")
+	runGit(t, dir, "checkout", "-q", "feature")
+
+	files, err := getChangedFiles(diffOptions{Base: "main"})
+	if err != nil {
+		t.Fatalf("getChangedFiles: %v", err)
+	}
+	if len(files) != 1 || files[0].Path != "feature.go" {
+		t.Errorf("got %+v, want only feature.go", files)
+	}
+}
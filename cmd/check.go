@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	checkBase          string
+	checkBranch        string
+	checkThreshold     int
+	checkMaxFiles      int
+	checkMaxComplexity int
+	checkOutput        string
+	checkModeFlags     diffModeFlags
+)
+
+// Exit codes of prki check. Each violated limit sets its own bit, so the
+// status tells CI exactly which limits failed (e.g. 6 = lines and files).
+// 1 stays reserved for errors.
+const (
+	exitLinesExceeded      = 1 << 1
+	exitFilesExceeded      = 1 << 2
+	exitComplexityExceeded = 1 << 3
+)
+
+// checkViolation is one exceeded limit.
+type checkViolation struct {
+	Limit string `json:"limit" yaml:"limit"`
+	Value int    `json:"value" yaml:"value"`
+	Max   int    `json:"max" yaml:"max"`
+}
+
+// checkResult is the outcome of prki check.
+type checkResult struct {
+	reportHeader `yaml:",inline"`
+	Passed       bool             `json:"passed" yaml:"passed"`
+	ExitCode     int              `json:"exitCode" yaml:"exitCode"`
+	Files        int              `json:"files" yaml:"files"`
+	Lines        int              `json:"lines" yaml:"lines"`
+	Complexity   int              `json:"complexity" yaml:"complexity"`
+	Limits       checkLimits      `json:"limits" yaml:"limits"`
+	Violations   []checkViolation `json:"violations" yaml:"violations"`
+}
+
+// checkLimits are the configured maxima; 0 disables a limit.
+type checkLimits struct {
+	Files      int `json:"files" yaml:"files"`
+	Lines      int `json:"lines" yaml:"lines"`
+	Complexity int `json:"complexity" yaml:"complexity"`
+}
+
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Fail when the change exceeds size limits (for CI and git hooks)",
+	Long: `Check the current change against limits on changed lines, changed files
+and aggregate complexity, and exit non-zero when any limit is exceeded.
+
+Exit codes (bits are combined when several limits are exceeded):
+  0  all limits respected
+  1  error
+  2  lines exceeded       (--threshold)
+  4  files exceeded       (--max-files)
+  8  complexity exceeded  (--max-complexity)
+
+Limits default to the thresholds block of .prki.yaml; 0 disables a limit.
+
+Examples:
+  prki check
+  prki check --threshold 300
+  prki check --max-files 20 --max-complexity 100
+  prki check --staged               # pre-commit hook
+  prki check --output github        # GitHub Actions annotations
+  prki check --output json
+  prki check --output yaml`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateOutput(checkOutput, "github"); err != nil {
+			return err
+		}
+		files, err := getChangedFiles(diffOptions{Base: checkBase, Branch: checkBranch, Mode: checkModeFlags.mode()})
+		if err != nil {
+			return fmt.Errorf("failed to get changed files: %w", err)
+		}
+		measureComplexity(files)
+
+		res := evaluateCheck(files, checkLimits{Files: checkMaxFiles, Lines: checkThreshold, Complexity: checkMaxComplexity})
+		if err := writeCheckResult(os.Stdout, res, checkOutput); err != nil {
+			return err
+		}
+		if !res.Passed {
+			return &exitError{code: res.ExitCode}
+		}
+		return nil
+	},
+}
+
+// evaluateCheck compares the change against the limits.
+func evaluateCheck(files []FileChange, limits checkLimits) checkResult {
+	res := checkResult{reportHeader: newReportHeader("check"), Files: len(files), Limits: limits, Violations: []checkViolation{}}
+	for _, f := range files {
+		res.Lines += f.TotalLines()
+		res.Complexity += f.Complexity
+	}
+
+	limitChecks := []struct {
+		name  string
+		value int
+		max   int
+		code  int
+	}{
+		{"lines", res.Lines, limits.Lines, exitLinesExceeded},
+		{"files", res.Files, limits.Files, exitFilesExceeded},
+		{"complexity", res.Complexity, limits.Complexity, exitComplexityExceeded},
+	}
+	for _, c := range limitChecks {
+		if c.max > 0 && overLimit(c.value, c.max) {
+			res.Violations = append(res.Violations, checkViolation{Limit: c.name, Value: c.value, Max: c.max})
+			res.ExitCode |= c.code
+		}
+	}
+	res.Passed = res.ExitCode == 0
+	return res
+}
+
+// overLimit reports whether value exceeds limit. analyze and check share it
+// so that a change exactly at the threshold passes both.
+func overLimit(value, limit int) bool {
+	return value > limit
+}
+
+func writeCheckResult(w io.Writer, res checkResult, format string) error {
+	switch format {
+	case "github":
+		// workflow commands: https://docs.github.com/actions/reference/workflow-commands-for-github-actions
+		for _, v := range res.Violations {
+			fmt.Fprintf(w, "::error title=prki check::%s\n", escapeWorkflowCommand(violationMessage(v)))
+		}
+		if res.Passed {
+			fmt.Fprintf(w, "::notice title=prki check::%s\n", escapeWorkflowCommand(passMessage(res)))
+		}
+		return nil
+	default:
+		return writeReport(w, format, res, func(w io.Writer) error {
+			if res.Passed {
+				fmt.Fprintf(w, "✓ %s\n", passMessage(res))
+				return nil
+			}
+			for _, v := range res.Violations {
+				fmt.Fprintf(w, "✗ %s\n", violationMessage(v))
+			}
+			fmt.Fprintln(w, "  Run `prki analyze` to see split proposal.")
+			return nil
+		})
+	}
+}
+
+func passMessage(res checkResult) string {
+	if res.Limits.Lines > 0 {
+		return fmt.Sprintf("Change size is within threshold (%d lines <= %d)", res.Lines, res.Limits.Lines)
+	}
+	return fmt.Sprintf("Change size is within limits (%d files, %d lines)", res.Files, res.Lines)
+}
+
+func violationMessage(v checkViolation) string {
+	if v.Limit == "lines" {
+		return fmt.Sprintf("Change size exceeds threshold (%d lines > %d)", v.Value, v.Max)
+	}
+	return fmt.Sprintf("Change exceeds %s limit (%d %s > %d)", v.Limit, v.Value, v.Limit, v.Max)
+}
+
+// escapeWorkflowCommand escapes a GitHub Actions workflow command message.
+func escapeWorkflowCommand(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func init() {
+	checkCmd.Flags().StringVar(&checkBase, "base", "", "Base branch to compare against (default: origin's default branch)")
+	checkCmd.Flags().StringVar(&checkBranch, "branch", "", "Branch to check (default: current branch)")
+	checkCmd.Flags().IntVar(&checkThreshold, "threshold", 500, "Maximum changed lines (0 disables)")
+	checkCmd.Flags().IntVar(&checkMaxFiles, "max-files", 0, "Maximum changed files (0 disables)")
+	checkCmd.Flags().IntVar(&checkMaxComplexity, "max-complexity", 0, "Maximum aggregate complexity (0 disables)")
+	checkCmd.Flags().StringVarP(&checkOutput, "output", "o", "text", "Output format (text|json|yaml|github)")
+	checkModeFlags.register(checkCmd)
+	checkCmd.MarkFlagsMutuallyExclusive("branch", "staged", "unstaged", "worktree")
+	checkCmd.MarkFlagsMutuallyExclusive("base", "staged", "unstaged", "worktree")
+
+	rootCmd.AddCommand(checkCmd)
+}
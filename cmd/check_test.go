@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestEvaluateCheck(t *testing.T) {
+	files := []FileChange{
+		{Path: "a.go", LinesAdded: 300, Complexity: 40},
+		{Path: "b.go", LinesAdded: 200, LinesDeleted: 100, Complexity: 70},
+	}
+	tests := []struct {
+		name     string
+		limits   checkLimits
+		wantCode int
+		wantLim  []string
+	}{
+		{"all within", checkLimits{Files: 2, Lines: 600, Complexity: 110}, 0, nil},
+		{"limits disabled", checkLimits{}, 0, nil},
+		{"lines exceeded", checkLimits{Lines: 500}, exitLinesExceeded, []string{"lines"}},
+		{"files exceeded", checkLimits{Files: 1}, exitFilesExceeded, []string{"files"}},
+		{"complexity exceeded", checkLimits{Complexity: 100}, exitComplexityExceeded, []string{"complexity"}},
+		{"lines and files", checkLimits{Files: 1, Lines: 500}, exitLinesExceeded | exitFilesExceeded, []string{"lines", "files"}},
+		{"everything", checkLimits{Files: 1, Lines: 1, Complexity: 1}, 14, []string{"lines", "files", "complexity"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := evaluateCheck(files, tt.limits)
+			if res.ExitCode != tt.wantCode {
+				t.Errorf("ExitCode = %d, want %d", res.ExitCode, tt.wantCode)
+			}
+			if res.Passed != (tt.wantCode == 0) {
+				t.Errorf("Passed = %v", res.Passed)
+			}
+			if res.Lines != 600 || res.Files != 2 || res.Complexity != 110 {
+				t.Errorf("totals = %d lines, %d files, %d complexity", res.Lines, res.Files, res.Complexity)
+			}
+			if len(res.Violations) != len(tt.wantLim) {
+				t.Fatalf("violations = %+v, want %v", res.Violations, tt.wantLim)
+			}
+			for i, lim := range tt.wantLim {
+				if res.Violations[i].Limit != lim {
+					t.Errorf("violations[%d] = %q, want %q", i, res.Violations[i].Limit, lim)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckAndAnalyze_AgreeAtThreshold(t *testing.T) {
+	files := []FileChange{{Path: "a.go", LinesAdded: 400, LinesDeleted: 100}}
+	for _, tt := range []struct {
+		threshold int
+		split     bool
+	}{{500, false}, {499, true}, {501, false}} {
+		res := evaluateCheck(files, checkLimits{Lines: tt.threshold})
+		report := newAnalysisReport(files, nil, tt.threshold)
+		if res.Passed == tt.split || report.NeedsSplit != tt.split {
+			t.Errorf("threshold %d with 500 lines: check passed = %v, analyze needs split = %v; want split = %v",
+				tt.threshold, res.Passed, report.NeedsSplit, tt.split)
+		}
+	}
+}
+
+func TestWriteCheckResult_Text(t *testing.T) {
+	var buf bytes.Buffer
+	res := evaluateCheck([]FileChange{{LinesAdded: 1847}}, checkLimits{Lines: 500})
+	if err := writeCheckResult(&buf, res, "text"); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "✗ Change size exceeds threshold (1847 lines > 500)") || !strings.Contains(out, "prki analyze") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+
+	buf.Reset()
+	res = evaluateCheck([]FileChange{{LinesAdded: 320}}, checkLimits{Lines: 500})
+	if err := writeCheckResult(&buf, res, "text"); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "✓ Change size is within threshold (320 lines <= 500)\n" {
+		t.Errorf("unexpected output: %q", got)
+	}
+}
+
+func TestWriteCheckResult_GitHub(t *testing.T) {
+	var buf bytes.Buffer
+	res := evaluateCheck([]FileChange{{LinesAdded: 10}, {LinesAdded: 10}}, checkLimits{Files: 1, Lines: 5})
+	if err := writeCheckResult(&buf, res, "github"); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected one annotation per violation, got:\n%s", buf.String())
+	}
+	for _, l := range lines {
+		if !strings.HasPrefix(l, "::error title=prki check::") {
+			t.Errorf("not an error annotation: %q", l)
+		}
+	}
+}
+
+func TestWriteCheckResult_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	res := evaluateCheck([]FileChange{{LinesAdded: 10}}, checkLimits{Lines: 5})
+	if err := writeCheckResult(&buf, res, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var got checkResult
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.String())
+	}
+	if got.Passed || got.ExitCode != exitLinesExceeded || len(got.Violations) != 1 || got.Violations[0].Max != 5 {
+		t.Errorf("unexpected result: %+v", got)
+	}
+}
+
+func TestEscapeWorkflowCommand(t *testing.T) {
+	if got := escapeWorkflowCommand("100% done\nnext"); got != "100%25 done%0Anext" {
+		t.Errorf("escapeWorkflowCommand() = %q", got)
+	}
+}
@@ -0,0 +1,292 @@
+package cmd
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// complexityFunc scores the changed regions of a file, or reports false
+// when it cannot, e.g. because the source does not parse.
+type complexityFunc func(f FileChange, v fileVersions) (int, bool)
+
+// complexityAnalyzers score files by extension. Files without an analyzer,
+// or that their analyzer gives up on, keep the line-based score of
+// calculateComplexity.
+var complexityAnalyzers = map[string]complexityFunc{
+	".go":       goComplexity,
+	".ts":       jsComplexity,
+	".tsx":      jsComplexity,
+	".mts":      jsComplexity,
+	".cts":      jsComplexity,
+	".js":       jsComplexity,
+	".jsx":      jsComplexity,
+	".mjs":      jsComplexity,
+	".cjs":      jsComplexity,
+	".md":       proseComplexity,
+	".markdown": proseComplexity,
+	".mdx":      proseComplexity,
+	".rst":      proseComplexity,
+	".adoc":     proseComplexity,
+	".txt":      proseComplexity,
+}
+
+// measureComplexity sets the Complexity of every file, using the analyzer
+// for its language when there is one.
+func measureComplexity(files []FileChange) {
+	calculateComplexity(files)
+	var root string
+	for i := range files {
+		f := &files[i]
+		analyze, ok := complexityAnalyzers[filepath.Ext(f.Path)]
+		if !ok || f.Binary {
+			continue
+		}
+		if root == "" {
+			var err error
+			if root, err = repoRoot(); err != nil {
+				return
+			}
+		}
+		if score, ok := analyze(*f, fileVersions{f: *f, root: root}); ok {
+			f.Complexity = score
+		}
+	}
+}
+
+// fileVersions reads the old and new content of a changed file, from its
+// blobs or, for changes that are not in a blob yet, from the working tree.
+type fileVersions struct {
+	f    FileChange
+	root string
+}
+
+// old returns nil for an added file.
+func (v fileVersions) old() ([]byte, error) {
+	if v.f.Status == statusAdded || v.f.blobs[0] == "" || isNullSHA(v.f.blobs[0]) {
+		return nil, nil
+	}
+	return readBlob(v.f.blobs[0])
+}
+
+// new returns nil for a deleted file.
+func (v fileVersions) new() ([]byte, error) {
+	if v.f.Status == statusDeleted {
+		return nil, nil
+	}
+	if v.f.blobs[1] == "" || isNullSHA(v.f.blobs[1]) {
+		return os.ReadFile(filepath.Join(v.root, v.f.Path))
+	}
+	return readBlob(v.f.blobs[1])
+}
+
+func readBlob(sha string) ([]byte, error) {
+	out, err := gitOutput("cat-file", "blob", sha)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob %s: %w", shortSHA(sha), err)
+	}
+	return []byte(out), nil
+}
+
+// proseComplexity scores documentation by its changed lines, at a fifth of
+// the rate of code: a long README rewrite is a quick review.
+func proseComplexity(f FileChange, _ fileVersions) (int, bool) {
+	return f.TotalLines() / 50, true
+}
+
+// goComplexity scores a Go file by the cyclomatic complexity of the
+// functions the change adds or edits. Every other added, edited or removed
+// top-level declaration, removed functions included, scores 1.
+func goComplexity(f FileChange, v fileVersions) (int, bool) {
+	oldSrc, err := v.old()
+	if err != nil {
+		return 0, false
+	}
+	newSrc, err := v.new()
+	if err != nil {
+		return 0, false
+	}
+	oldDecls, ok := goDecls(oldSrc)
+	if !ok {
+		oldDecls = map[string]goDecl{}
+	}
+	newDecls, ok := goDecls(newSrc)
+	if !ok {
+		return 0, false
+	}
+
+	score := 0
+	for key, d := range newDecls {
+		if old, ok := oldDecls[key]; ok && old.text == d.text {
+			continue
+		}
+		score += d.complexity
+	}
+	for key := range oldDecls {
+		if _, ok := newDecls[key]; !ok {
+			score++
+		}
+	}
+	return score, true
+}
+
+// goDecl is a top-level declaration with its source text and its score:
+// the cyclomatic complexity for a function, 1 otherwise.
+type goDecl struct {
+	text       string
+	complexity int
+}
+
+// goDecls parses src into its top-level declarations, keyed by name; a nil
+// src has none. init and _ functions, which a file may declare several
+// times, are keyed by their position among functions of that name, e.g.
+// "func init#2". Declarations other than functions are keyed by their text,
+// so an edit shows up as one removed and one added declaration.
+func goDecls(src []byte) (map[string]goDecl, bool) {
+	decls := map[string]goDecl{}
+	if src == nil {
+		return decls, true
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, false
+	}
+	text := func(n ast.Node) string {
+		return string(src[fset.Position(n.Pos()).Offset:fset.Position(n.End()).Offset])
+	}
+	seen := map[string]int{}
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			key := "func " + funcKey(d)
+			if d.Recv == nil && (d.Name.Name == "init" || d.Name.Name == "_") {
+				seen[key]++
+				key += "#" + strconv.Itoa(seen[key])
+			}
+			decls[key] = goDecl{text: text(d), complexity: cyclomatic(d)}
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			t := text(d)
+			decls[t] = goDecl{text: t, complexity: 1}
+		}
+	}
+	return decls, true
+}
+
+// funcKey names a function or method, e.g. "add" or "(*Calc).add".
+func funcKey(d *ast.FuncDecl) string {
+	if d.Recv == nil || len(d.Recv.List) == 0 {
+		return d.Name.Name
+	}
+	return "(" + recvName(d.Recv.List[0].Type) + ")." + d.Name.Name
+}
+
+func recvName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return "*" + recvName(e.X)
+	case *ast.IndexExpr:
+		return recvName(e.X)
+	case *ast.IndexListExpr:
+		return recvName(e.X)
+	case *ast.Ident:
+		return e.Name
+	}
+	return ""
+}
+
+// jsComplexity scores a JavaScript or TypeScript file by the decision
+// points on the lines the change adds, with at least 1 for any change. It
+// does not parse the source: a line counts as added when the old version
+// does not have it, ignoring indentation, so moved lines are free.
+func jsComplexity(f FileChange, v fileVersions) (int, bool) {
+	oldSrc, err := v.old()
+	if err != nil {
+		return 0, false
+	}
+	newSrc, err := v.new()
+	if err != nil {
+		return 0, false
+	}
+	score := 0
+	for _, line := range addedLines(oldSrc, newSrc) {
+		score += jsDecisionPoints(line)
+	}
+	if score == 0 && f.TotalLines() > 0 {
+		score = 1
+	}
+	return score, true
+}
+
+// addedLines returns the trimmed lines of newSrc that oldSrc does not have,
+// each counted as often as it occurs.
+func addedLines(oldSrc, newSrc []byte) []string {
+	old := map[string]int{}
+	for _, line := range strings.Split(string(oldSrc), "\n") {
+		old[strings.TrimSpace(line)]++
+	}
+	var added []string
+	for _, line := range strings.Split(string(newSrc), "\n") {
+		line = strings.TrimSpace(line)
+		if old[line] > 0 {
+			old[line]--
+			continue
+		}
+		added = append(added, line)
+	}
+	return added
+}
+
+var (
+	jsStringOrComment = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'|` + "`(?:[^`\\\\]|\\\\.)*`" + `|//.*$`)
+	jsDecision        = regexp.MustCompile(`\b(?:if|for|while|case|catch)\b|&&|\|\||\?\?|\s\?\s`)
+)
+
+// jsDecisionPoints counts the branches, loops, non-default cases, catches,
+// && / || / ?? operators and ternaries on a line of JavaScript, leaving out
+// strings and comments.
+func jsDecisionPoints(line string) int {
+	if strings.HasPrefix(line, "*") || strings.HasPrefix(line, "/*") {
+		return 0 // inside a block comment
+	}
+	line = jsStringOrComment.ReplaceAllString(line, `""`)
+	return len(jsDecision.FindAllString(line, -1))
+}
+
+// cyclomatic returns the cyclomatic complexity of a function: one plus its
+// branches, loops, non-default cases and && / || operators.
+func cyclomatic(d *ast.FuncDecl) int {
+	n := 1
+	if d.Body == nil {
+		return n
+	}
+	ast.Inspect(d.Body, func(node ast.Node) bool {
+		switch s := node.(type) {
+		case *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt:
+			n++
+		case *ast.CaseClause:
+			if s.List != nil {
+				n++
+			}
+		case *ast.CommClause:
+			if s.Comm != nil {
+				n++
+			}
+		case *ast.BinaryExpr:
+			if s.Op == token.LAND || s.Op == token.LOR {
+				n++
+			}
+		}
+		return true
+	})
+	return n
+}
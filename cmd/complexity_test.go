@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestCyclomatic(t *testing.T) {
+	tests := []struct {
+		body string
+		want int
+	}{
+		{"", 1},
+		{"if a && b || c { return }", 4},
+		{"for i := range xs { if i > 0 { continue } }", 3},
+		{"switch x { case 1, 2: case 3: default: }", 3},
+		{"select { case <-ch: case v := <-ch2: _ = v; default: }", 3},
+		{"f := func() { if x { } }; f()", 2},
+	}
+	for _, tt := range tests {
+		src := "package p\n\nfunc f(a, b, c, x bool, xs []int, ch, ch2 chan int) {\n" + tt.body + "\n}\n"
+		file, err := parser.ParseFile(token.NewFileSet(), "", src, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.body, err)
+		}
+		if got := cyclomatic(file.Decls[0].(*ast.FuncDecl)); got != tt.want {
+			t.Errorf("cyclomatic(%q) = %d, want %d", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestJSDecisionPoints(t *testing.T) {
+	tests := []struct {
+		line string
+		want int
+	}{
+		{"const x = 1;", 0},
+		{"} else if (a && b || c) {", 3},
+		{"for (const x of xs) { while (y) {} }", 2},
+		{"case 'a': return x ?? y;", 2},
+		{"const v = ok ? a : b;", 1},
+		{"const n = user?.name; function f(x?: string) {}", 0},
+		{"} catch (err) {", 1},
+		{`log("if && ||", 'for', ` + "`while`" + `); // if a || b`, 0},
+		{"* if the cache is cold", 0},
+	}
+	for _, tt := range tests {
+		if got := jsDecisionPoints(tt.line); got != tt.want {
+			t.Errorf("jsDecisionPoints(%q) = %d, want %d", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestAddedLines(t *testing.T) {
+	old := "a\n  b\nc\nc\n"
+	got := addedLines([]byte(old), []byte("b\nc\nd\nc\nc\n"))
+	if strings.Join(got, ",") != "d,c" {
+		t.Errorf("addedLines() = %q, want [d c]", got)
+	}
+}
+
+func TestGoDecls_SeveralInits(t *testing.T) {
+	const src = "package p\n\nfunc init() {}\n\nfunc _() {}\n\nfunc init() { if x { } }\n\nfunc _() {}\n"
+	edited := strings.Replace(src, "func init() {}", "func init() { for { } }", 1)
+	oldDecls, ok := goDecls([]byte(src))
+	if !ok {
+		t.Fatal("old source does not parse")
+	}
+	newDecls, ok := goDecls([]byte(edited))
+	if !ok {
+		t.Fatal("new source does not parse")
+	}
+	if len(newDecls) != 4 {
+		t.Errorf("goDecls() = %+v, want 4 declarations", newDecls)
+	}
+	var changed []string
+	for key, d := range newDecls {
+		if oldDecls[key].text != d.text {
+			changed = append(changed, key)
+		}
+	}
+	if len(changed) != 1 || changed[0] != "func init#1" || newDecls["func init#1"].complexity != 2 {
+		t.Errorf("changed declarations = %q, want only func init#1 scoring 2", changed)
+	}
+}
+
+const complexityBase = `package calc
+
+type Calc struct{}
+
+func (c *Calc) Add(a, b int) int { return a + b }
+
+func Sign(n int) int {
+	if n < 0 {
+		return -1
+	}
+	return 1
+}
+
+func Removed() {}
+`
+
+func TestMeasureComplexity(t *testing.T) {
+	dir := newTestRepo(t)
+	writeFile(t, dir, "calc.go", complexityBase)
+	writeFile(t, dir, "README.md", strings.Repeat("docs\n", 10))
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "calc")
+
+	// Left uncommitted, so the new side is read from the working tree.
+	// In calc.go Add is untouched and only Sign's body changes, however
+	// long the file gets.
+	edited := strings.Replace(complexityBase, "func Removed() {}\n", "", 1)
+	edited = strings.Replace(edited, "if n < 0 {", "if n < 0 || n == -0 {", 1)
+	edited += "\nconst Zero = 0\n" + strings.Repeat("\n// padding", 300) + "\n"
+	writeFile(t, dir, "calc.go", edited)
+	writeFile(t, dir, "README.md", strings.Repeat("more docs\n", 300))
+	writeFile(t, dir, "broken.go", "package calc\n\nfunc {\n"+strings.Repeat("\n", 200))
+	writeFile(t, dir, "app.ts", strings.Repeat("x\n", 100)+"if (a && b) { run() }\n")
+	runGit(t, dir, "add", "broken.go", "app.ts")
+	writeFile(t, dir, "new.go", "package calc\n\nfunc New(ok bool) int {\n\tif ok {\n\t\treturn 1\n\t}\n\treturn 0\n}\n")
+
+	files, err := getChangedFiles(diffOptions{Mode: modeWorktree})
+	if err != nil {
+		t.Fatal(err)
+	}
+	measureComplexity(files)
+
+	want := map[string]int{
+		"calc.go":   3 + 1 + 1, // Sign (if, ||), the new const, the removed func
+		"README.md": 310 / 50,
+		"broken.go": int(float64(203/10) * 0.8), // does not parse: lines/10 * 0.8
+		"app.ts":    2,                          // if, &&
+		"new.go":    2,
+	}
+	if len(files) != len(want) {
+		t.Fatalf("files = %+v", files)
+	}
+	for _, f := range files {
+		if f.Complexity != want[f.Path] {
+			t.Errorf("%s: Complexity = %d, want %d", f.Path, f.Complexity, want[f.Path])
+		}
+	}
+}
@@ -0,0 +1,450 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// configFileNames are looked up in the repository root, then in the user's
+// home directory. The first file found wins.
+var configFileNames = []string{".prki.yaml", ".prki.yml", ".prkirc"}
+
+// Config is the schema of .prki.yaml / .prkirc.
+type Config struct {
+	Strategy   string         `yaml:"strategy"`
+	Base       string         `yaml:"base"`
+	Thresholds Thresholds     `yaml:"thresholds"`
+	Grouping   []GroupingRule `yaml:"grouping"`
+	PRTemplate PRTemplate     `yaml:"pr_template"`
+	GitHub     GitHubConfig   `yaml:"github"`
+	Forge      string         `yaml:"forge"` // github or gitlab; guessed from origin when empty
+
+	path  string
+	rules []compiledRule
+}
+
+type Thresholds struct {
+	Files      int `yaml:"files"`
+	Lines      int `yaml:"lines"`
+	Complexity int `yaml:"complexity"`
+}
+
+// GroupingRule assigns files matching any of Patterns (and none of Exclude)
+// to the group Name. Patterns are gitignore-style globs: a pattern without a
+// slash matches the file name at any depth, `**` spans directories and
+// `{a,b}` lists alternatives.
+type GroupingRule struct {
+	Name     string   `yaml:"name"`
+	Patterns []string `yaml:"patterns"`
+	Exclude  []string `yaml:"exclude"`
+	Order    int      `yaml:"order"`
+}
+
+type PRTemplate struct {
+	Child ChildPRTemplate `yaml:"child"`
+}
+
+// ChildPRTemplate renders child PR titles and bodies. See templatePlaceholders
+// for the supported {placeholders}.
+type ChildPRTemplate struct {
+	Title string `yaml:"title"`
+	Body  string `yaml:"body"`
+}
+
+type GitHubConfig struct {
+	CreateDraft *bool    `yaml:"create_draft"`
+	AddLabels   []string `yaml:"add_labels"`
+	// AutoAssignReviewers is deprecated and ignored: GitHub already requests
+	// CODEOWNERS reviews on the child PRs, and --reviewers adds others. It is
+	// still accepted so configs written for older versions keep loading.
+	AutoAssignReviewers *bool `yaml:"auto_assign_reviewers"`
+	// APIURL is the REST API root of GitHub Enterprise Server, such as
+	// https://github.example.com/api/v3.
+	APIURL string `yaml:"api_url"`
+}
+
+type compiledRule struct {
+	name     string
+	order    int
+	patterns []*regexp.Regexp
+	exclude  []*regexp.Regexp
+}
+
+// activeConfig is the configuration loaded for the running command, or nil
+// when no config file was found.
+var activeConfig *Config
+
+var configPath string
+
+var templatePlaceholders = []string{"{group_name}", "{parent_branch}", "{parent_pr_number}", "{base_branch}", "{file_list}"}
+
+var validStrategies = []string{"semantic", "directory", "filetype", "hunk", "imports"}
+
+// loadConfig reads the config file at path, or searches the repository root
+// and the home directory when path is empty. It returns nil, nil when no
+// config file exists.
+func loadConfig(path string) (*Config, error) {
+	if path == "" {
+		path = findConfigFile()
+		if path == "" {
+			return nil, nil
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	return parseConfig(path, data)
+}
+
+func findConfigFile() string {
+	var dirs []string
+	if root, err := repoRoot(); err == nil {
+		dirs = append(dirs, root)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, home)
+	}
+	for _, dir := range dirs {
+		for _, name := range configFileNames {
+			p := filepath.Join(dir, name)
+			if info, err := os.Stat(p); err == nil && !info.IsDir() {
+				return p
+			}
+		}
+	}
+	return ""
+}
+
+func parseConfig(path string, data []byte) (*Config, error) {
+	cfg := &Config{path: path}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && err != io.EOF { // io.EOF: empty file
+		return nil, fmt.Errorf("%s: invalid config: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("%s: invalid config:\n%w", path, err)
+	}
+	return cfg, nil
+}
+
+// validate checks the config and compiles the grouping rules. All problems
+// are reported at once so a broken file can be fixed in one go.
+func (c *Config) validate() error {
+	var errs []error
+	if c.Strategy != "" && !contains(validStrategies, c.Strategy) {
+		errs = append(errs, fmt.Errorf("  strategy: %q is not one of %s", c.Strategy, strings.Join(validStrategies, ", ")))
+	}
+	if c.Forge != "" && !contains(validForges, c.Forge) {
+		errs = append(errs, fmt.Errorf("  forge: %q is not one of %s", c.Forge, strings.Join(validForges, ", ")))
+	}
+	if u := c.GitHub.APIURL; u != "" && !strings.HasPrefix(u, "https://") && !strings.HasPrefix(u, "http://") {
+		errs = append(errs, fmt.Errorf("  github.api_url: %q is not an http(s) URL", u))
+	}
+	for name, v := range map[string]int{"files": c.Thresholds.Files, "lines": c.Thresholds.Lines, "complexity": c.Thresholds.Complexity} {
+		if v < 0 {
+			errs = append(errs, fmt.Errorf("  thresholds.%s: must not be negative (got %d)", name, v))
+		}
+	}
+
+	seen := map[string]bool{}
+	for i, r := range c.Grouping {
+		where := fmt.Sprintf("  grouping[%d]", i)
+		if r.Name == "" {
+			errs = append(errs, fmt.Errorf("%s: name is required", where))
+		} else {
+			where = fmt.Sprintf("  grouping[%d] (%s)", i, r.Name)
+			if seen[r.Name] {
+				errs = append(errs, fmt.Errorf("%s: duplicate group name", where))
+			}
+			seen[r.Name] = true
+		}
+		if len(r.Patterns) == 0 {
+			errs = append(errs, fmt.Errorf("%s: at least one pattern is required", where))
+		}
+		if r.Order < 0 {
+			errs = append(errs, fmt.Errorf("%s: order must not be negative (got %d)", where, r.Order))
+		}
+		rule := compiledRule{name: r.Name, order: r.Order}
+		for _, p := range r.Patterns {
+			re, err := compileGlob(p)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: pattern %q: %w", where, p, err))
+				continue
+			}
+			rule.patterns = append(rule.patterns, re)
+		}
+		for _, p := range r.Exclude {
+			re, err := compileGlob(p)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: exclude %q: %w", where, p, err))
+				continue
+			}
+			rule.exclude = append(rule.exclude, re)
+		}
+		c.rules = append(c.rules, rule)
+	}
+
+	for field, tmpl := range map[string]string{"title": c.PRTemplate.Child.Title, "body": c.PRTemplate.Child.Body} {
+		for _, ph := range regexp.MustCompile(`\{[a-z_]+\}`).FindAllString(tmpl, -1) {
+			if !contains(templatePlaceholders, ph) {
+				errs = append(errs, fmt.Errorf("  pr_template.child.%s: unknown placeholder %s (supported: %s)", field, ph, strings.Join(templatePlaceholders, " ")))
+			}
+		}
+	}
+
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errors.Join(errs...)
+}
+
+// deprecations returns a warning for each deprecated setting c uses.
+func (c *Config) deprecations() []string {
+	var warnings []string
+	if c.GitHub.AutoAssignReviewers != nil {
+		warnings = append(warnings, fmt.Sprintf("%s: github.auto_assign_reviewers is deprecated and ignored; use --reviewers", c.path))
+	}
+	return warnings
+}
+
+// groupingRules returns the compiled grouping rules, or nil without a config.
+func (c *Config) groupingRules() []compiledRule {
+	if c == nil {
+		return nil
+	}
+	return c.rules
+}
+
+// flagDefaults maps flag names to the config value that becomes their
+// default. Flags a command does not define are skipped.
+func (c *Config) flagDefaults() map[string]string {
+	d := map[string]string{}
+	if c.Strategy != "" {
+		d["strategy"] = c.Strategy
+	}
+	if c.Base != "" {
+		d["base"] = c.Base
+	}
+	if c.Thresholds.Lines > 0 {
+		d["threshold"] = strconv.Itoa(c.Thresholds.Lines)
+	}
+	if c.Thresholds.Files > 0 {
+		d["max-files"] = strconv.Itoa(c.Thresholds.Files)
+	}
+	if c.Thresholds.Complexity > 0 {
+		d["max-complexity"] = strconv.Itoa(c.Thresholds.Complexity)
+	}
+	if c.GitHub.CreateDraft != nil {
+		d["draft"] = strconv.FormatBool(*c.GitHub.CreateDraft)
+	}
+	return d
+}
+
+// applyConfigDefaults sets flags the user did not pass on the command line
+// to their configured values.
+func applyConfigDefaults(c *cobra.Command, cfg *Config) error {
+	if cfg == nil {
+		return nil
+	}
+	var errs []error
+	for name, value := range cfg.flagDefaults() {
+		f := c.Flags().Lookup(name)
+		if f == nil || f.Changed {
+			continue
+		}
+		if err := setFlagDefault(f, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s: %w", cfg.path, name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// setFlagDefault changes a flag's value without marking it as set by the user.
+func setFlagDefault(f *pflag.Flag, value string) error {
+	if err := f.Value.Set(value); err != nil {
+		return err
+	}
+	f.DefValue = value
+	return nil
+}
+
+// groupByRules groups files by the first rule they match, in rule order.
+// Files matching no rule go to an "Other" group ordered last.
+func groupByRules(files []FileChange, rules []compiledRule) []FileGroup {
+	const otherName = "Other"
+	buckets := map[string][]FileChange{}
+	for _, f := range files {
+		name := otherName
+		for _, r := range rules {
+			if r.matches(f.Path) {
+				name = r.name
+				break
+			}
+		}
+		buckets[name] = append(buckets[name], f)
+	}
+
+	var groups []FileGroup
+	maxOrder := 0
+	for _, r := range rules {
+		if r.order > maxOrder {
+			maxOrder = r.order
+		}
+		if len(buckets[r.name]) > 0 {
+			groups = append(groups, FileGroup{Name: r.name, Files: buckets[r.name], Order: r.order})
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Order < groups[j].Order })
+	if other := buckets[otherName]; len(other) > 0 && !hasGroup(groups, otherName) {
+		groups = append(groups, FileGroup{Name: otherName, Files: other, Order: maxOrder + 1})
+	}
+	return groups
+}
+
+func (r compiledRule) matches(path string) bool {
+	return matchAny(path, r.patterns) && !matchAny(path, r.exclude)
+}
+
+func hasGroup(groups []FileGroup, name string) bool {
+	for _, g := range groups {
+		if g.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// compileGlob translates a gitignore-style glob into a regexp matched
+// against slash-separated paths relative to the repository root.
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	p := strings.TrimPrefix(pattern, "./")
+	if p == "" {
+		return nil, fmt.Errorf("empty pattern")
+	}
+	anchored := strings.Contains(strings.TrimSuffix(p, "/"), "/")
+	p = strings.TrimPrefix(p, "/")
+	dirOnly := strings.HasSuffix(p, "/")
+	p = strings.TrimSuffix(p, "/")
+
+	var sb strings.Builder
+	sb.WriteString("^")
+	if !anchored {
+		sb.WriteString("(?:.*/)?")
+	}
+	depth := 0
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch c {
+		case '*':
+			if i+1 < len(p) && p[i+1] == '*' {
+				i++
+				if i+1 < len(p) && p[i+1] == '/' {
+					i++
+					sb.WriteString("(?:.*/)?")
+				} else {
+					sb.WriteString(".*")
+				}
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '{':
+			depth++
+			sb.WriteString("(?:")
+		case '}':
+			if depth == 0 {
+				return nil, fmt.Errorf("unmatched '}'")
+			}
+			depth--
+			sb.WriteString(")")
+		case ',':
+			if depth > 0 {
+				sb.WriteString("|")
+			} else {
+				sb.WriteString(",")
+			}
+		case '[':
+			end := strings.IndexByte(p[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unmatched '['")
+			}
+			class := p[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("unmatched '{'")
+	}
+	if dirOnly {
+		sb.WriteString("/.*")
+	} else {
+		// a pattern naming a directory also matches everything below it
+		sb.WriteString("(?:/.*)?")
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+// renderTemplate fills the {placeholders} of a PR template.
+func renderTemplate(tmpl string, parentBranch, baseBranch string, parentPR int, g FileGroup) string {
+	var files strings.Builder
+	for _, f := range g.Files {
+		files.WriteString(fileListItem(f))
+	}
+	prNumber := "?"
+	if parentPR > 0 {
+		prNumber = strconv.Itoa(parentPR)
+	}
+	return strings.NewReplacer(
+		"{group_name}", g.Name,
+		"{parent_branch}", parentBranch,
+		"{parent_pr_number}", prNumber,
+		"{base_branch}", baseBranch,
+		"{file_list}", strings.TrimRight(files.String(), "\n"),
+	).Replace(tmpl)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "Config file (default: .prki.yaml or .prkirc in the repository root, then the home directory)")
+	rootCmd.PersistentPreRunE = func(c *cobra.Command, args []string) error {
+		cfg, err := loadConfig(configPath)
+		if err != nil {
+			return err
+		}
+		activeConfig = cfg
+		if cfg != nil {
+			for _, w := range cfg.deprecations() {
+				fmt.Fprintf(c.ErrOrStderr(), "⚠  %s\n", w)
+			}
+		}
+		return applyConfigDefaults(c, cfg)
+	}
+}
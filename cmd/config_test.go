@@ -0,0 +1,339 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// readmeConfig is the example configuration from README.md.
+const readmeConfig = `
+strategy: semantic
+
+thresholds:
+  files: 10
+  lines: 500
+  complexity: 100
+
+grouping:
+  - name: "Infrastructure & Config"
+    patterns:
+      - "*.config.{js,ts}"
+      - "package.json"
+      - "tsconfig.json"
+      - ".github/**"
+    order: 1
+
+  - name: "Core Business Logic"
+    patterns:
+      - "src/**/*.{ts,tsx}"
+    exclude:
+      - "**/*.test.{ts,tsx}"
+    order: 2
+
+  - name: "Tests"
+    patterns:
+      - "**/*.test.{ts,tsx}"
+      - "**/*.spec.{ts,tsx}"
+    order: 3
+
+  - name: "Documentation"
+    patterns:
+      - "*.md"
+      - "docs/**"
+    order: 4
+
+pr_template:
+  child:
+    title: "[Review] {group_name}"
+    body: |
+      Parent PR: #{parent_pr_number}
+      Group: {group_name}
+
+      ## Changes
+      {file_list}
+
+github:
+  create_draft: true
+  add_labels:
+    - "review-split"
+    - "child-pr"
+`
+
+func TestCompileGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*.md", "README.md", true},
+		{"*.md", "docs/guide/intro.md", true},
+		{"*.md", "README.mdx", false},
+		{"package.json", "web/package.json", true},
+		{"*.config.{js,ts}", "vite.config.ts", true},
+		{"*.config.{js,ts}", "apps/web/next.config.js", true},
+		{"*.config.{js,ts}", "vite.config.mjs", false},
+		{".github/**", ".github/workflows/ci.yml", true},
+		{".github/**", "sub/.github/workflows/ci.yml", false},
+		{"docs/**", "docs/a/b.png", true},
+		{"docs/", "docs/a.md", true},
+		{"src/**/*.{ts,tsx}", "src/app.ts", true},
+		{"src/**/*.{ts,tsx}", "src/features/pay/Form.tsx", true},
+		{"src/**/*.{ts,tsx}", "lib/app.ts", false},
+		{"**/*.test.{ts,tsx}", "src/a/b.test.tsx", true},
+		{"**/*.test.{ts,tsx}", "b.test.ts", true},
+		{"src/*.go", "src/pkg/a.go", false},
+		{"file?.txt", "file1.txt", true},
+		{"[!a]*.go", "b.go", true},
+		{"[!a]*.go", "a.go", false},
+		{"/Makefile", "Makefile", true},
+		{"/Makefile", "sub/Makefile", false},
+		{"vendor", "vendor/x/y.go", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			re, err := compileGlob(tt.pattern)
+			if err != nil {
+				t.Fatalf("compileGlob(%q): %v", tt.pattern, err)
+			}
+			if got := re.MatchString(tt.path); got != tt.want {
+				t.Errorf("%q matches %q = %v, want %v (regexp %s)", tt.pattern, tt.path, got, tt.want, re)
+			}
+		})
+	}
+}
+
+func TestCompileGlob_Invalid(t *testing.T) {
+	for _, p := range []string{"", "*.{js", "a}", "[abc"} {
+		if _, err := compileGlob(p); err == nil {
+			t.Errorf("compileGlob(%q) should fail", p)
+		}
+	}
+}
+
+func TestParseConfig_READMEExample(t *testing.T) {
+	cfg, err := parseConfig(".prki.yaml", []byte(readmeConfig))
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+	if cfg.Strategy != "semantic" || cfg.Thresholds.Lines != 500 || cfg.Thresholds.Files != 10 {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+	if len(cfg.groupingRules()) != 4 {
+		t.Errorf("got %d rules, want 4", len(cfg.groupingRules()))
+	}
+	if cfg.GitHub.CreateDraft == nil || !*cfg.GitHub.CreateDraft {
+		t.Error("create_draft should be true")
+	}
+}
+
+func TestParseConfig_Empty(t *testing.T) {
+	cfg, err := parseConfig(".prkirc", nil)
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+	if len(cfg.groupingRules()) != 0 {
+		t.Error("empty config should have no rules")
+	}
+}
+
+func TestParseConfig_Deprecated(t *testing.T) {
+	cfg, err := parseConfig(".prki.yaml", []byte("github:\n  create_draft: true\n  auto_assign_reviewers: true\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.deprecations(); len(got) != 1 || !strings.Contains(got[0], "auto_assign_reviewers is deprecated") {
+		t.Errorf("deprecations() = %q", got)
+	}
+	if cfg, _ := parseConfig(".prki.yaml", []byte("github:\n  create_draft: true\n")); len(cfg.deprecations()) != 0 {
+		t.Errorf("deprecations() without deprecated settings = %q", cfg.deprecations())
+	}
+}
+
+func TestParseConfig_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr []string
+	}{
+		{
+			"unknown field",
+			"strategi: semantic\n",
+			[]string{".prki.yaml", "field strategi not found"},
+		},
+		{
+			"invalid strategy",
+			"strategy: random\n",
+			[]string{`strategy: "random" is not one of semantic, directory, filetype`},
+		},
+		{
+			"invalid forge",
+			"forge: bitbucket\n",
+			[]string{`forge: "bitbucket" is not one of github, gitlab`},
+		},
+		{
+			"invalid api_url",
+			"github:\n  api_url: github.example.com/api/v3\n",
+			[]string{`github.api_url: "github.example.com/api/v3" is not an http(s) URL`},
+		},
+		{
+			"negative threshold",
+			"thresholds:\n  lines: -1\n",
+			[]string{"thresholds.lines: must not be negative"},
+		},
+		{
+			"grouping problems are all reported",
+			"grouping:\n  - name: A\n    patterns: ['*.{go']\n  - name: A\n  - patterns: ['x']\n",
+			[]string{`grouping[0] (A): pattern "*.{go": unmatched '{'`, "grouping[1] (A): duplicate group name", "grouping[1] (A): at least one pattern is required", "grouping[2]: name is required"},
+		},
+		{
+			"unknown template placeholder",
+			"pr_template:\n  child:\n    title: '{group}'\n",
+			[]string{"pr_template.child.title: unknown placeholder {group}"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseConfig(".prki.yaml", []byte(tt.yaml))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error does not contain %q:\n%v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadConfig_SearchesRepoRoot(t *testing.T) {
+	dir := newTestRepo(t)
+	t.Setenv("HOME", t.TempDir())
+
+	cfg, err := loadConfig("")
+	if err != nil || cfg != nil {
+		t.Fatalf("loadConfig without a file = %v, %v; want nil, nil", cfg, err)
+	}
+
+	writeFile(t, dir, ".prkirc", "strategy: directory\n")
+	writeFile(t, dir, "sub/.keep", "")
+	t.Chdir(filepath.Join(dir, "sub"))
+	cfg, err = loadConfig("")
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg == nil || cfg.Strategy != "directory" {
+		t.Errorf("loadConfig = %+v, want strategy directory from repo root", cfg)
+	}
+}
+
+func TestLoadConfig_FallsBackToHome(t *testing.T) {
+	newTestRepo(t)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	writeFile(t, home, ".prki.yaml", "strategy: filetype\n")
+
+	cfg, err := loadConfig("")
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg == nil || cfg.Strategy != "filetype" {
+		t.Errorf("loadConfig = %+v, want strategy filetype from home", cfg)
+	}
+}
+
+func TestGroupByRules(t *testing.T) {
+	cfg, err := parseConfig(".prki.yaml", []byte(readmeConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []FileChange{
+		{Path: "README.md"},
+		{Path: "src/pay/form.test.tsx"},
+		{Path: "src/pay/form.tsx"},
+		{Path: "package.json"},
+		{Path: "scripts/release.sh"},
+	}
+	groups := groupByRules(files, cfg.groupingRules())
+
+	want := []struct {
+		name  string
+		path  string
+		order int
+	}{
+		{"Infrastructure & Config", "package.json", 1},
+		{"Core Business Logic", "src/pay/form.tsx", 2},
+		{"Tests", "src/pay/form.test.tsx", 3},
+		{"Documentation", "README.md", 4},
+		{"Other", "scripts/release.sh", 5},
+	}
+	if len(groups) != len(want) {
+		t.Fatalf("got %d groups, want %d: %+v", len(groups), len(want), groups)
+	}
+	for i, w := range want {
+		g := groups[i]
+		if g.Name != w.name || g.Order != w.order || len(g.Files) != 1 || g.Files[0].Path != w.path {
+			t.Errorf("groups[%d] = %+v, want %s (order %d) with %s", i, g, w.name, w.order, w.path)
+		}
+	}
+}
+
+func TestGroupFiles_UsesConfigRules(t *testing.T) {
+	cfg, err := parseConfig(".prki.yaml", []byte("grouping:\n  - name: Go\n    patterns: ['*.go']\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	activeConfig = cfg
+	t.Cleanup(func() { activeConfig = nil })
+
+	groups := groupFiles([]FileChange{{Path: "cmd/analyze.go"}, {Path: "cmd/analyze_test.go"}}, "semantic")
+	if len(groups) != 1 || groups[0].Name != "Go" || len(groups[0].Files) != 2 {
+		t.Errorf("got %+v, want a single Go group", groups)
+	}
+}
+
+func TestApplyConfigDefaults(t *testing.T) {
+	cfg, err := parseConfig(".prki.yaml", []byte(readmeConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var strategy string
+	var threshold int
+	var draft bool
+	c := &cobra.Command{Use: "test"}
+	c.Flags().StringVar(&strategy, "strategy", "semantic", "")
+	c.Flags().IntVar(&threshold, "threshold", 300, "")
+	c.Flags().BoolVar(&draft, "draft", false, "")
+	if err := c.Flags().Parse([]string{"--threshold", "42"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := applyConfigDefaults(c, cfg); err != nil {
+		t.Fatalf("applyConfigDefaults: %v", err)
+	}
+	if threshold != 42 {
+		t.Errorf("threshold = %d, explicit flag should win over config", threshold)
+	}
+	if !draft {
+		t.Error("draft should default to github.create_draft")
+	}
+	if strategy != "semantic" {
+		t.Errorf("strategy = %q", strategy)
+	}
+	if c.Flags().Lookup("draft").Changed {
+		t.Error("config defaults should not mark flags as changed")
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	g := FileGroup{Name: "Tests", Files: []FileChange{{Path: "a_test.go", LinesAdded: 3, LinesDeleted: 1}}}
+	got := renderTemplate("{group_name} for {parent_branch} (#{parent_pr_number}) into {base_branch}\n{file_list}", "feature/x", "main", 0, g)
+	want := "Tests for feature/x (#?) into main\n- `a_test.go` (+3/-1 lines)"
+	if got != want {
+		t.Errorf("renderTemplate() = %q, want %q", got, want)
+	}
+}
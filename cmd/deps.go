@@ -0,0 +1,426 @@
+package cmd
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GroupDependency says that a group uses Go packages or JS/TS modules that
+// another group changes, so it only compiles once that group is merged.
+type GroupDependency struct {
+	Group    string   // the group depended on
+	Packages []string // Go import paths, or paths of JS/TS files, it changes
+}
+
+// readFunc returns the changed content of a file, by repository path.
+type readFunc func(path string) ([]byte, error)
+
+// changeReader reads files as they are in rev, or, for uncommitted changes
+// without a rev, from the index (staged) or the working tree.
+func changeReader(mode diffMode, rev string) readFunc {
+	switch {
+	case rev != "":
+		return func(p string) ([]byte, error) {
+			out, err := gitOutput("cat-file", "blob", rev+":"+p)
+			return []byte(out), err
+		}
+	case mode == modeStaged:
+		return func(p string) ([]byte, error) {
+			out, err := gitOutput("cat-file", "blob", ":"+p)
+			return []byte(out), err
+		}
+	case mode == modeBranch:
+		return changeReader(mode, "HEAD")
+	default:
+		return func(p string) ([]byte, error) {
+			root, err := repoRoot()
+			if err != nil {
+				return nil, err
+			}
+			return os.ReadFile(filepath.Join(root, p))
+		}
+	}
+}
+
+// goModulePath returns the module path declared in the root go.mod, or ""
+// when there is none.
+func goModulePath(read readFunc) string {
+	data, err := read("go.mod")
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "module" {
+			if p, err := strconv.Unquote(fields[1]); err == nil {
+				return p
+			}
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+// linkDependencies sets the DependsOn of each group from the Go and JS/TS
+// imports of its files; see goUses and jsUses.
+func linkDependencies(groups []FileGroup, read readFunc) {
+	uses := make([]map[int]map[string]bool, len(groups))
+	use := func(i, j int, what string) {
+		if i == j {
+			return
+		}
+		if uses[i] == nil {
+			uses[i] = map[int]map[string]bool{}
+		}
+		if uses[i][j] == nil {
+			uses[i][j] = map[string]bool{}
+		}
+		uses[i][j][what] = true
+	}
+	goUses(groups, read, use)
+	jsUses(groups, read, use)
+
+	for i := range groups {
+		groups[i].DependsOn = nil
+		for j := range groups {
+			if len(uses[i][j]) == 0 {
+				continue
+			}
+			pkgs := make([]string, 0, len(uses[i][j]))
+			for p := range uses[i][j] {
+				pkgs = append(pkgs, p)
+			}
+			sort.Strings(pkgs)
+			groups[i].DependsOn = append(groups[i].DependsOn, GroupDependency{Group: groups[j].Name, Packages: pkgs})
+		}
+	}
+}
+
+// goUses reports that group i uses group j when one of its Go files refers
+// to a top-level name that j's changes to the non-test files of a package
+// declare: by the bare name within the same package, or, in a file
+// importing the package, as pkg.Name for exported names and x.Name for
+// exported methods. Importing a package j changes is not enough, as j may
+// only have changed code i does not use. Only packages of the module in the
+// root go.mod are considered; files that cannot be read or parsed are
+// skipped.
+func goUses(groups []FileGroup, read readFunc, use func(i, j int, pkg string)) {
+	module := goModulePath(read)
+	if module == "" {
+		return
+	}
+	pkgOf := func(file string) string {
+		dir := path.Dir(file)
+		if dir == "." {
+			return module
+		}
+		return module + "/" + dir
+	}
+
+	type goFile struct {
+		group int
+		pkg   string
+		test  bool
+		ast   *ast.File
+		lines changedLines
+	}
+	fset := token.NewFileSet()
+	var files []goFile
+	for i, g := range groups {
+		for _, f := range g.Files {
+			if !isGoSource(f) {
+				continue
+			}
+			src, err := read(f.Path)
+			if err != nil {
+				continue
+			}
+			file, err := parser.ParseFile(fset, f.Path, src, parser.SkipObjectResolution)
+			if err != nil {
+				continue
+			}
+			files = append(files, goFile{group: i, pkg: pkgOf(f.Path), test: strings.HasSuffix(f.Path, "_test.go"), ast: file, lines: linesOf(f)})
+		}
+	}
+
+	// the names each group's changes declare in the packages, and the
+	// packages' names
+	declared := map[string]map[int]map[string]bool{}
+	methods := map[string]bool{} // exported methods declared by any group
+	pkgNames := map[string]string{}
+	for _, f := range files {
+		if f.test {
+			continue
+		}
+		pkgNames[f.pkg] = f.ast.Name.Name
+		if declared[f.pkg] == nil {
+			declared[f.pkg] = map[int]map[string]bool{}
+		}
+		if declared[f.pkg][f.group] == nil {
+			declared[f.pkg][f.group] = map[string]bool{}
+		}
+		goDeclaredNames(fset, f.ast, f.lines, declared[f.pkg][f.group])
+		for _, d := range f.ast.Decls {
+			if fn, ok := d.(*ast.FuncDecl); ok && fn.Recv != nil && fn.Name.IsExported() {
+				methods[fn.Name.Name] = true
+			}
+		}
+	}
+
+	for _, f := range files {
+		refs := goReferencedNames(fset, f.ast, f.lines)
+		qualified, selected := goSelectorNames(fset, f.ast, f.lines)
+		for _, imp := range f.ast.Imports {
+			pkg, err := strconv.Unquote(imp.Path.Value)
+			if err != nil || declared[pkg] == nil {
+				continue
+			}
+			name := pkgNames[pkg]
+			if imp.Name != nil {
+				name = imp.Name.Name
+			}
+			for j, names := range declared[pkg] {
+				for n := range names {
+					if !token.IsExported(n) {
+						continue
+					}
+					if qualified[name+"."+n] || (name == "." && refs[n]) || (methods[n] && selected[n]) {
+						use(f.group, j, pkg)
+						break
+					}
+				}
+			}
+		}
+		for j, names := range declared[f.pkg] {
+			for name := range names {
+				if refs[name] {
+					use(f.group, j, f.pkg)
+					break
+				}
+			}
+		}
+	}
+}
+
+// changedLines are the lines of a file a group changes, in the file's new
+// version; whole means all of them, for files not split by hunks.
+type changedLines struct {
+	whole  bool
+	ranges [][2]int // first and last line
+}
+
+func linesOf(f FileChange) changedLines {
+	if !f.Partial() {
+		return changedLines{whole: true}
+	}
+	var l changedLines
+	for _, h := range f.Hunks {
+		if h.NewLines > 0 {
+			l.ranges = append(l.ranges, [2]int{h.NewStart, h.NewStart + h.NewLines - 1})
+		}
+	}
+	return l
+}
+
+func (l changedLines) contains(line int) bool {
+	if l.whole {
+		return true
+	}
+	for _, r := range l.ranges {
+		if r[0] <= line && line <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// goTopLevelNames returns the identifiers naming the top-level
+// declarations of file.
+func goTopLevelNames(file *ast.File) []*ast.Ident {
+	var names []*ast.Ident
+	for _, d := range file.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			names = append(names, d.Name)
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					names = append(names, spec.Name)
+				case *ast.ValueSpec:
+					names = append(names, spec.Names...)
+				}
+			}
+		}
+	}
+	return names
+}
+
+// goDeclaredNames adds the top-level names declared on lines to names.
+func goDeclaredNames(fset *token.FileSet, file *ast.File, lines changedLines, names map[string]bool) {
+	for _, id := range goTopLevelNames(file) {
+		if id.Name != "_" && lines.contains(fset.Position(id.Pos()).Line) {
+			names[id.Name] = true
+		}
+	}
+}
+
+// goReferencedNames returns the identifiers used on lines, leaving out the
+// names of top-level declarations themselves.
+func goReferencedNames(fset *token.FileSet, file *ast.File, lines changedLines) map[string]bool {
+	declNames := map[*ast.Ident]bool{}
+	for _, id := range goTopLevelNames(file) {
+		declNames[id] = true
+	}
+	refs := map[string]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && !declNames[id] && lines.contains(fset.Position(id.Pos()).Line) {
+			refs[id.Name] = true
+		}
+		return true
+	})
+	return refs
+}
+
+// goSelectorNames returns the selector expressions used on lines, as
+// "X.Name" for qualified identifiers such as pkg.Name, and the selected
+// names alone, which may be methods or fields.
+func goSelectorNames(fset *token.FileSet, file *ast.File, lines changedLines) (qualified, selected map[string]bool) {
+	qualified, selected = map[string]bool{}, map[string]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok || !lines.contains(fset.Position(sel.Sel.Pos()).Line) {
+			return true
+		}
+		selected[sel.Sel.Name] = true
+		if x, ok := sel.X.(*ast.Ident); ok {
+			qualified[x.Name+"."+sel.Sel.Name] = true
+		}
+		return true
+	})
+	return qualified, selected
+}
+
+// jsUses reports that group i uses group j when one of its JS/TS files
+// imports a file that j changes; see jsImportGraph.
+func jsUses(groups []FileGroup, read readFunc, use func(i, j int, file string)) {
+	var files []FileChange
+	providers := map[string][]int{}
+	for i, g := range groups {
+		for _, f := range g.Files {
+			files = append(files, f)
+			if !slices.Contains(providers[f.Path], i) {
+				providers[f.Path] = append(providers[f.Path], i)
+			}
+		}
+	}
+	graph := jsImportGraph(files, read)
+	for i, g := range groups {
+		for _, f := range g.Files {
+			for _, t := range graph[f.Path] {
+				for _, j := range providers[t] {
+					use(i, j, t)
+				}
+			}
+		}
+	}
+}
+
+func isGoSource(f FileChange) bool {
+	return strings.HasSuffix(f.Path, ".go") && f.Status != statusDeleted && !f.Binary
+}
+
+// orderByDependencies links the dependencies of groups and, when there
+// are any, sorts the groups so that every group comes after the groups it
+// depends on, keeping the existing order otherwise, and renumbers Order.
+// Groups that depend on each other keep their existing order.
+func orderByDependencies(groups []FileGroup, read readFunc) []FileGroup {
+	linkDependencies(groups, read)
+	hasDeps := false
+	for _, g := range groups {
+		hasDeps = hasDeps || len(g.DependsOn) > 0
+	}
+	if !hasDeps {
+		return groups
+	}
+
+	remaining := slices.Clone(groups)
+	sort.SliceStable(remaining, func(i, j int) bool { return remaining[i].Order < remaining[j].Order })
+	placed := map[string]bool{}
+	var ordered []FileGroup
+	for len(remaining) > 0 {
+		next := 0 // on a cycle, the first remaining group
+		for i, g := range remaining {
+			if len(unplaced(g, placed)) == 0 {
+				next = i
+				break
+			}
+		}
+		g := remaining[next]
+		remaining = slices.Delete(remaining, next, next+1)
+		placed[g.Name] = true
+		ordered = append(ordered, g)
+	}
+	for i := range ordered {
+		ordered[i].Order = i + 1
+	}
+	return ordered
+}
+
+// groupChanges groups files by strategy, balances them into parts groups
+// unless parts is 0, and orders the groups by their dependencies. The
+// imports strategy also keeps JS/TS files that import each other in one
+// group.
+func groupChanges(files []FileChange, strategy string, parts int, read readFunc) ([]FileGroup, error) {
+	groups := groupFiles(files, strategy)
+	if strategy == "imports" {
+		groups = keepCoupledTogether(groups, coupledFiles(jsImportGraph(files, read), read))
+	}
+	if parts != 0 {
+		linkDependencies(groups, read)
+		var err error
+		if groups, err = balanceGroups(groups, parts); err != nil {
+			return nil, err
+		}
+	}
+	return orderByDependencies(groups, read), nil
+}
+
+// unplaced returns the groups g depends on that are not placed yet.
+func unplaced(g FileGroup, placed map[string]bool) []string {
+	var names []string
+	for _, d := range g.DependsOn {
+		if !placed[d.Group] {
+			names = append(names, d.Group)
+		}
+	}
+	return names
+}
+
+// dependencyWarnings lists the child PRs that will not compile on their
+// own, because each child branch starts from the base without the changes
+// of its siblings, and the groups that depend on each other.
+func dependencyWarnings(groups []FileGroup) []string {
+	var warnings []string
+	for i, g := range groups {
+		for _, d := range g.DependsOn {
+			warnings = append(warnings, fmt.Sprintf("%s will not compile without %s (uses %s)",
+				g.Name, d.Group, strings.Join(d.Packages, ", ")))
+		}
+		for _, other := range groups[i+1:] {
+			if dependsOnGroup(g, other.Name) && dependsOnGroup(other, g.Name) {
+				warnings = append(warnings, fmt.Sprintf("%s and %s depend on each other; consider merging them into one group", g.Name, other.Name))
+			}
+		}
+	}
+	return warnings
+}
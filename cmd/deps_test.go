@@ -0,0 +1,272 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mapReader reads files from a map, like changeReader reads them from git.
+func mapReader(files map[string]string) readFunc {
+	return func(p string) ([]byte, error) {
+		src, ok := files[p]
+		if !ok {
+			return nil, errors.New("not found")
+		}
+		return []byte(src), nil
+	}
+}
+
+var depsRepo = map[string]string{
+	"go.mod":               "module example.com/shop\n\ngo 1.25\n",
+	"store/store.go":       "package store\n\nfunc Save() {}\n",
+	"store/store_test.go":  "package store\n\nimport \"testing\"\n\nfunc TestSave(t *testing.T) { Save() }\n",
+	"api/handler.go":       "package api\n\nimport (\n\t\"fmt\"\n\t\"example.com/shop/store\"\n)\n\nfunc H() { fmt.Println(); store.Save() }\n",
+	"api/handler_test.go":  "package api\n\nimport \"testing\"\n\nfunc TestH(t *testing.T) { H() }\n",
+	"cmd/shop/main.go":     "package main\n\nimport \"example.com/shop/api\"\n\nfunc main() { api.H() }\n",
+	"broken/broken.go":     "package broken\n\nimport (\n",
+	"docs/architecture.md": "# shop\n",
+}
+
+func TestGoModulePath(t *testing.T) {
+	tests := []struct {
+		gomod string
+		want  string
+	}{
+		{"module example.com/shop\n", "example.com/shop"},
+		{"// comment\nmodule \"example.com/quoted\"\n", "example.com/quoted"},
+		{"go 1.25\n", ""},
+	}
+	for _, tt := range tests {
+		if got := goModulePath(mapReader(map[string]string{"go.mod": tt.gomod})); got != tt.want {
+			t.Errorf("goModulePath(%q) = %q, want %q", tt.gomod, got, tt.want)
+		}
+	}
+	if got := goModulePath(mapReader(nil)); got != "" {
+		t.Errorf("goModulePath() without go.mod = %q", got)
+	}
+}
+
+func TestLinkGoDependencies(t *testing.T) {
+	groups := []FileGroup{
+		{Name: "API", Files: []FileChange{{Path: "api/handler.go"}, {Path: "cmd/shop/main.go"}}},
+		{Name: "Store", Files: []FileChange{{Path: "store/store.go"}, {Path: "broken/broken.go"}}},
+		{Name: "Tests", Files: []FileChange{{Path: "store/store_test.go"}, {Path: "api/handler_test.go"}}},
+		{Name: "Docs", Files: []FileChange{{Path: "docs/architecture.md"}}},
+	}
+	linkDependencies(groups, mapReader(depsRepo))
+
+	want := map[string][]GroupDependency{
+		"API":   {{Group: "Store", Packages: []string{"example.com/shop/store"}}},
+		"Store": nil,
+		"Tests": {
+			{Group: "API", Packages: []string{"example.com/shop/api"}},
+			{Group: "Store", Packages: []string{"example.com/shop/store"}},
+		},
+		"Docs": nil,
+	}
+	for _, g := range groups {
+		if !reflect.DeepEqual(g.DependsOn, want[g.Name]) {
+			t.Errorf("%s depends on %+v, want %+v", g.Name, g.DependsOn, want[g.Name])
+		}
+	}
+}
+
+func TestLinkGoDependencies_NoModule(t *testing.T) {
+	groups := []FileGroup{
+		{Name: "API", Files: []FileChange{{Path: "api/handler.go"}}},
+		{Name: "Store", Files: []FileChange{{Path: "store/store.go"}}},
+	}
+	files := map[string]string{"api/handler.go": depsRepo["api/handler.go"], "store/store.go": depsRepo["store/store.go"]}
+	linkDependencies(groups, mapReader(files))
+	for _, g := range groups {
+		if g.DependsOn != nil {
+			t.Errorf("%s depends on %+v without a go.mod", g.Name, g.DependsOn)
+		}
+	}
+}
+
+func TestOrderByDependencies(t *testing.T) {
+	groups := []FileGroup{
+		{Name: "Docs", Order: 1, Files: []FileChange{{Path: "docs/architecture.md"}}},
+		{Name: "Tests", Order: 2, Files: []FileChange{{Path: "store/store_test.go"}}},
+		{Name: "API", Order: 3, Files: []FileChange{{Path: "api/handler.go"}}},
+		{Name: "Store", Order: 4, Files: []FileChange{{Path: "store/store.go"}}},
+	}
+	ordered := orderByDependencies(groups, mapReader(depsRepo))
+
+	var got []string
+	for i, g := range ordered {
+		got = append(got, g.Name)
+		if g.Order != i+1 {
+			t.Errorf("%s has order %d, want %d", g.Name, g.Order, i+1)
+		}
+	}
+	if want := []string{"Docs", "Store", "Tests", "API"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("order = %v, want %v", got, want)
+	}
+}
+
+func TestOrderByDependencies_NoDependencies(t *testing.T) {
+	groups := []FileGroup{
+		{Name: "Docs", Order: 5, Files: []FileChange{{Path: "docs/architecture.md"}}},
+		{Name: "Store", Order: 2, Files: []FileChange{{Path: "store/store.go"}}},
+	}
+	ordered := orderByDependencies(groups, mapReader(depsRepo))
+	if ordered[0].Name != "Docs" || ordered[0].Order != 5 || ordered[1].Order != 2 {
+		t.Errorf("groups without dependencies changed: %+v", ordered)
+	}
+}
+
+func TestOrderByDependencies_Cycle(t *testing.T) {
+	files := map[string]string{
+		"go.mod":       depsRepo["go.mod"],
+		"store/get.go": "package store\n\nfunc Get() { Put() }\n",
+		"store/put.go": "package store\n\nfunc Put() { Get() }\n",
+	}
+	groups := []FileGroup{
+		{Name: "Refactoring", Order: 1, Files: []FileChange{{Path: "store/get.go"}}},
+		{Name: "Core", Order: 2, Files: []FileChange{{Path: "store/put.go"}}},
+	}
+	ordered := orderByDependencies(groups, mapReader(files))
+	if ordered[0].Name != "Refactoring" || ordered[1].Name != "Core" {
+		t.Errorf("cycle reordered groups: %+v", ordered)
+	}
+	warnings := dependencyWarnings(ordered)
+	want := []string{
+		"Refactoring will not compile without Core (uses example.com/shop/store)",
+		"Refactoring and Core depend on each other; consider merging them into one group",
+		"Core will not compile without Refactoring (uses example.com/shop/store)",
+	}
+	if !reflect.DeepEqual(warnings, want) {
+		t.Errorf("warnings =\n%q\nwant\n%q", warnings, want)
+	}
+}
+
+func TestLinkGoDependencies_SamePackage(t *testing.T) {
+	// main.go as the parent has it: hunk 1 changes b, hunk 2 adds c
+	files := map[string]string{
+		"go.mod":  depsRepo["go.mod"],
+		"main.go": "package main\n\nfunc b() {\n\tprintln(1)\n\tprintln(2)\n\tprintln(3)\n}\n\nfunc c() {\n\tb()\n}\n",
+		"util.go": "package main\n\nfunc unrelated() {}\n",
+	}
+	file := FileChange{Path: "main.go", Status: statusModified, hunkCount: 2, Hunks: []Hunk{
+		{Index: 1, OldStart: 3, OldLines: 0, NewStart: 4, NewLines: 3},
+		{Index: 2, OldStart: 4, OldLines: 0, NewStart: 8, NewLines: 4},
+	}}
+	split := func() []FileGroup {
+		return []FileGroup{
+			{Name: "Refactoring", Files: []FileChange{file.withHunks(file.Hunks[:1])}},
+			{Name: "Core", Files: []FileChange{file.withHunks(file.Hunks[1:])}},
+			{Name: "Other", Files: []FileChange{{Path: "util.go"}}},
+		}
+	}
+
+	groups := split()
+	linkDependencies(groups, mapReader(files))
+	for _, g := range groups {
+		if g.DependsOn != nil {
+			t.Errorf("%s depends on %+v, but no group uses a name another one declares", g.Name, g.DependsOn)
+		}
+	}
+
+	// the first hunk now adds a, which c calls
+	files["main.go"] = "package main\n\nfunc b() {}\n\nfunc a() {}\n\n\nfunc c() {\n\ta()\n}\n"
+	groups = split()
+	linkDependencies(groups, mapReader(files))
+	if want := []GroupDependency{{Group: "Refactoring", Packages: []string{"example.com/shop"}}}; !reflect.DeepEqual(groups[1].DependsOn, want) {
+		t.Errorf("Core depends on %+v, want %+v", groups[1].DependsOn, want)
+	}
+	if groups[0].DependsOn != nil || groups[2].DependsOn != nil {
+		t.Errorf("unexpected dependencies: %+v", groups)
+	}
+}
+
+func TestLinkGoDependencies_OnlyUsedExportedNames(t *testing.T) {
+	// store.go as the parent has it: hunk 1 changes the unexported flush,
+	// hunk 2 adds the exported method Close
+	files := map[string]string{
+		"go.mod":         depsRepo["go.mod"],
+		"store/store.go": "package store\n\ntype Store struct{}\n\nfunc (s *Store) Save() { s.flush() }\n\nfunc (s *Store) flush() {}\n\nfunc (s *Store) Close() {}\n",
+		"api/handler.go": "package api\n\nimport db \"example.com/shop/store\"\n\nfunc H(s *db.Store) { s.Save() }\n",
+	}
+	file := FileChange{Path: "store/store.go", Status: statusModified, hunkCount: 2, Hunks: []Hunk{
+		{Index: 1, OldStart: 7, OldLines: 1, NewStart: 7, NewLines: 1},
+		{Index: 2, OldStart: 8, OldLines: 0, NewStart: 9, NewLines: 1},
+	}}
+	link := func(storeHunks []Hunk) []GroupDependency {
+		groups := []FileGroup{
+			{Name: "API", Files: []FileChange{{Path: "api/handler.go"}}},
+			{Name: "Store", Files: []FileChange{file.withHunks(storeHunks)}},
+		}
+		linkDependencies(groups, mapReader(files))
+		return groups[0].DependsOn
+	}
+
+	if deps := link(file.Hunks[:1]); deps != nil {
+		t.Errorf("API depends on %+v, but Store only changed an unexported method", deps)
+	}
+	if deps := link(file.Hunks[1:]); deps != nil {
+		t.Errorf("API depends on %+v, but does not call Close", deps)
+	}
+	files["api/handler.go"] = "package api\n\nimport db \"example.com/shop/store\"\n\nfunc H(s *db.Store) { s.Close() }\n"
+	want := []GroupDependency{{Group: "Store", Packages: []string{"example.com/shop/store"}}}
+	if deps := link(file.Hunks[1:]); !reflect.DeepEqual(deps, want) {
+		t.Errorf("API depends on %+v, want %+v", deps, want)
+	}
+	// the whole file declares Store, which H's signature uses as db.Store
+	if deps := link(nil); !reflect.DeepEqual(deps, want) {
+		t.Errorf("API depends on %+v, want %+v", deps, want)
+	}
+}
+
+func TestWriteDependencyNotes(t *testing.T) {
+	var buf bytes.Buffer
+	writeDependencyNotes(&buf, []string{"Store", "API"}, nil)
+	if buf.Len() != 0 {
+		t.Errorf("notes without warnings: %q", buf.String())
+	}
+	writeDependencyNotes(&buf, []string{"Store", "API"}, []string{"API will not compile without Store (uses example.com/shop/store)"})
+	for _, want := range []string{"Review and merge in this order: Store → API", "⚠ API will not compile without Store"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("notes lack %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestExecutePlan_WarnsAboutGoDependencies(t *testing.T) {
+	dir := newTestRepo(t)
+	writeFile(t, dir, "go.mod", depsRepo["go.mod"])
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "module")
+	runGit(t, dir, "checkout", "-q", "-b", "feature")
+	for _, p := range []string{"store/store.go", "api/handler.go"} {
+		writeFile(t, dir, p, depsRepo[p])
+	}
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "feature")
+
+	files, err := getChangedFiles(diffOptions{Base: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups := orderByDependencies(groupByDirectory(files), changeReader(modeBranch, ""))
+	if groups[0].Name != "store" || groups[1].Name != "api" {
+		t.Fatalf("groups = %+v, want store before api", groups)
+	}
+	src, err := newSplitContext("feature", "main", modeBranch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	src.out = &out
+	src.enableDryRun()
+	if err := executePlan(newPlan(src, modeBranch, groups), files, src, "json"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "⚠ api will not compile without store (uses example.com/shop/store)"; !strings.Contains(out.String(), want) {
+		t.Errorf("output lacks %q:\n%s", want, out.String())
+	}
+}
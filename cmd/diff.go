@@ -0,0 +1,450 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	diffBase   string
+	diffBranch string
+	diffStat   bool
+)
+
+// childBranch is a child PR together with what its branch changes.
+type childBranch struct {
+	PR     ChildPR
+	Ref    string   // local or remote-tracking ref of the child branch
+	Files  []string // paths the child branch changes relative to the base
+	Merged bool
+	// Drift lists Files whose parent version changed after the split, i.e.
+	// the parent no longer matches what was reviewed in the child.
+	Drift []string
+	// Hunks holds, for files split by hunks between several children, the
+	// hunks of the file this child contains (see hunkKey).
+	Hunks map[string][]string
+
+	// treeHunks are the indexes of the hunks the split tree records for
+	// the files this child got part of.
+	treeHunks map[string][]int
+}
+
+// residualReport describes what is left to review in the parent once the
+// merged child PRs are taken out.
+type residualReport struct {
+	Parent    string
+	Base      string
+	MergeBase string
+	Children  []childBranch
+	// Residual are the parent's changes not covered by a merged child PR,
+	// plus files that drifted after their child was merged.
+	Residual []FileChange
+	// Unassigned are parent changes that no child PR (merged or not) contains.
+	Unassigned []FileChange
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show the parent diff not covered by merged child PRs",
+	Long: `Show what is left to review in the parent branch after child PRs merged.
+
+The parent-vs-base diff is reduced by every file that landed through a merged
+child PR. Files changed in the parent after the split (drift) stay in the
+residual diff, showing only the post-split changes, and files that were never
+assigned to any child PR are listed separately, so the final parent review
+only has to cover integration glue.
+
+Examples:
+  prki diff
+  prki diff --stat
+  prki diff --base develop`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		parent := diffBranch
+		if parent == "" {
+			var err error
+			if parent, err = getCurrentBranch(); err != nil {
+				return fmt.Errorf("failed to get current branch: %w", err)
+			}
+		}
+		prs, err := listChildPRs(parent, "all")
+		if err != nil {
+			return fmt.Errorf("could not fetch child PRs: %w", err)
+		}
+		report, err := computeResidual(parent, diffBase, prs)
+		if err != nil {
+			return err
+		}
+		printResidualReport(report)
+		if len(report.Residual) == 0 {
+			return nil
+		}
+		fmt.Println()
+		return showResidualDiff(report, diffStat)
+	},
+}
+
+// computeResidual works out the residual parent diff from git alone; prs only
+// supply the child PRs and their merge state. What each child contains is
+// taken from the split tree when there is one, so children whose branches
+// were deleted after merging still count; otherwise, or when the split
+// commit is not here, from the child branches.
+func computeResidual(parent, base string, prs []ChildPR) (*residualReport, error) {
+	base, err := resolveBase(base)
+	if err != nil {
+		return nil, err
+	}
+	mb, err := mergeBase(base, parent)
+	if err != nil {
+		return nil, err
+	}
+	files, err := getChangedFiles(diffOptions{Base: base, Branch: parent})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get changed files: %w", err)
+	}
+	tree, err := loadTree(parent)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &residualReport{Parent: parent, Base: base, MergeBase: mb}
+	children := map[string]int{} // path -> number of children changing it
+	for _, pr := range prs {
+		if strings.EqualFold(pr.State, "CLOSED") {
+			continue // closed without merging: never landed
+		}
+		c := childBranch{PR: pr, Merged: strings.EqualFold(pr.State, "MERGED")}
+		if tc := tree.child(pr); tc != nil && refExists(tree.SplitCommit) {
+			// the child's files are as in the split commit; its own commit
+			// may not be here if its branch was never fetched
+			c.Ref = tc.Commit
+			if c.Ref == "" || !refExists(c.Ref) {
+				c.Ref = tree.SplitCommit
+			}
+			c.Files = append(c.Files, tc.Files...)
+			for _, h := range tc.Hunks {
+				c.Files = append(c.Files, h.File)
+				if c.treeHunks == nil {
+					c.treeHunks = map[string][]int{}
+				}
+				c.treeHunks[h.File] = h.Hunks
+			}
+		} else {
+			ref := childRef(pr.HeadRefName)
+			if ref == "" {
+				fmt.Fprintf(os.Stderr, "  ⚠  branch %s of child PR #%d not found locally; run `git fetch`\n", pr.HeadRefName, pr.Number)
+				continue
+			}
+			c.Ref = ref
+			if c.Files, err = branchFiles(base, ref); err != nil {
+				return nil, err
+			}
+		}
+		for _, p := range c.Files {
+			children[p]++
+		}
+		report.Children = append(report.Children, c)
+	}
+
+	// A file split by hunks is compared hunk by hunk, as no child matches
+	// the parent. The split tree says which files were; without one, they
+	// are the files several children change.
+	split := func(c childBranch, p string) bool {
+		if c.treeHunks != nil {
+			_, ok := c.treeHunks[p]
+			return ok
+		}
+		return children[p] > 1
+	}
+	splitPaths := map[string]bool{}
+	for _, c := range report.Children {
+		for _, p := range c.Files {
+			splitPaths[p] = splitPaths[p] || split(c, p)
+		}
+	}
+	parentHunks := map[string][]string{}
+	for i := range files {
+		if f := &files[i]; splitPaths[f.Path] {
+			if f.Hunks, err = fileHunks(mb, parent, f.Path); err != nil {
+				return nil, err
+			}
+			parentHunks[f.Path] = hunkKeys(f.Hunks)
+		}
+	}
+	for i := range report.Children {
+		c := &report.Children[i]
+		var whole []string
+		for _, p := range c.Files {
+			if !split(*c, p) {
+				whole = append(whole, p)
+				continue
+			}
+			var hunks []Hunk
+			if indexes, ok := c.treeHunks[p]; ok {
+				hunks, err = treeHunks(tree, p, indexes)
+			} else {
+				hunks, err = fileHunks(mb, c.Ref, p)
+			}
+			if err != nil {
+				return nil, err
+			}
+			keys := hunkKeys(hunks)
+			if !containsAll(parentHunks[p], keys) {
+				c.Drift = append(c.Drift, p)
+				continue
+			}
+			if c.Hunks == nil {
+				c.Hunks = map[string][]string{}
+			}
+			c.Hunks[p] = keys
+		}
+		drift, err := driftedFiles(c.Ref, parent, whole)
+		if err != nil {
+			return nil, err
+		}
+		c.Drift = append(c.Drift, drift...)
+	}
+	report.Residual, report.Unassigned = classifyResidual(files, report.Children)
+	return report, nil
+}
+
+// treeHunks returns the hunks of path the split tree t gave a child, by
+// their indexes in the parent's diff at the time of the split.
+func treeHunks(t *splitTree, path string, indexes []int) ([]Hunk, error) {
+	all, err := fileHunks(t.MergeBase, t.SplitCommit, path)
+	if err != nil {
+		return nil, err
+	}
+	var hunks []Hunk
+	for _, h := range all {
+		if slices.Contains(indexes, h.Index) {
+			hunks = append(hunks, h)
+		}
+	}
+	return hunks, nil
+}
+
+// classifyResidual splits the parent's changes into what still needs review
+// in the parent and what was never assigned to any child.
+// A file split by hunks is reviewed once the merged children together
+// contain every hunk of it, which files must then carry.
+func classifyResidual(files []FileChange, children []childBranch) (residual, unassigned []FileChange) {
+	assigned := map[string]bool{}
+	reviewed := map[string]bool{}
+	mergedHunks := map[string][]string{}
+	for _, c := range children {
+		drift := map[string]bool{}
+		for _, p := range c.Drift {
+			drift[p] = true
+		}
+		for _, p := range c.Files {
+			assigned[p] = true
+			if _, partial := c.Hunks[p]; c.Merged && !drift[p] && !partial {
+				reviewed[p] = true
+			}
+		}
+		for p, keys := range c.Hunks {
+			if c.Merged {
+				mergedHunks[p] = append(mergedHunks[p], keys...)
+			}
+		}
+	}
+	for _, f := range files {
+		if keys, ok := mergedHunks[f.Path]; ok && len(f.Hunks) > 0 && containsAll(keys, hunkKeys(f.Hunks)) {
+			reviewed[f.Path] = true
+		}
+		if !reviewed[f.Path] {
+			residual = append(residual, f)
+		}
+		if !assigned[f.Path] {
+			unassigned = append(unassigned, f)
+		}
+	}
+	return residual, unassigned
+}
+
+// childRef prefers the remote-tracking branch, which reflects pushed fixups.
+func childRef(branch string) string {
+	if branch == "" {
+		return ""
+	}
+	for _, ref := range []string{"origin/" + branch, branch} {
+		if refExists(ref) {
+			return ref
+		}
+	}
+	return ""
+}
+
+// branchFiles lists the paths ref changes since it forked from base.
+func branchFiles(base, ref string) ([]string, error) {
+	mb, err := mergeBase(base, ref)
+	if err != nil {
+		return nil, err
+	}
+	out, err := gitOutput("diff", "--name-only", "-z", mb, ref)
+	if err != nil {
+		return nil, err
+	}
+	return splitNul(out), nil
+}
+
+// driftedFiles returns the paths whose content differs between the child
+// branch and the parent.
+func driftedFiles(childRef, parent string, paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	args := append([]string{"diff", "--name-only", "-z", childRef, parent, "--"}, paths...)
+	out, err := gitOutputEnv([]string{literalPathspecs}, args...)
+	if err != nil {
+		return nil, err
+	}
+	return splitNul(out), nil
+}
+
+// fileHunks returns the -U0 hunks of path between the commits from and to.
+func fileHunks(from, to, path string) ([]Hunk, error) {
+	args := append(append([]string{"diff", from, to}, hunkDiffArgs...), "--", path)
+	out, err := gitOutputEnv([]string{literalPathspecs}, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the hunks of %s: %w", path, err)
+	}
+	_, hunks := parseHunks(out)
+	return hunks, nil
+}
+
+// hunkKey identifies a hunk by what it does to the old version of its file,
+// which is the same whether it is diffed in the parent or in a child that
+// took only some of the file's hunks.
+func hunkKey(h Hunk) string {
+	return fmt.Sprintf("%d,%d\n%s", h.OldStart, h.OldLines, h.Body)
+}
+
+func hunkKeys(hunks []Hunk) []string {
+	keys := make([]string, len(hunks))
+	for i, h := range hunks {
+		keys[i] = hunkKey(h)
+	}
+	return keys
+}
+
+// containsAll reports whether every element of sub is in list.
+func containsAll(list, sub []string) bool {
+	for _, s := range sub {
+		if !contains(list, s) {
+			return false
+		}
+	}
+	return true
+}
+
+func printResidualReport(r *residualReport) {
+	fmt.Printf("Parent: %s (base %s)\n\n", r.Parent, r.Base)
+	if len(r.Children) == 0 {
+		fmt.Println("Child PRs: (none)")
+	} else {
+		fmt.Println("Child PRs:")
+		for i, c := range r.Children {
+			connector := "├─"
+			if i == len(r.Children)-1 {
+				connector = "└─"
+			}
+			state := "open"
+			if c.Merged {
+				state = "merged"
+			}
+			fmt.Printf("  %s #%d %s [%s, %d files]\n", connector, c.PR.Number, c.PR.HeadRefName, state, len(c.Files))
+		}
+	}
+
+	var drift []string
+	for _, c := range r.Children {
+		for _, p := range c.Drift {
+			drift = append(drift, fmt.Sprintf("%s (child #%d)", p, c.PR.Number))
+		}
+	}
+	if len(drift) > 0 {
+		sort.Strings(drift)
+		fmt.Println("\nChanged in the parent after the split:")
+		for _, d := range drift {
+			fmt.Printf("  ⚠ %s\n", d)
+		}
+	}
+
+	if len(r.Unassigned) > 0 {
+		fmt.Println("\nNever assigned to a child PR:")
+		for _, f := range r.Unassigned {
+			fmt.Printf("  • %s (+%d/-%d)\n", f.Path, f.LinesAdded, f.LinesDeleted)
+		}
+	}
+
+	total := 0
+	for _, f := range r.Residual {
+		total += f.TotalLines()
+	}
+	fmt.Printf("\nResidual parent diff: %d files, %d lines\n", len(r.Residual), total)
+}
+
+// showResidualDiff prints the residual diff. Drifted files of merged children
+// are diffed against the child branch, so only post-split changes show up.
+func showResidualDiff(r *residualReport, stat bool) error {
+	driftRef := map[string]string{}
+	for _, c := range r.Children {
+		if !c.Merged {
+			continue
+		}
+		for _, p := range c.Drift {
+			driftRef[p] = c.Ref
+		}
+	}
+
+	var plain []string
+	byRef := map[string][]string{}
+	for _, f := range r.Residual {
+		if ref, ok := driftRef[f.Path]; ok {
+			byRef[ref] = append(byRef[ref], f.Path)
+		} else {
+			plain = append(plain, f.Path)
+		}
+	}
+
+	format := "--patch"
+	if stat {
+		format = "--stat"
+	}
+	if len(plain) > 0 {
+		if err := gitToStdout(append([]string{"diff", format, r.MergeBase, r.Parent, "--"}, plain...)...); err != nil {
+			return err
+		}
+	}
+	refs := make([]string, 0, len(byRef))
+	for ref := range byRef {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	for _, ref := range refs {
+		if err := gitToStdout(append([]string{"diff", format, ref, r.Parent, "--"}, byRef[ref]...)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gitToStdout runs a git command with its output going straight to the
+// terminal. Paths after "--" are taken literally.
+func gitToStdout(args ...string) error {
+	return activeGit.Stream(os.Stdout, []string{literalPathspecs}, args...)
+}
+
+func init() {
+	diffCmd.Flags().StringVar(&diffBase, "base", "", "Base branch of the parent (default: origin's default branch)")
+	diffCmd.Flags().StringVar(&diffBranch, "branch", "", "Parent branch (default: current branch)")
+	diffCmd.Flags().BoolVar(&diffStat, "stat", false, "Show a diffstat instead of the full patch")
+
+	rootCmd.AddCommand(diffCmd)
+}
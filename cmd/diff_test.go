@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"io"
+	"slices"
+	"sort"
+	"testing"
+)
+
+func TestClassifyResidual(t *testing.T) {
+	files := []FileChange{{Path: "a.go"}, {Path: "b.go"}, {Path: "c.go"}, {Path: "wire.go"}}
+	children := []childBranch{
+		{Files: []string{"a.go"}, Merged: true},
+		{Files: []string{"b.go"}, Merged: false},
+		{Files: []string{"c.go"}, Merged: true, Drift: []string{"c.go"}},
+	}
+	residual, unassigned := classifyResidual(files, children)
+
+	if got := paths(residual); !equalStrings(got, []string{"b.go", "c.go", "wire.go"}) {
+		t.Errorf("residual = %v, want b.go (open child), c.go (drift), wire.go (unassigned)", got)
+	}
+	if got := paths(unassigned); !equalStrings(got, []string{"wire.go"}) {
+		t.Errorf("unassigned = %v, want [wire.go]", got)
+	}
+}
+
+func TestComputeResidual(t *testing.T) {
+	dir := newTestRepo(t)
+	runGit(t, dir, "checkout", "-q", "-b", "feature")
+	writeFile(t, dir, "a.go", "package a\n")
+	writeFile(t, dir, "b.go", "package b\n")
+	writeFile(t, dir, "wire.go", "package wire\n")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "feature work")
+
+	base := runGit(t, dir, "merge-base", "main", "feature")
+	for name, file := range map[string]string{"review/a": "a.go", "review/b": "b.go"} {
+		commit, err := activeGit.CommitTree(TreeCommit{Parent: base, Source: "feature", Paths: []string{file}, Message: "[Review] " + file})
+		if err != nil {
+			t.Fatal(err)
+		}
+		runGit(t, dir, "branch", name, commit)
+	}
+	runGit(t, dir, "merge", "-q", "--no-edit", "review/a")
+
+	prs := []ChildPR{
+		{Number: 1, HeadRefName: "review/a", State: "MERGED"},
+		{Number: 2, HeadRefName: "review/b", State: "OPEN"},
+		{Number: 3, HeadRefName: "review/gone", State: "CLOSED"},
+	}
+
+	report, err := computeResidual("feature", "main", prs)
+	if err != nil {
+		t.Fatalf("computeResidual: %v", err)
+	}
+	if len(report.Children) != 2 {
+		t.Fatalf("children = %+v, want the merged and the open one", report.Children)
+	}
+	if got := paths(report.Residual); !equalStrings(got, []string{"b.go", "wire.go"}) {
+		t.Errorf("residual = %v, want [b.go wire.go]", got)
+	}
+	if got := paths(report.Unassigned); !equalStrings(got, []string{"wire.go"}) {
+		t.Errorf("unassigned = %v, want [wire.go]", got)
+	}
+
+	// a.go changes in the parent after its child merged
+	writeFile(t, dir, "a.go", "package a\n\nvar late = true\n")
+	runGit(t, dir, "commit", "-q", "-am", "late change")
+
+	report, err = computeResidual("feature", "main", prs)
+	if err != nil {
+		t.Fatalf("computeResidual: %v", err)
+	}
+	if got := report.Children[0].Drift; !equalStrings(got, []string{"a.go"}) {
+		t.Errorf("drift = %v, want [a.go]", got)
+	}
+	if got := paths(report.Residual); !equalStrings(got, []string{"a.go", "b.go", "wire.go"}) {
+		t.Errorf("residual = %v, want a.go back in", got)
+	}
+}
+
+func TestComputeResidual_HunkSplit(t *testing.T) {
+	dir := newTestRepo(t)
+	writeFile(t, dir, "a.go", "package a\n\nfunc b() {}\n\nfunc c() {}\n")
+	runGit(t, dir, "add", "a.go")
+	runGit(t, dir, "commit", "-q", "-m", "a.go")
+	runGit(t, dir, "checkout", "-q", "-b", "feature")
+	writeFile(t, dir, "a.go", "package a\n\n// b does b.\nfunc b() {}\n\nfunc c() {}\n\nfunc d() {}\n")
+	runGit(t, dir, "commit", "-q", "-am", "feature work")
+
+	files, err := getChangedFiles(diffOptions{Base: "main", Hunks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || len(files[0].Hunks) != 2 {
+		t.Fatalf("changed files = %+v, want a.go with 2 hunks", files)
+	}
+	base := runGit(t, dir, "merge-base", "main", "feature")
+	for i, name := range []string{"review/1", "review/2"} {
+		part := files[0].withHunks(files[0].Hunks[i : i+1])
+		commit, err := activeGit.CommitTree(TreeCommit{Parent: base, Source: "feature", Patch: hunkPatch(part), Message: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		runGit(t, dir, "branch", name, commit)
+	}
+	prs := []ChildPR{{Number: 1, HeadRefName: "review/1", State: "MERGED"}, {Number: 2, HeadRefName: "review/2", State: "OPEN"}}
+
+	report, err := computeResidual("feature", "main", prs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range report.Children {
+		if len(c.Drift) != 0 {
+			t.Errorf("child #%d drift = %v, want none", c.PR.Number, c.Drift)
+		}
+	}
+	if got := paths(report.Residual); !equalStrings(got, []string{"a.go"}) {
+		t.Errorf("residual with one child open = %v, want [a.go]", got)
+	}
+
+	prs[1].State = "MERGED"
+	if report, err = computeResidual("feature", "main", prs); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Residual) != 0 || len(report.Unassigned) != 0 {
+		t.Errorf("residual = %v, unassigned = %v after every child merged", paths(report.Residual), paths(report.Unassigned))
+	}
+
+	// a hunk of the child that the parent no longer has is drift
+	writeFile(t, dir, "a.go", "package a\n\n// b does B.\nfunc b() {}\n\nfunc c() {}\n\nfunc d() {}\n")
+	runGit(t, dir, "commit", "-q", "-am", "late change")
+	if report, err = computeResidual("feature", "main", prs); err != nil {
+		t.Fatal(err)
+	}
+	if got := report.Children[0].Drift; !equalStrings(got, []string{"a.go"}) {
+		t.Errorf("drift of #1 = %v, want [a.go]", got)
+	}
+	if got := report.Children[1].Drift; len(got) != 0 {
+		t.Errorf("drift of #2 = %v, want none", got)
+	}
+	if got := paths(report.Residual); !equalStrings(got, []string{"a.go"}) {
+		t.Errorf("residual after the late change = %v, want [a.go]", got)
+	}
+}
+
+func TestComputeResidual_FromSplitTree(t *testing.T) {
+	dir := newTestRepo(t)
+	writeFile(t, dir, "a.go", "package a\n\nfunc b() {}\n\nfunc c() {}\n")
+	runGit(t, dir, "add", "a.go")
+	runGit(t, dir, "commit", "-q", "-m", "a.go")
+	runGit(t, dir, "checkout", "-q", "-b", "feature")
+	writeFile(t, dir, "a.go", "package a\n\n// b does b.\nfunc b() {}\n\nfunc c() {}\n\nfunc d() {}\n")
+	writeFile(t, dir, "b.go", "package a\n")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "feature work")
+
+	files, err := getChangedFiles(diffOptions{Base: "main", Hunks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := files[slices.IndexFunc(files, func(f FileChange) bool { return f.Path == "a.go" })]
+	base := runGit(t, dir, "merge-base", "main", "feature")
+	head := runGit(t, dir, "rev-parse", "feature")
+	// the child branches are gone, as after a forge deleted them on merge
+	commit := func(paths []string, part FileChange) string {
+		c, err := activeGit.CommitTree(TreeCommit{Parent: base, Source: "feature", Paths: paths, Patch: hunkPatch(part), Message: "child"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	tree := &splitTree{Version: treeVersion, Parent: "feature", Base: "main", MergeBase: base, SplitCommit: head, Children: []treeChild{
+		{Group: "Refactoring", Order: 1, Branch: "review/1", PR: 1, Commit: commit(nil, a.withHunks(a.Hunks[:1])),
+			Files: []string{}, Hunks: []PlanHunks{{File: "a.go", Hunks: []int{1}}}},
+		{Group: "Core", Order: 2, Branch: "review/2", PR: 2, Commit: commit([]string{"b.go"}, a.withHunks(a.Hunks[1:])),
+			Files: []string{"b.go"}, Hunks: []PlanHunks{{File: "a.go", Hunks: []int{2}}}},
+	}}
+	if err := saveTree(splitContext{parentBranch: "feature", out: io.Discard}, tree); err != nil {
+		t.Fatal(err)
+	}
+	prs := []ChildPR{{Number: 1, HeadRefName: "review/1", State: "MERGED"}, {Number: 2, HeadRefName: "review/2", State: "MERGED"}}
+
+	report, err := computeResidual("feature", "main", prs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Children) != 2 {
+		t.Fatalf("children = %+v, want both from the tree", report.Children)
+	}
+	if len(report.Residual) != 0 || len(report.Unassigned) != 0 {
+		t.Errorf("residual = %v, unassigned = %v after every child merged", paths(report.Residual), paths(report.Unassigned))
+	}
+
+	prs[0].State = "OPEN"
+	if report, err = computeResidual("feature", "main", prs); err != nil {
+		t.Fatal(err)
+	}
+	if got := paths(report.Residual); !equalStrings(got, []string{"a.go"}) {
+		t.Errorf("residual with #1 open = %v, want [a.go]", got)
+	}
+
+	prs[0].State = "MERGED"
+	writeFile(t, dir, "b.go", "package a\n\nvar late = true\n")
+	runGit(t, dir, "commit", "-q", "-am", "late change")
+	if report, err = computeResidual("feature", "main", prs); err != nil {
+		t.Fatal(err)
+	}
+	if got := report.Children[1].Drift; !equalStrings(got, []string{"b.go"}) {
+		t.Errorf("drift of #2 = %v, want [b.go]", got)
+	}
+	if got := paths(report.Residual); !equalStrings(got, []string{"b.go"}) {
+		t.Errorf("residual after the late change = %v, want [b.go]", got)
+	}
+}
+
+func paths(files []FileChange) []string {
+	var ps []string
+	for _, f := range files {
+		ps = append(ps, f.Path)
+	}
+	sort.Strings(ps)
+	return ps
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
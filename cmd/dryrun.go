@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// commandRecorder stands in for git and the forge CLI in dry-run mode. It prints every
+// command instead of running it and hands out placeholders such as <tree-1>
+// for the objects a command would have created, so later commands can refer
+// to them.
+type commandRecorder struct {
+	out  io.Writer
+	seen map[string]int
+}
+
+func newCommandRecorder(out io.Writer) *commandRecorder {
+	return &commandRecorder{out: out, seen: map[string]int{}}
+}
+
+// git records a git command. It is a gitFunc.
+func (r *commandRecorder) git(env []string, args ...string) (string, error) {
+	r.print(env, "git", args)
+	switch gitSubcommand(args) {
+	case "hash-object":
+		return r.placeholder("blob"), nil
+	case "write-tree":
+		return r.placeholder("tree"), nil
+	case "commit-tree":
+		return r.placeholder("commit"), nil
+	}
+	return "", nil
+}
+
+// repo returns the Git of a dry run: it reads the repository through
+// activeGit, but only records the commands that would change it.
+func (r *commandRecorder) repo() Git {
+	return dryRunGit{Git: activeGit, changes: cliGit{run: r.git}}
+}
+
+// dryRunGit is the Git commandRecorder.repo returns.
+type dryRunGit struct {
+	Git
+	changes cliGit
+}
+
+func (g dryRunGit) CreateBranch(branch, commit string) error {
+	return g.changes.CreateBranch(branch, commit)
+}
+
+func (g dryRunGit) DeleteBranch(branch string) error {
+	return g.changes.DeleteBranch(branch)
+}
+
+func (g dryRunGit) Checkout(rev string) error {
+	return g.changes.Checkout(rev)
+}
+
+func (g dryRunGit) Fetch(branch string) error {
+	return g.changes.Fetch(branch)
+}
+
+func (g dryRunGit) FastForward(rev string) error {
+	return g.changes.FastForward(rev)
+}
+
+func (g dryRunGit) CommitTree(c TreeCommit) (string, error) {
+	return g.changes.CommitTree(c)
+}
+
+func (g dryRunGit) UpdateRef(ref, commit, old string) error {
+	return g.changes.UpdateRef(ref, commit, old)
+}
+
+func (g dryRunGit) Push(ref, from, lease string) error {
+	return g.changes.Push(ref, from, lease)
+}
+
+// command records a command of another tool, such as gh.
+func (r *commandRecorder) command(name string, args ...string) (string, error) {
+	r.print(nil, name, args)
+	return "", nil
+}
+
+func (r *commandRecorder) placeholder(kind string) string {
+	r.seen[kind]++
+	return fmt.Sprintf("<%s-%d>", kind, r.seen[kind])
+}
+
+func (r *commandRecorder) print(env []string, name string, args []string) {
+	words := append(append(append([]string{}, env...), name), args...)
+	for i, w := range words {
+		words[i] = shellQuote(w)
+	}
+	fmt.Fprintf(r.out, "    $ %s\n", strings.Join(words, " "))
+}
+
+// gitSubcommand skips global options such as -C <dir>.
+func gitSubcommand(args []string) string {
+	if cmd := withoutGlobalOptions(args); len(cmd) > 0 {
+		return cmd[0]
+	}
+	return ""
+}
+
+// withoutGlobalOptions drops the options before the git subcommand.
+func withoutGlobalOptions(args []string) []string {
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "-C" || args[i] == "-c":
+			i++
+		case !strings.HasPrefix(args[i], "-"):
+			return args[i:]
+		}
+	}
+	return nil
+}
+
+var (
+	shellSafe   = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+	placeholder = regexp.MustCompile(`^<[a-z]+-\d+>$`)
+)
+
+// shellQuote quotes s for a POSIX shell, leaving simple words and
+// placeholders as they are.
+func shellQuote(s string) string {
+	if shellSafe.MatchString(s) || placeholder.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
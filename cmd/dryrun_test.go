@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"review/core-business-logic", "review/core-business-logic"},
+		{"GIT_INDEX_FILE=/tmp/x/index", "GIT_INDEX_FILE=/tmp/x/index"},
+		{"<commit-1>", "<commit-1>"},
+		{"[Review] Core", "'[Review] Core'"},
+		{"it's", `'it'\''s'`},
+		{"", "''"},
+		{"a\nb", "'a\nb'"},
+	}
+	for _, tt := range tests {
+		if got := shellQuote(tt.input); got != tt.want {
+			t.Errorf("shellQuote(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestGitSubcommand(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"write-tree"}, "write-tree"},
+		{[]string{"-C", "/repo", "add", "-A"}, "add"},
+		{[]string{"-c", "core.x=y", "commit-tree", "t"}, "commit-tree"},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := gitSubcommand(tt.args); got != tt.want {
+			t.Errorf("gitSubcommand(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestCommandRecorder_Placeholders(t *testing.T) {
+	var buf bytes.Buffer
+	r := newCommandRecorder(&buf)
+	tree, _ := r.git([]string{"GIT_INDEX_FILE=/tmp/i"}, "write-tree")
+	commit, _ := r.git(nil, "commit-tree", tree, "-p", "HEAD", "-m", "[Review] A")
+	tree2, _ := r.git(nil, "write-tree")
+	if tree != "<tree-1>" || commit != "<commit-1>" || tree2 != "<tree-2>" {
+		t.Errorf("placeholders = %s %s %s", tree, commit, tree2)
+	}
+	if out, _ := r.git(nil, "push", "-u", "origin", "review/a"); out != "" {
+		t.Errorf("push output = %q", out)
+	}
+
+	want := `    $ GIT_INDEX_FILE=/tmp/i git write-tree
+    $ git commit-tree <tree-1> -p HEAD -m '[Review] A'
+    $ git write-tree
+    $ git push -u origin review/a
+`
+	if buf.String() != want {
+		t.Errorf("recorded:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestExecutePlan_DryRunChangesNothing(t *testing.T) {
+	dir := newTestRepo(t)
+	runGit(t, dir, "checkout", "-q", "-b", "feature")
+	writeFile(t, dir, "edited.go", "package a\n\nfunc f() {}\n")
+	writeFile(t, dir, "README.md", "# a\n")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "feature")
+	branchesBefore := runGit(t, dir, "branch", "--list")
+	objectsBefore := runGit(t, dir, "count-objects")
+
+	files, err := getChangedFiles(diffOptions{Base: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := newSplitContext("feature", "main", modeBranch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	src.out = &out
+	src.enableDryRun()
+	if err := executePlan(newPlan(src, modeBranch, groupBySemantic(files)), files, src, "json"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := runGit(t, dir, "branch", "--list"); got != branchesBefore {
+		t.Errorf("branches changed:\n%s", got)
+	}
+	if got := runGit(t, dir, "count-objects"); got != objectsBefore {
+		t.Errorf("objects written: %s -> %s", objectsBefore, got)
+	}
+	for _, want := range []string{
+		"git read-tree " + src.base,
+		"git reset -q feature -- edited.go",
+		"$ git commit-tree <tree-1> -p " + src.base + " -m '[Review] Core Business Logic'",
+		"$ git branch review/core-business-logic <commit-1>",
+		"$ git push --quiet -u origin review/documentation",
+		"$ gh pr create --base feature --head review/documentation --title '[Review] Documentation' --body '## Review Purpose",
+		"- `README.md` (+1/-0 lines)",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output lacks %q:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package cmd
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// End-to-end tests: the commands run against a repository whose origin is
+// a fakeForge, with no network and no gh.
+
+// newFeatureBranch commits a feature branch touching config, code, tests and
+// docs on top of main, pushes it and leaves it checked out.
+func newFeatureBranch(t *testing.T, dir string) {
+	t.Helper()
+	runGit(t, dir, "checkout", "-q", "-b", "feature")
+	writeFile(t, dir, "config.yaml", "retries: 3\n")
+	writeFile(t, dir, "store.go", "package a\n\nfunc Save(k string) error {\n\tif k == \"\" {\n\t\treturn nil\n\t}\n\treturn nil\n}\n")
+	writeFile(t, dir, "store_test.go", "package a\n\nimport \"testing\"\n\nfunc TestSave(t *testing.T) {}\n")
+	writeFile(t, dir, "README.md", "# a\n\nStores things.\n")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "feature")
+	runGit(t, dir, "push", "-q", "-u", "origin", "feature")
+}
+
+// splitFeature runs prki split --auto on the checked out branch.
+func splitFeature(t *testing.T) string {
+	t.Helper()
+	setFlag(t, &splitAuto, true)
+	setFlag(t, &splitReviewers, "alice,owner/core")
+	out, err := captureStdout(t, func() error { return runSplit(splitCmd, nil) })
+	if err != nil {
+		t.Fatalf("split: %v\n%s", err, out)
+	}
+	return out
+}
+
+var featureChildren = map[string][]string{
+	"review/infrastructure-config": {"config.yaml"},
+	"review/core-business-logic":   {"store.go"},
+	"review/tests":                 {"store_test.go"},
+	"review/documentation":         {"README.md"},
+}
+
+func TestE2E_SplitStatusMerge(t *testing.T) {
+	f, dir := newForgeTestRepo(t)
+	newFeatureBranch(t, dir)
+
+	out := splitFeature(t)
+	prs := f.pulls()
+	if len(prs) != len(featureChildren) {
+		t.Fatalf("split opened %d PRs, want %d:\n%s", len(prs), len(featureChildren), out)
+	}
+	for _, pr := range prs {
+		want, ok := featureChildren[pr.Head]
+		if !ok {
+			t.Errorf("unexpected child PR #%d from %s", pr.Number, pr.Head)
+			continue
+		}
+		if pr.Base != "feature" || !pr.Draft || pr.State != "OPEN" {
+			t.Errorf("#%d: base %s, draft %v, state %s", pr.Number, pr.Base, pr.Draft, pr.State)
+		}
+		if !reflect.DeepEqual(pr.Reviewers, []string{"alice", "owner/core"}) {
+			t.Errorf("#%d: reviewers %v", pr.Number, pr.Reviewers)
+		}
+		// the pushed child branch holds exactly its group's files
+		if got := strings.Fields(runGit(t, f.bare, "diff", "--name-only", "main", pr.Head)); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s changes %v, want %v", pr.Head, got, want)
+		}
+	}
+
+	f.review(1, "APPROVED")
+	f.review(2, "APPROVED")
+	f.review(3, "APPROVED", CheckStatus{Name: "build", Status: "IN_PROGRESS"})
+	f.review(4, "CHANGES_REQUESTED")
+
+	setFlag(t, &statusOutput, "json")
+	out, err := captureStdout(t, func() error { return statusCmd.RunE(statusCmd, nil) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status statusReport
+	if err := json.Unmarshal([]byte(out), &status); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if status.ChildPRError != "" || len(status.ChildPRs) != 4 {
+		t.Fatalf("status: %s", out)
+	}
+	if !reflect.DeepEqual(status.NextActions.Merge, []int{1, 2, 3}) || !reflect.DeepEqual(status.NextActions.Fix, []int{4}) {
+		t.Errorf("next actions = %+v", status.NextActions)
+	}
+
+	setFlag(t, &mergeAuto, true)
+	setFlag(t, &mergeMethod, "squash")
+	out, err = captureStdout(t, func() error { return runMerge(mergeCmd, nil) })
+	if err != nil {
+		t.Fatalf("merge: %v\n%s", err, out)
+	}
+	for _, want := range []string{"(skipped: checks pending)", "(skipped: waits for #3)", "2 child PR(s) merged into feature."} {
+		if !strings.Contains(out, want) {
+			t.Errorf("merge output does not contain %q:\n%s", want, out)
+		}
+	}
+	var states []string
+	for _, pr := range f.pulls() {
+		states = append(states, pr.State)
+	}
+	if want := []string{"MERGED", "MERGED", "OPEN", "OPEN"}; !reflect.DeepEqual(states, want) {
+		t.Errorf("PR states after merge = %v, want %v", states, want)
+	}
+	// the local parent was fast-forwarded to the merges
+	if local, remote := runGit(t, dir, "rev-parse", "feature"), runGit(t, f.bare, "rev-parse", "feature"); local != remote {
+		t.Errorf("local feature %s, origin feature %s", local, remote)
+	}
+}
+
+// childPRNumbers runs prki status --output json and returns the numbers of
+// the child PRs it lists.
+func childPRNumbers(t *testing.T) []int {
+	t.Helper()
+	setFlag(t, &statusOutput, "json")
+	out, err := captureStdout(t, func() error { return statusCmd.RunE(statusCmd, nil) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status statusReport
+	if err := json.Unmarshal([]byte(out), &status); err != nil || status.ChildPRError != "" {
+		t.Fatalf("status: %v\n%s", err, out)
+	}
+	var numbers []int
+	for _, pr := range status.ChildPRs {
+		numbers = append(numbers, pr.Number)
+	}
+	return numbers
+}
+
+func TestE2E_SplitTree(t *testing.T) {
+	f, dir := newForgeTestRepo(t)
+	newFeatureBranch(t, dir)
+	splitFeature(t)
+
+	ref := treeRef("feature")
+	if local, remote := runGit(t, dir, "rev-parse", ref), runGit(t, f.bare, "rev-parse", ref); local != remote {
+		t.Fatalf("%s: local %s, origin %s", ref, local, remote)
+	}
+
+	// the tree, not the PR bases, says which PRs are children of feature
+	f.retarget(2, "main")
+	runGit(t, dir, "checkout", "-q", "-b", "hotfix")
+	writeFile(t, dir, "hotfix.txt", "fix\n")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "hotfix")
+	runGit(t, dir, "push", "-q", "origin", "hotfix")
+	runGit(t, dir, "checkout", "-q", "feature")
+	f.openPR(t, "feature", "hotfix", "Hotfix")
+	if got := childPRNumbers(t); !reflect.DeepEqual(got, []int{1, 2, 3, 4}) {
+		t.Errorf("child PRs = %v, want [1 2 3 4]", got)
+	}
+
+	// a fresh clone gets the tree from origin
+	clone := t.TempDir()
+	runGit(t, clone, "clone", "-q", "-b", "feature", f.url+"/owner/repo.git", ".")
+	t.Chdir(clone)
+	if got := childPRNumbers(t); !reflect.DeepEqual(got, []int{1, 2, 3, 4}) {
+		t.Errorf("child PRs in a fresh clone = %v, want [1 2 3 4]", got)
+	}
+	if got := runGit(t, clone, "rev-parse", ref); got != runGit(t, f.bare, "rev-parse", ref) {
+		t.Errorf("clone did not fetch %s", ref)
+	}
+}
+
+func TestE2E_SplitRollback(t *testing.T) {
+	f, dir := newForgeTestRepo(t)
+	newFeatureBranch(t, dir)
+	splitFeature(t)
+
+	setFlag(t, &splitRollback, true)
+	if out, err := captureStdout(t, func() error { return runSplit(splitCmd, nil) }); err != nil {
+		t.Fatalf("rollback: %v\n%s", err, out)
+	}
+	for _, pr := range f.pulls() {
+		if pr.State != "CLOSED" || len(pr.Comments) != 1 || !strings.Contains(pr.Comments[0], "prki split --rollback") {
+			t.Errorf("#%d after rollback: state %s, comments %q", pr.Number, pr.State, pr.Comments)
+		}
+	}
+	if got := f.branches(t); !reflect.DeepEqual(got, []string{"feature", "main"}) {
+		t.Errorf("origin branches after rollback: %v", got)
+	}
+	if got := runGit(t, f.bare, "for-each-ref", "refs/prki/"); got != "" {
+		t.Errorf("origin split tree after rollback: %s", got)
+	}
+	if got := runGit(t, dir, "branch", "--list", "review/*"); got != "" {
+		t.Errorf("local branches after rollback: %q", got)
+	}
+}
+
+func TestE2E_SplitFailureRollsBack(t *testing.T) {
+	f, dir := newForgeTestRepo(t)
+	newFeatureBranch(t, dir)
+	runGit(t, dir, "branch", "review/documentation", "main") // the last child branch cannot be created
+
+	setFlag(t, &splitAuto, true)
+	if out, err := captureStdout(t, func() error { return runSplit(splitCmd, nil) }); err == nil {
+		t.Fatalf("split should fail:\n%s", out)
+	}
+	prs := f.pulls()
+	if len(prs) != 3 {
+		t.Fatalf("split opened %d PRs before failing, want 3", len(prs))
+	}
+	for _, pr := range prs {
+		if pr.State != "CLOSED" || !reflect.DeepEqual(pr.Comments, []string{closedBySplitFailure}) {
+			t.Errorf("#%d after the failed split: state %s, comments %q", pr.Number, pr.State, pr.Comments)
+		}
+	}
+}
+
+func TestE2E_SplitHunksIntoOnePart(t *testing.T) {
+	f, dir := newForgeTestRepo(t)
+	writeFile(t, dir, "a.go", "package a\n\nfunc b() {\n\tprintln(1)\n}\n")
+	runGit(t, dir, "add", "a.go")
+	runGit(t, dir, "commit", "-q", "-m", "a")
+	runGit(t, dir, "push", "-q", "origin", "main")
+	runGit(t, dir, "checkout", "-q", "-b", "feature")
+	// hunk 1 rewrites b (Refactoring), hunk 2 adds c (Core Business Logic)
+	writeFile(t, dir, "a.go", "package a\n\nfunc b() {\n\tprintln(2)\n\tprintln(3)\n\tprintln(4)\n}\n\nfunc c() {}\n")
+	runGit(t, dir, "commit", "-q", "-am", "feature")
+	runGit(t, dir, "push", "-q", "-u", "origin", "feature")
+
+	setFlag(t, &splitStrategy, "hunk")
+	setFlag(t, &splitParts, 1)
+	splitFeature(t)
+	prs := f.pulls()
+	if len(prs) != 1 {
+		t.Fatalf("split opened %d PRs, want 1", len(prs))
+	}
+	if got, want := runGit(t, dir, "show", prs[0].Head+":a.go"), runGit(t, dir, "show", "feature:a.go"); got != want {
+		t.Errorf("%s has a.go =\n%s\nwant\n%s", prs[0].Head, got, want)
+	}
+}
+
+func TestE2E_SplitDryRun(t *testing.T) {
+	f, dir := newForgeTestRepo(t)
+	newFeatureBranch(t, dir)
+
+	setFlag(t, &splitDryRun, true)
+	out := splitFeature(t)
+	if !strings.Contains(out, "$ gh pr create --base feature --head review/tests") {
+		t.Errorf("dry run did not print the PR it would create:\n%s", out)
+	}
+	if prs := f.pulls(); len(prs) != 0 {
+		t.Errorf("dry run opened %d PRs", len(prs))
+	}
+	if got := f.branches(t); !reflect.DeepEqual(got, []string{"feature", "main"}) {
+		t.Errorf("dry run pushed branches: %v", got)
+	}
+}
+
+func TestE2E_AnalyzePR(t *testing.T) {
+	f, dir := newForgeTestRepo(t)
+	newFeatureBranch(t, dir)
+	// only the forge has the PR's commits
+	runGit(t, dir, "checkout", "-q", "main")
+	runGit(t, dir, "branch", "-q", "-D", "feature")
+	n := f.openPR(t, "main", "feature", "Feature")
+
+	setFlag(t, &analyzePR, n)
+	setFlag(t, &analyzeOutput, "json")
+	out, err := captureStdout(t, func() error { return analyzeCmd.RunE(analyzeCmd, nil) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report analysisReport
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	var branches []string
+	for _, g := range report.Groups {
+		branches = append(branches, g.Branch)
+	}
+	if report.TotalFiles != 4 || len(branches) != len(featureChildren) {
+		t.Errorf("analyze --pr %d: %d files, groups %v", n, report.TotalFiles, branches)
+	}
+
+	setFlag(t, &analyzePR, 99)
+	_, err = captureStdout(t, func() error { return analyzeCmd.RunE(analyzeCmd, nil) })
+	if err == nil || !strings.Contains(err.Error(), "pull request #99 not found") {
+		t.Errorf("analyze --pr 99: %v", err)
+	}
+}
@@ -0,0 +1,440 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeForge is a GitHub stand-in for end-to-end tests. It serves
+// owner/repo over git's smart HTTP protocol, so prki pushes and fetches as
+// usual, and implements the REST and GraphQL endpoints githubAPI uses under
+// /api, GitHub Enterprise style.
+type fakeForge struct {
+	url  string
+	bare string // the repository behind owner/repo.git
+
+	mu  sync.Mutex
+	prs []*fakePR
+}
+
+// fakePR is a pull request on a fakeForge.
+type fakePR struct {
+	Number         int
+	Title          string
+	Body           string
+	Base           string
+	Head           string
+	Draft          bool
+	State          string // OPEN, CLOSED or MERGED
+	Labels         []string
+	Reviewers      []string
+	Comments       []string
+	ReviewDecision string
+	Checks         []CheckStatus
+}
+
+// newFakeForge starts a fakeForge with an empty owner/repo.
+func newFakeForge(t *testing.T) *fakeForge {
+	t.Helper()
+	gitBin, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git not found")
+	}
+	root := t.TempDir()
+	f := &fakeForge{bare: filepath.Join(root, "owner", "repo.git")}
+	runGit(t, root, "init", "-q", "--bare", "-b", "main", f.bare)
+	runGit(t, f.bare, "config", "http.receivepack", "true")
+
+	const repo = "/api/v3/repos/owner/repo"
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+repo+"/pulls", f.createPR)
+	mux.HandleFunc("GET "+repo+"/pulls", f.listPRs)
+	mux.HandleFunc("GET "+repo+"/pulls/{n}", f.withPR(f.getPR))
+	mux.HandleFunc("PATCH "+repo+"/pulls/{n}", f.withPR(f.updatePR))
+	mux.HandleFunc("PUT "+repo+"/pulls/{n}/merge", f.withPR(f.mergePR))
+	mux.HandleFunc("POST "+repo+"/pulls/{n}/requested_reviewers", f.withPR(f.requestReviewers))
+	mux.HandleFunc("POST "+repo+"/issues/{n}/labels", f.withPR(f.addLabels))
+	mux.HandleFunc("POST "+repo+"/issues/{n}/comments", f.withPR(f.comment))
+	mux.HandleFunc("POST /api/graphql", f.graphql)
+	mux.Handle("/", &cgi.Handler{
+		Path: gitBin,
+		Args: []string{"http-backend"},
+		Env:  []string{"GIT_PROJECT_ROOT=" + root, "GIT_HTTP_EXPORT_ALL=1"},
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	f.url = srv.URL
+	return f
+}
+
+// newForgeTestRepo is newTestRepo with a fakeForge as origin, reached
+// through githubAPI with a token.
+func newForgeTestRepo(t *testing.T) (*fakeForge, string) {
+	t.Helper()
+	f := newFakeForge(t)
+	dir := newTestRepo(t)
+	clearGitHubEnv(t)
+	t.Setenv("GITHUB_TOKEN", "test-token")
+	t.Setenv("GITHUB_API_URL", f.url+"/api/v3")
+	t.Setenv("GIT_TERMINAL_PROMPT", "0")
+	runGit(t, dir, "remote", "add", "origin", f.url+"/owner/repo.git")
+	runGit(t, dir, "push", "-q", "origin", "main")
+	runGit(t, dir, "remote", "set-head", "origin", "main")
+	return f, dir
+}
+
+// openPR opens a PR on the forge directly, as someone else would.
+func (f *fakeForge) openPR(t *testing.T, base, head, title string) int {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	pr, status, msg := f.open(base, head, title, "", false)
+	if pr == nil {
+		t.Fatalf("open PR %s <- %s: %d %s", base, head, status, msg)
+	}
+	return pr.Number
+}
+
+// pulls returns copies of all PRs, by number.
+func (f *fakeForge) pulls() []fakePR {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	prs := make([]fakePR, len(f.prs))
+	for i, pr := range f.prs {
+		prs[i] = *pr
+	}
+	return prs
+}
+
+// review sets the review decision and checks of PR n.
+func (f *fakeForge) review(n int, decision string, checks ...CheckStatus) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.prs[n-1].ReviewDecision = decision
+	f.prs[n-1].Checks = checks
+}
+
+// retarget changes the base branch of PR n, as editing it on the forge would.
+func (f *fakeForge) retarget(n int, base string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.prs[n-1].Base = base
+}
+
+// branches lists the branches of the forge's repository.
+func (f *fakeForge) branches(t *testing.T) []string {
+	t.Helper()
+	out := runGit(t, f.bare, "for-each-ref", "--format=%(refname:short)", "refs/heads")
+	return strings.Fields(out)
+}
+
+// git runs git in the forge's repository.
+func (f *fakeForge) git(args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", f.bare}, args...)...)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=fake forge", "GIT_AUTHOR_EMAIL=forge@example.com",
+		"GIT_COMMITTER_NAME=fake forge", "GIT_COMMITTER_EMAIL=forge@example.com",
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, stderr.String())
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// open creates a PR; the caller holds f.mu. On failure it returns the
+// status and message GitHub would.
+func (f *fakeForge) open(base, head, title, body string, draft bool) (*fakePR, int, string) {
+	for _, ref := range []string{base, head} {
+		if _, err := f.git("rev-parse", "--verify", "--quiet", "refs/heads/"+ref); err != nil {
+			return nil, http.StatusUnprocessableEntity, "Validation Failed: branch " + ref + " not found"
+		}
+	}
+	for _, pr := range f.prs {
+		if pr.Head == head && pr.State == "OPEN" {
+			return nil, http.StatusUnprocessableEntity, "Validation Failed: A pull request already exists for owner:" + head + "."
+		}
+	}
+	pr := &fakePR{Number: len(f.prs) + 1, Title: title, Body: body, Base: base, Head: head, Draft: draft, State: "OPEN", ReviewDecision: "REVIEW_REQUIRED"}
+	if _, err := f.git("update-ref", fmt.Sprintf("refs/pull/%d/head", pr.Number), "refs/heads/"+head); err != nil {
+		return nil, http.StatusInternalServerError, err.Error()
+	}
+	f.prs = append(f.prs, pr)
+	return pr, http.StatusCreated, ""
+}
+
+// mergeTree merges head into base without touching any ref, and returns
+// the resulting tree, or false when they conflict.
+func (f *fakeForge) mergeTree(base, head string) (string, bool) {
+	tree, err := f.git("merge-tree", "--write-tree", "refs/heads/"+base, "refs/heads/"+head)
+	if err != nil {
+		return "", false
+	}
+	return strings.Fields(tree)[0], true
+}
+
+func (f *fakeForge) restPR(pr *fakePR) map[string]any {
+	state := "open"
+	if pr.State != "OPEN" {
+		state = "closed"
+	}
+	return map[string]any{
+		"number":   pr.Number,
+		"title":    pr.Title,
+		"body":     pr.Body,
+		"draft":    pr.Draft,
+		"state":    state,
+		"merged":   pr.State == "MERGED",
+		"html_url": fmt.Sprintf("%s/owner/repo/pull/%d", f.url, pr.Number),
+		"base":     map[string]string{"ref": pr.Base},
+		"head":     map[string]string{"ref": pr.Head},
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"message": msg})
+}
+
+// withPR passes the PR named by the {n} of the path to h, holding f.mu.
+func (f *fakeForge) withPR(h func(http.ResponseWriter, *http.Request, *fakePR)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		n, err := strconv.Atoi(r.PathValue("n"))
+		if err != nil || n < 1 || n > len(f.prs) {
+			writeAPIError(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		h(w, r, f.prs[n-1])
+	}
+}
+
+func (f *fakeForge) createPR(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		Base, Head, Title, Body string
+		Draft                   bool
+	}
+	json.NewDecoder(r.Body).Decode(&in)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	pr, status, msg := f.open(in.Base, in.Head, in.Title, in.Body, in.Draft)
+	if pr == nil {
+		writeAPIError(w, status, msg)
+		return
+	}
+	writeJSON(w, status, f.restPR(pr))
+}
+
+func (f *fakeForge) listPRs(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, head, _ := strings.Cut(r.URL.Query().Get("head"), ":")
+	state := r.URL.Query().Get("state")
+	out := []map[string]any{}
+	for _, pr := range f.prs {
+		if (head == "" || pr.Head == head) && (state == "all" || (state == "closed") == (pr.State != "OPEN")) {
+			out = append(out, f.restPR(pr))
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (f *fakeForge) getPR(w http.ResponseWriter, r *http.Request, pr *fakePR) {
+	writeJSON(w, http.StatusOK, f.restPR(pr))
+}
+
+func (f *fakeForge) updatePR(w http.ResponseWriter, r *http.Request, pr *fakePR) {
+	var in struct {
+		Title, Body *string
+		State       string
+	}
+	json.NewDecoder(r.Body).Decode(&in)
+	if in.Title != nil {
+		pr.Title = *in.Title
+	}
+	if in.Body != nil {
+		pr.Body = *in.Body
+	}
+	if in.State == "closed" && pr.State == "OPEN" {
+		pr.State = "CLOSED"
+	}
+	writeJSON(w, http.StatusOK, f.restPR(pr))
+}
+
+// mergePR merges or squashes the head into the base branch. Rebase merges
+// are squashed too; only the resulting tree matters to prki.
+func (f *fakeForge) mergePR(w http.ResponseWriter, r *http.Request, pr *fakePR) {
+	var in struct {
+		MergeMethod string `json:"merge_method"`
+	}
+	json.NewDecoder(r.Body).Decode(&in)
+	tree, ok := f.mergeTree(pr.Base, pr.Head)
+	if pr.State != "OPEN" || !ok {
+		writeAPIError(w, http.StatusMethodNotAllowed, "Pull Request is not mergeable")
+		return
+	}
+	args := []string{"commit-tree", tree, "-p", "refs/heads/" + pr.Base}
+	if in.MergeMethod == "merge" || in.MergeMethod == "" {
+		args = append(args, "-p", "refs/heads/"+pr.Head, "-m", fmt.Sprintf("Merge pull request #%d from owner/%s", pr.Number, pr.Head))
+	} else {
+		args = append(args, "-m", fmt.Sprintf("%s (#%d)", pr.Title, pr.Number))
+	}
+	commit, err := f.git(args...)
+	if err == nil {
+		_, err = f.git("update-ref", "refs/heads/"+pr.Base, commit)
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	pr.State = "MERGED"
+	writeJSON(w, http.StatusOK, map[string]any{"merged": true, "sha": commit})
+}
+
+func (f *fakeForge) requestReviewers(w http.ResponseWriter, r *http.Request, pr *fakePR) {
+	var in struct {
+		Reviewers     []string `json:"reviewers"`
+		TeamReviewers []string `json:"team_reviewers"`
+	}
+	json.NewDecoder(r.Body).Decode(&in)
+	pr.Reviewers = append(pr.Reviewers, in.Reviewers...)
+	for _, team := range in.TeamReviewers {
+		pr.Reviewers = append(pr.Reviewers, "owner/"+team)
+	}
+	writeJSON(w, http.StatusCreated, f.restPR(pr))
+}
+
+func (f *fakeForge) addLabels(w http.ResponseWriter, r *http.Request, pr *fakePR) {
+	var in struct {
+		Labels []string `json:"labels"`
+	}
+	json.NewDecoder(r.Body).Decode(&in)
+	pr.Labels = append(pr.Labels, in.Labels...)
+	writeJSON(w, http.StatusOK, pr.Labels)
+}
+
+func (f *fakeForge) comment(w http.ResponseWriter, r *http.Request, pr *fakePR) {
+	var in struct {
+		Body string `json:"body"`
+	}
+	json.NewDecoder(r.Body).Decode(&in)
+	pr.Comments = append(pr.Comments, in.Body)
+	writeJSON(w, http.StatusCreated, map[string]string{"body": in.Body})
+}
+
+// graphql answers childPRsQuery and childPRQuery, the only queries prki
+// sends.
+func (f *fakeForge) graphql(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		Query     string
+		Variables struct {
+			Base   string
+			States []string
+			Number int
+		}
+	}
+	json.NewDecoder(r.Body).Decode(&in)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch in.Query {
+	case childPRsQuery:
+		nodes := []map[string]any{}
+		for _, pr := range slices.Backward(f.prs) { // newest first, like the query orders them
+			if pr.Base == in.Variables.Base && (in.Variables.States == nil || slices.Contains(in.Variables.States, pr.State)) {
+				nodes = append(nodes, f.graphqlPR(pr))
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"data": map[string]any{"repository": map[string]any{"pullRequests": map[string]any{"nodes": nodes}}},
+		})
+	case childPRQuery:
+		n := in.Variables.Number
+		if n < 1 || n > len(f.prs) {
+			writeJSON(w, http.StatusOK, map[string]any{
+				"data":   map[string]any{"repository": map[string]any{"pullRequest": nil}},
+				"errors": []map[string]string{{"message": fmt.Sprintf("Could not resolve to a PullRequest with the number of %d.", n)}},
+			})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"data": map[string]any{"repository": map[string]any{"pullRequest": f.graphqlPR(f.prs[n-1])}},
+		})
+	default:
+		writeJSON(w, http.StatusOK, map[string]any{"errors": []map[string]string{{"message": "unexpected query"}}})
+	}
+}
+
+// graphqlPR is pr as childPRFragment selects it. f.mu must be held.
+func (f *fakeForge) graphqlPR(pr *fakePR) map[string]any {
+	mergeable := "UNKNOWN"
+	if pr.State == "OPEN" {
+		mergeable = "CONFLICTING"
+		if _, ok := f.mergeTree(pr.Base, pr.Head); ok {
+			mergeable = "MERGEABLE"
+		}
+	}
+	var rollup any
+	if len(pr.Checks) > 0 {
+		rollup = map[string]any{"contexts": map[string]any{"nodes": pr.Checks}}
+	}
+	return map[string]any{
+		"number":         pr.Number,
+		"title":          pr.Title,
+		"reviewDecision": pr.ReviewDecision,
+		"headRefName":    pr.Head,
+		"state":          pr.State,
+		"mergeable":      mergeable,
+		"commits":        map[string]any{"nodes": []any{map[string]any{"commit": map[string]any{"statusCheckRollup": rollup}}}},
+	}
+}
+
+// captureStdout runs fn with os.Stdout redirected and returns what it wrote.
+func captureStdout(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	done := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		done <- string(b)
+	}()
+	err = fn()
+	w.Close()
+	return <-done, err
+}
+
+// setFlag sets a flag variable for the rest of the test.
+func setFlag[T any](t *testing.T, p *T, v T) {
+	old := *p
+	*p = v
+	t.Cleanup(func() { *p = old })
+}
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Forge is the code host the parent and child PRs live on. GitLab calls
+// them merge requests; prki calls both PRs.
+type Forge interface {
+	// CreatePR opens a PR and returns its URL. When the PR was opened but
+	// labeling it or requesting reviews failed, both are returned.
+	CreatePR(pr NewPR) (string, error)
+	// ListPRs lists the PRs into base, with their review and check state.
+	// state is open, merged, closed or all.
+	ListPRs(base, state string) ([]ChildPR, error)
+	// ChildPR returns one PR with its review and check state, wherever it
+	// points now.
+	ChildPR(number int) (ChildPR, error)
+	// PR returns the base and head branches of a PR.
+	PR(number int) (*prInfo, error)
+	// FindPR returns the number of the open PR from head, or 0 if there is
+	// none.
+	FindPR(head string) (int, error)
+	Comment(number int, body string) error
+	EditBody(number int, body string) error
+	// Merge merges a PR with method merge, squash or rebase.
+	Merge(number int, method string) error
+	// Close closes a PR, leaving comment on it.
+	Close(number int, comment string) error
+	// HeadRef is the ref on origin that holds the head of a PR.
+	HeadRef(number int) string
+}
+
+// NewPR is what CreatePR needs to open a PR.
+type NewPR struct {
+	Base      string
+	Head      string
+	Title     string
+	Body      string
+	Draft     bool
+	Labels    []string
+	Reviewers []string
+}
+
+// prInfo holds the refs of a PR.
+type prInfo struct {
+	Number      int    `json:"number"`
+	BaseRefName string `json:"baseRefName"`
+	HeadRefName string `json:"headRefName"`
+}
+
+var validForges = []string{"github", "gitlab"}
+
+// currentForge returns the forge set in the config, or else the one the
+// origin URL points to; GitHub when neither says. GitHub is reached through
+// its API when there is a token for it and through gh otherwise. Commands
+// that change the remote are recorded instead of run when dryRun is set;
+// those are always gh commands, so they can be pasted.
+func currentForge(dryRun *commandRecorder) Forge {
+	origin, _ := gitOutput("remote", "get-url", "origin")
+	kind := ""
+	if activeConfig != nil {
+		kind = activeConfig.Forge
+	}
+	if kind == "" {
+		kind = forgeFromURL(origin)
+	}
+	if kind == "gitlab" {
+		return gitlabForge{cli: forgeCLI{name: "glab", install: "https://gitlab.com/gitlab-org/cli", dryRun: dryRun}}
+	}
+	if dryRun == nil {
+		if api, ok := newGitHubAPI(origin); ok {
+			return api
+		}
+	}
+	return githubForge{cli: forgeCLI{name: "gh", install: "set GITHUB_TOKEN, or install it from https://cli.github.com", dryRun: dryRun}}
+}
+
+// forgeFromURL guesses the forge from the host of a remote URL.
+func forgeFromURL(url string) string {
+	host, _ := splitRemoteURL(url)
+	if strings.Contains(host, "gitlab") {
+		return "gitlab"
+	}
+	return "github"
+}
+
+// splitRemoteURL returns the lowercased host and the repository path
+// without .git of a remote URL, in any of the forms git accepts. The host
+// is empty for local paths.
+func splitRemoteURL(url string) (host, repoPath string) {
+	if _, rest, ok := strings.Cut(url, "://"); ok {
+		host, repoPath, _ = strings.Cut(rest, "/")
+	} else if h, p, ok := strings.Cut(url, ":"); ok && !strings.Contains(h, "/") {
+		host, repoPath = h, p // scp-like git@host:owner/repo
+	} else {
+		return "", url
+	}
+	if _, h, ok := strings.Cut(host, "@"); ok {
+		host = h
+	}
+	host, _, _ = strings.Cut(host, ":")
+	return strings.ToLower(host), strings.TrimSuffix(strings.Trim(repoPath, "/"), ".git")
+}
+
+// prNumberFromURL returns the number at the end of a PR URL, such as
+// .../pull/12 or .../-/merge_requests/12.
+func prNumberFromURL(url string) (int, error) {
+	n, err := strconv.Atoi(path.Base(strings.TrimRight(url, "/")))
+	if err != nil {
+		return 0, fmt.Errorf("no PR number in %s", url)
+	}
+	return n, nil
+}
+
+// forgeCLI runs a forge's command line tool.
+type forgeCLI struct {
+	name    string // gh or glab
+	install string // where to get it
+	dryRun  *commandRecorder
+}
+
+// read runs a command that only reads from the remote and returns its
+// stdout.
+func (c forgeCLI) read(args ...string) (string, error) {
+	if _, err := exec.LookPath(c.name); err != nil {
+		return "", fmt.Errorf("%s CLI not found (%s)", c.name, c.install)
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(c.name, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s %s failed: %s", c.name, commandName(args), msg)
+		}
+		return "", fmt.Errorf("%s %s failed: %w", c.name, commandName(args), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// write runs a command that changes the remote, or only records it in
+// dry-run mode.
+func (c forgeCLI) write(args ...string) (string, error) {
+	if c.dryRun != nil {
+		return c.dryRun.command(c.name, args...)
+	}
+	return c.read(args...)
+}
+
+// commandName returns the subcommand words of args, such as "pr list".
+func commandName(args []string) string {
+	var words []string
+	for _, a := range args {
+		if strings.HasPrefix(a, "-") || len(words) == 2 {
+			break
+		}
+		words = append(words, a)
+	}
+	return strings.Join(words, " ")
+}
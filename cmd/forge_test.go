@@ -0,0 +1,233 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestForgeFromURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://github.com/yyYank/prki.git", "github"},
+		{"git@github.com:yyYank/prki.git", "github"},
+		{"https://gitlab.com/group/project.git", "gitlab"},
+		{"git@gitlab.example.com:group/sub/project.git", "gitlab"},
+		{"ssh://git@GitLab.internal:2222/group/project.git", "gitlab"},
+		{"https://git.example.com/gitlab/project.git", "github"}, // only the host counts
+		{"/tmp/origin.git", "github"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := forgeFromURL(tt.url); got != tt.want {
+				t.Errorf("forgeFromURL(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCurrentForge_Config(t *testing.T) {
+	t.Cleanup(func() { activeConfig = nil })
+
+	activeConfig = &Config{Forge: "gitlab"}
+	if _, ok := currentForge(nil).(gitlabForge); !ok {
+		t.Errorf("forge: gitlab gave %T", currentForge(nil))
+	}
+	activeConfig = &Config{Forge: "github"}
+	if _, ok := currentForge(nil).(githubForge); !ok {
+		t.Errorf("forge: github gave %T", currentForge(nil))
+	}
+}
+
+func TestPRNumberFromURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		want    int
+		wantErr bool
+	}{
+		{"https://github.com/o/r/pull/12", 12, false},
+		{"https://gitlab.com/g/p/-/merge_requests/7/", 7, false},
+		{"https://github.com/o/r/pulls", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got, err := prNumberFromURL(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("prNumberFromURL(%q) = %d, want %d", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandName(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"pr", "list", "--base", "main"}, "pr list"},
+		{[]string{"api", "projects/:id/merge_requests"}, "api projects/:id/merge_requests"},
+		{[]string{"mr", "merge", "7", "--yes"}, "mr merge"},
+		{[]string{"--version"}, ""},
+	}
+	for _, tt := range tests {
+		if got := commandName(tt.args); got != tt.want {
+			t.Errorf("commandName(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestIsPRNotFound(t *testing.T) {
+	tests := []struct {
+		stderr string
+		want   bool
+	}{
+		{"GraphQL: Could not resolve to a PullRequest with the number of 999. (repository.pullRequest)", true},
+		{"no pull requests found for branch \"foo\"", true},
+		{"HTTP 404: Not Found", true},
+		{"error connecting to api.github.com", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.stderr, func(t *testing.T) {
+			if got := isPRNotFound(tt.stderr); got != tt.want {
+				t.Errorf("isPRNotFound(%q) = %v, want %v", tt.stderr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForgeCreatePR_DryRun(t *testing.T) {
+	pr := NewPR{
+		Base:      "feature",
+		Head:      "review/docs",
+		Title:     "[Review] Docs",
+		Body:      "body",
+		Draft:     true,
+		Labels:    []string{"review-split", "child-pr"},
+		Reviewers: []string{"alice", "bob"},
+	}
+	tests := []struct {
+		name  string
+		forge func(*commandRecorder) Forge
+		want  string
+	}{
+		{
+			"github",
+			func(r *commandRecorder) Forge { return githubForge{cli: forgeCLI{name: "gh", dryRun: r}} },
+			"    $ gh pr create --base feature --head review/docs --title '[Review] Docs' --body body --draft --label review-split --label child-pr --reviewer alice --reviewer bob\n",
+		},
+		{
+			"gitlab",
+			func(r *commandRecorder) Forge { return gitlabForge{cli: forgeCLI{name: "glab", dryRun: r}} },
+			"    $ glab mr create --target-branch feature --source-branch review/docs --title '[Review] Docs' --description body --yes --draft --label review-split,child-pr --reviewer alice,bob\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if _, err := tt.forge(newCommandRecorder(&buf)).CreatePR(pr); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("recorded:\n%s\nwant:\n%s", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestGitlabReviewDecision(t *testing.T) {
+	tests := []struct {
+		approved    bool
+		mergeStatus string
+		want        string
+	}{
+		{true, "mergeable", "APPROVED"},
+		{false, "not_approved", "REVIEW_REQUIRED"},
+		{true, "requested_changes", "CHANGES_REQUESTED"},
+		{false, "discussions_not_resolved", "CHANGES_REQUESTED"},
+	}
+	for _, tt := range tests {
+		if got := gitlabReviewDecision(tt.approved, tt.mergeStatus); got != tt.want {
+			t.Errorf("gitlabReviewDecision(%v, %q) = %q, want %q", tt.approved, tt.mergeStatus, got, tt.want)
+		}
+	}
+}
+
+func TestGitlabPipelineCheck(t *testing.T) {
+	tests := []struct {
+		status string
+		want   string
+	}{
+		{"success", checksPassing},
+		{"manual", checksPassing},
+		{"failed", checksFailing},
+		{"canceled", checksFailing},
+		{"running", checksPending},
+		{"created", checksPending},
+	}
+	for _, tt := range tests {
+		if got := checksState([]CheckStatus{gitlabPipelineCheck(tt.status)}); got != tt.want {
+			t.Errorf("pipeline %q is %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
+
+// fakeGlab puts a glab on PATH that answers `glab api` from the given
+// endpoint → JSON pairs.
+func fakeGlab(t *testing.T, responses map[string]string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake glab is a shell script")
+	}
+	dir := t.TempDir()
+	script := "#!/bin/sh\ncase \"$2\" in\n"
+	for endpoint, body := range responses {
+		script += "'" + endpoint + "') cat <<'EOF'\n" + body + "\nEOF\n;;\n"
+	}
+	script += "*) echo \"glab: 404 Not Found ($2)\" >&2; exit 1;;\nesac\n"
+	if err := os.WriteFile(filepath.Join(dir, "glab"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestGitlabForge_ListPRs(t *testing.T) {
+	fakeGlab(t, map[string]string{
+		"projects/:id/merge_requests?per_page=100&state=opened&target_branch=feature": `[
+			{"iid": 7, "title": "[Review] Core", "source_branch": "review/core", "state": "opened"},
+			{"iid": 8, "title": "[Review] Tests", "source_branch": "review/tests", "state": "opened"}
+		]`,
+		"projects/:id/merge_requests/7": `{"iid": 7, "title": "[Review] Core", "source_branch": "review/core", "state": "opened",
+			"detailed_merge_status": "mergeable", "head_pipeline": {"status": "success"}}`,
+		"projects/:id/merge_requests/7/approvals": `{"approved": true}`,
+		"projects/:id/merge_requests/8": `{"iid": 8, "title": "[Review] Tests", "source_branch": "review/tests", "state": "opened",
+			"has_conflicts": true, "detailed_merge_status": "requested_changes", "head_pipeline": null}`,
+		"projects/:id/merge_requests/8/approvals": `{"approved": false}`,
+	})
+
+	f := gitlabForge{cli: forgeCLI{name: "glab"}}
+	got, err := f.ListPRs("feature", "open")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ChildPR{
+		{Number: 7, Title: "[Review] Core", HeadRefName: "review/core", State: "OPEN", ReviewDecision: "APPROVED", Mergeable: "MERGEABLE",
+			StatusCheckRollup: []CheckStatus{{Context: "pipeline", State: "SUCCESS"}}},
+		{Number: 8, Title: "[Review] Tests", HeadRefName: "review/tests", State: "OPEN", ReviewDecision: "CHANGES_REQUESTED", Mergeable: "CONFLICTING"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ListPRs() =\n%+v\nwant\n%+v", got, want)
+	}
+
+	if _, err := f.PR(9); err == nil || err.Error() != "merge request !9 not found" {
+		t.Errorf("PR(9) error = %v", err)
+	}
+}
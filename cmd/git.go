@@ -0,0 +1,370 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Git is the repository prki works on. The typed methods cover what prki
+// does with refs and commits and return parsed values; Output and Stream run
+// any other git command. Every git command prki runs goes through activeGit,
+// so tests can swap in an in-memory repository.
+type Git interface {
+	// Output runs git with extra environment variables and returns its
+	// stdout without the trailing newline. On failure the error carries
+	// git's stderr.
+	Output(env []string, args ...string) (string, error)
+	// Stream runs git with its stdout going to w.
+	Stream(w io.Writer, env []string, args ...string) error
+
+	// GitPath returns the path of name inside the .git directory.
+	GitPath(name string) (string, error)
+	// CurrentBranch returns the checked out branch, or HEAD when it is
+	// detached.
+	CurrentBranch() (string, error)
+	// RevParse returns the hash of the commit rev names.
+	RevParse(rev string) (string, error)
+	// MergeBase returns the best common ancestor of a and b.
+	MergeBase(a, b string) (string, error)
+	// Diff returns the files changed between revs, given as to git diff:
+	// none for the working tree against the index, --cached for the index
+	// against HEAD, one commit for the working tree against it, two commits,
+	// or a...b for what b adds since its merge-base with a.
+	Diff(revs ...string) ([]FileChange, error)
+	// CreateBranch creates branch at commit. It fails if branch exists.
+	CreateBranch(branch, commit string) error
+	// DeleteBranch deletes branch, merged or not.
+	DeleteBranch(branch string) error
+	// Checkout checks out a branch, or a commit on a detached HEAD.
+	Checkout(rev string) error
+	// CommitTree creates the commit c describes and returns its hash,
+	// leaving the index and the working tree alone.
+	CommitTree(c TreeCommit) (string, error)
+	// UpdateRef points ref at commit, or deletes it when commit is empty. A
+	// non-empty old makes it fail unless ref still points at old.
+	UpdateRef(ref, commit, old string) error
+	// Push sets ref on origin to from, a local ref or commit, or deletes it
+	// when from is empty. A non-empty lease makes it fail unless origin's
+	// ref still points at lease. A branch pushed under its own name tracks
+	// the pushed branch.
+	Push(ref, from, lease string) error
+	// Fetch updates origin/<branch> from origin.
+	Fetch(branch string) error
+	// FastForward moves the checked out branch to rev. It fails unless the
+	// branch is an ancestor of rev.
+	FastForward(rev string) error
+}
+
+// TreeCommit describes a commit on top of Parent, or a root commit when
+// Parent is empty. Its tree is Parent's with Paths taken from Source (or
+// removed if absent there), then Patch applied with git apply
+// --unidiff-zero, then Files written. Deleted files are thus removed like
+// git rm would, and a rename becomes a move when both its old and new path
+// are given.
+type TreeCommit struct {
+	Parent  string
+	Source  string
+	Paths   []string
+	Patch   string            // some hunks of files, for instance
+	Files   map[string][]byte // contents by path
+	Message string
+}
+
+// activeGit is the Git all commands use.
+var activeGit Git = newExecGit()
+
+// execGit runs the git binary.
+type execGit struct{ cliGit }
+
+func newExecGit() execGit {
+	return execGit{cliGit{run: runGitBinary}}
+}
+
+// runGitBinary is the gitFunc that runs git for real.
+func runGitBinary(env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", gitSubcommand(args), msg)
+		}
+		return "", fmt.Errorf("git %s: %w", gitSubcommand(args), err)
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
+func (execGit) Stream(w io.Writer, env []string, args ...string) error {
+	cmd := exec.Command("git", args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// cliGit implements Git with git commands, which run executes. execGit runs
+// them; in dry-run mode a commandRecorder prints them.
+type cliGit struct {
+	run gitFunc
+}
+
+func (g cliGit) Output(env []string, args ...string) (string, error) {
+	return g.run(env, args...)
+}
+
+func (g cliGit) Stream(w io.Writer, env []string, args ...string) error {
+	out, err := g.run(env, args...)
+	if out != "" {
+		io.WriteString(w, out+"\n")
+	}
+	return err
+}
+
+func (g cliGit) silent(args ...string) error {
+	_, err := g.run(nil, args...)
+	return err
+}
+
+func (g cliGit) GitPath(name string) (string, error) {
+	return g.run(nil, "rev-parse", "--git-path", name)
+}
+
+func (g cliGit) CurrentBranch() (string, error) {
+	return g.run(nil, "rev-parse", "--abbrev-ref", "HEAD")
+}
+
+func (g cliGit) RevParse(rev string) (string, error) {
+	return g.run(nil, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+}
+
+func (g cliGit) MergeBase(a, b string) (string, error) {
+	return g.run(nil, "merge-base", a, b)
+}
+
+func (g cliGit) Diff(revs ...string) ([]FileChange, error) {
+	args := append(append([]string{"diff"}, revs...), diffStatArgs...)
+	out, err := g.run(nil, args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseRawNumstat(out), nil
+}
+
+func (g cliGit) CreateBranch(branch, commit string) error {
+	return g.silent("branch", branch, commit)
+}
+
+func (g cliGit) DeleteBranch(branch string) error {
+	return g.silent("branch", "-D", branch)
+}
+
+func (g cliGit) Checkout(rev string) error {
+	return g.silent("checkout", "-q", rev)
+}
+
+// CommitTree builds the tree in a temporary index, with plumbing commands
+// only.
+func (g cliGit) CommitTree(c TreeCommit) (string, error) {
+	index, cleanup, err := tempIndex()
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+	dir := filepath.Dir(index)
+	env := []string{"GIT_INDEX_FILE=" + index, literalPathspecs}
+
+	if c.Parent != "" {
+		if _, err := g.run(env, "read-tree", c.Parent); err != nil {
+			return "", err
+		}
+	}
+	if len(c.Paths) > 0 {
+		resetArgs := append([]string{"reset", "-q", c.Source, "--"}, c.Paths...)
+		if _, err := g.run(env, resetArgs...); err != nil {
+			return "", err
+		}
+	}
+	if c.Patch != "" {
+		patchFile := filepath.Join(dir, "hunks.patch")
+		if err := os.WriteFile(patchFile, []byte(c.Patch), 0o644); err != nil {
+			return "", err
+		}
+		if _, err := g.run(env, "apply", "--cached", "--unidiff-zero", patchFile); err != nil {
+			return "", err
+		}
+	}
+	for _, path := range slices.Sorted(maps.Keys(c.Files)) {
+		file := filepath.Join(dir, filepath.Base(path))
+		if err := os.WriteFile(file, c.Files[path], 0o644); err != nil {
+			return "", err
+		}
+		blob, err := g.run(nil, "hash-object", "-w", file)
+		if err != nil {
+			return "", err
+		}
+		if _, err := g.run(env, "update-index", "--add", "--cacheinfo", "100644,"+blob+","+path); err != nil {
+			return "", err
+		}
+	}
+	tree, err := g.run(env, "write-tree")
+	if err != nil {
+		return "", err
+	}
+	args := []string{"commit-tree", tree}
+	if c.Parent != "" {
+		args = append(args, "-p", c.Parent)
+	}
+	return g.run(nil, append(args, "-m", c.Message)...)
+}
+
+func (g cliGit) UpdateRef(ref, commit, old string) error {
+	args := []string{"update-ref", ref, commit}
+	if commit == "" {
+		args = []string{"update-ref", "-d", ref}
+	}
+	if old != "" {
+		args = append(args, old)
+	}
+	return g.silent(args...)
+}
+
+func (g cliGit) Push(ref, from, lease string) error {
+	args := []string{"push", "--quiet"}
+	refspec := from + ":" + ref
+	if from != "" && (ref == from || ref == "refs/heads/"+from) {
+		refspec = from
+		if ref != from {
+			args = append(args, "-u")
+		}
+	}
+	args = append(args, "origin")
+	if lease != "" {
+		args = append(args, "--force-with-lease="+ref+":"+lease)
+	}
+	return g.silent(append(args, refspec)...)
+}
+
+func (g cliGit) Fetch(branch string) error {
+	return g.silent("fetch", "--quiet", "origin", branch)
+}
+
+func (g cliGit) FastForward(rev string) error {
+	return g.silent("merge", "--ff-only", "--quiet", rev)
+}
+
+// gitOutput runs a git command and returns its trimmed stdout.
+// On failure the error carries git's stderr.
+func gitOutput(args ...string) (string, error) {
+	return gitOutputEnv(nil, args...)
+}
+
+// gitOutputEnv is gitOutput with extra environment variables. It is the
+// gitFunc that runs git through activeGit.
+func gitOutputEnv(env []string, args ...string) (string, error) {
+	return activeGit.Output(env, args...)
+}
+
+// gitSilent runs a git command for its effect, discarding its stdout.
+func gitSilent(args ...string) error {
+	_, err := gitOutput(args...)
+	return err
+}
+
+// getCurrentBranch returns the checked out branch, or HEAD when it is
+// detached.
+func getCurrentBranch() (string, error) {
+	return activeGit.CurrentBranch()
+}
+
+// literalPathspecs makes git take paths after "--" literally, so that file
+// names containing *, ? or a leading ':' name only themselves.
+const literalPathspecs = "GIT_LITERAL_PATHSPECS=1"
+
+// splitNul splits NUL-terminated git output (-z) into its non-empty fields.
+func splitNul(s string) []string {
+	var fields []string
+	for _, f := range strings.Split(s, "\x00") {
+		if f != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// gitFunc runs git with extra environment variables and returns its trimmed
+// stdout. gitOutputEnv runs git through activeGit; a commandRecorder only
+// prints.
+type gitFunc func(env []string, args ...string) (string, error)
+
+func repoRoot() (string, error) {
+	return gitOutput("rev-parse", "--show-toplevel")
+}
+
+// tempIndex creates a path for a throwaway index file, so plumbing commands
+// can build trees without touching the user's index or working tree.
+func tempIndex() (path string, cleanup func(), err error) {
+	dir, err := os.MkdirTemp("", "prki-index-")
+	if err != nil {
+		return "", nil, err
+	}
+	return filepath.Join(dir, "index"), func() { os.RemoveAll(dir) }, nil
+}
+
+// snapshotCommit records uncommitted changes as a dangling commit on top of
+// HEAD, leaving the index and working tree as they are.
+func snapshotCommit(git gitFunc, mode diffMode) (string, error) {
+	tree, err := snapshotTree(git, mode)
+	if err != nil {
+		return "", err
+	}
+	return git(nil, "commit-tree", tree, "-p", "HEAD", "-m", "prki snapshot ("+mode.String()+")")
+}
+
+// snapshotTree writes the tree HEAD would have with the uncommitted changes
+// of mode committed, leaving out the untracked files exclude (relative to
+// the repository root). The same changes always give the same tree.
+func snapshotTree(git gitFunc, mode diffMode, exclude ...string) (string, error) {
+	switch mode {
+	case modeStaged:
+		return git(nil, "write-tree")
+	case modeUnstaged, modeWorktree:
+		index, cleanup, err := tempIndex()
+		if err != nil {
+			return "", err
+		}
+		defer cleanup()
+		root, err := repoRoot()
+		if err != nil {
+			return "", err
+		}
+		env := []string{"GIT_INDEX_FILE=" + index}
+		if _, err := git(env, "read-tree", "HEAD"); err != nil {
+			return "", err
+		}
+		add := []string{"-C", root, "add", "-A"}
+		if len(exclude) > 0 {
+			add = append(add, "--", ".")
+			for _, path := range exclude {
+				add = append(add, ":(exclude,literal)"+path)
+			}
+		}
+		if _, err := git(env, add...); err != nil {
+			return "", err
+		}
+		return git(env, "write-tree")
+	}
+	return "", fmt.Errorf("no snapshot needed for %s mode", mode)
+}
@@ -0,0 +1,560 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// newTestRepo creates a git repository with one commit on main in a temp
+// directory and makes it the working directory for the rest of the test.
+func newTestRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	runGit(t, dir, "init", "-q", "-b", "main")
+	runGit(t, dir, "config", "user.email", "test@example.com")
+	runGit(t, dir, "config", "user.name", "prki test")
+	runGit(t, dir, "config", "commit.gpgsign", "false")
+	writeFile(t, dir, "edited.go", "package a\n")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "initial")
+	t.Chdir(dir)
+	return dir
+}
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSnapshotCommit_LeavesWorkingTreeAlone(t *testing.T) {
+	dir := newTestRepo(t)
+	writeFile(t, dir, "edited.go", "package a\n\nfunc f() {}\n")
+	writeFile(t, dir, "new.go", "package a\n")
+	statusBefore := runGit(t, dir, "status", "--porcelain")
+
+	snapshot, err := snapshotCommit(gitOutputEnv, modeWorktree)
+	if err != nil {
+		t.Fatalf("snapshotCommit: %v", err)
+	}
+
+	if got := runGit(t, dir, "status", "--porcelain"); got != statusBefore {
+		t.Errorf("status changed:\nbefore:\n%s\nafter:\n%s", statusBefore, got)
+	}
+	if got := runGit(t, dir, "show", snapshot+":new.go"); got != "package a" {
+		t.Errorf("snapshot new.go = %q", got)
+	}
+	if got := runGit(t, dir, "rev-parse", snapshot+"^"); got != runGit(t, dir, "rev-parse", "HEAD") {
+		t.Errorf("snapshot parent = %s, want HEAD", got)
+	}
+}
+
+func TestSnapshotCommit_StagedOnly(t *testing.T) {
+	dir := newTestRepo(t)
+	writeFile(t, dir, "edited.go", "package a\n\nvar staged = 1\n")
+	runGit(t, dir, "add", "edited.go")
+	writeFile(t, dir, "edited.go", "package a\n\nvar staged = 2\n")
+
+	snapshot, err := snapshotCommit(gitOutputEnv, modeStaged)
+	if err != nil {
+		t.Fatalf("snapshotCommit: %v", err)
+	}
+	if got := runGit(t, dir, "show", snapshot+":edited.go"); !strings.Contains(got, "staged = 1") {
+		t.Errorf("snapshot should hold the staged content, got %q", got)
+	}
+}
+
+func TestExecGit_CommitTree(t *testing.T) {
+	dir := newTestRepo(t)
+	base := runGit(t, dir, "rev-parse", "HEAD")
+	writeFile(t, dir, "a.go", "package a\n")
+	writeFile(t, dir, "b.go", "package b\n")
+	runGit(t, dir, "rm", "-q", "edited.go")
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "-q", "-m", "parent work")
+	source := runGit(t, dir, "rev-parse", "HEAD")
+
+	commit, err := activeGit.CommitTree(TreeCommit{
+		Parent:  base,
+		Source:  source,
+		Paths:   []string{"a.go", "edited.go"},
+		Message: "[Review] A",
+	})
+	if err != nil {
+		t.Fatalf("CommitTree: %v", err)
+	}
+
+	files := runGit(t, dir, "ls-tree", "--name-only", commit)
+	if files != "a.go" {
+		t.Errorf("tree files = %q, want only a.go (b.go excluded, edited.go deleted)", files)
+	}
+	if got := runGit(t, dir, "log", "-1", "--format=%s", commit); got != "[Review] A" {
+		t.Errorf("commit message = %q", got)
+	}
+	if got := runGit(t, dir, "rev-parse", "HEAD"); got != source {
+		t.Errorf("HEAD moved to %s", got)
+	}
+}
+
+func TestExecGit_CommitTreeFiles(t *testing.T) {
+	dir := newTestRepo(t)
+	statusBefore := runGit(t, dir, "status", "--porcelain")
+
+	commit, err := activeGit.CommitTree(TreeCommit{
+		Files:   map[string][]byte{"tree.json": []byte("{}\n")},
+		Message: "root",
+	})
+	if err != nil {
+		t.Fatalf("CommitTree: %v", err)
+	}
+	if got := runGit(t, dir, "ls-tree", "--name-only", commit); got != "tree.json" {
+		t.Errorf("tree files = %q, want only tree.json", got)
+	}
+	if got := runGit(t, dir, "rev-list", "--parents", "-1", commit); got != commit {
+		t.Errorf("a commit without Parent has parents: %q", got)
+	}
+	if got := runGit(t, dir, "status", "--porcelain"); got != statusBefore {
+		t.Errorf("status changed:\n%s", got)
+	}
+}
+
+// memGit is an in-memory repository with an origin: commits with their
+// parents and files, local refs, origin's refs and HEAD. Only the typed
+// methods work; raw commands fail, so a test using memGit shows that the
+// code it covers needs nothing else. Diffs compare whole files and count
+// lines by content, without rename detection.
+type memGit struct {
+	dir      string // holds the files of GitPath
+	commits  map[string]memCommit
+	refs     map[string]string // local refs by full name, including origin/*
+	origin   map[string]string // origin's refs by full name
+	head     string            // the checked out branch's full ref, or a commit
+	failures map[string]error  // by "<op> <ref>", see fail
+}
+
+type memCommit struct {
+	parents []string
+	files   map[string]string
+	message string
+}
+
+// useMemGit makes an empty memGit with main checked out the activeGit for
+// the rest of the test.
+func useMemGit(t *testing.T) *memGit {
+	t.Helper()
+	g := &memGit{
+		dir:      t.TempDir(),
+		commits:  map[string]memCommit{},
+		refs:     map[string]string{},
+		origin:   map[string]string{},
+		head:     "refs/heads/main",
+		failures: map[string]error{},
+	}
+	old := activeGit
+	activeGit = g
+	t.Cleanup(func() { activeGit = old })
+	return g
+}
+
+// commit commits files on top of branch and moves branch to the commit. An
+// empty content deletes the file.
+func (g *memGit) commit(branch string, files map[string]string) string {
+	ref := "refs/heads/" + branch
+	tree := g.tree(g.refs[ref])
+	for path, content := range files {
+		if content == "" {
+			delete(tree, path)
+		} else {
+			tree[path] = content
+		}
+	}
+	var parents []string
+	if parent := g.refs[ref]; parent != "" {
+		parents = []string{parent}
+	}
+	g.refs[ref] = g.newCommit(parents, tree, "commit on "+branch)
+	return g.refs[ref]
+}
+
+// push copies local branches to origin, like git push origin <branch>...
+func (g *memGit) push(branches ...string) {
+	for _, b := range branches {
+		g.origin["refs/heads/"+b] = g.refs["refs/heads/"+b]
+		g.refs["refs/remotes/origin/"+b] = g.refs["refs/heads/"+b]
+	}
+}
+
+// fail makes op on ref fail with msg, as git would report it. op is the git
+// subcommand: push and update-ref take full refs, fetch a branch name.
+func (g *memGit) fail(op, ref, msg string) {
+	g.failures[op+" "+ref] = fmt.Errorf("git %s: %s", op, msg)
+}
+
+func (g *memGit) newCommit(parents []string, files map[string]string, msg string) string {
+	id := fmt.Sprintf("%040x", len(g.commits)+1)
+	g.commits[id] = memCommit{parents: parents, files: files, message: msg}
+	return id
+}
+
+// tree returns a copy of the files of commit, empty for no commit.
+func (g *memGit) tree(commit string) map[string]string {
+	files := maps.Clone(g.commits[commit].files)
+	if files == nil {
+		files = map[string]string{}
+	}
+	return files
+}
+
+func (g *memGit) resolve(rev string) (string, error) {
+	if rev == "HEAD" {
+		rev = g.head
+	}
+	for _, ref := range []string{rev, "refs/heads/" + rev, "refs/remotes/" + rev} {
+		if c, ok := g.refs[ref]; ok {
+			return c, nil
+		}
+	}
+	if _, ok := g.commits[rev]; ok {
+		return rev, nil
+	}
+	return "", fmt.Errorf("git rev-parse: fatal: bad revision '%s'", rev)
+}
+
+// ancestors returns commit and all commits it descends from.
+func (g *memGit) ancestors(commit string) map[string]bool {
+	seen := map[string]bool{}
+	queue := []string{commit}
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+		if !seen[c] {
+			seen[c] = true
+			queue = append(queue, g.commits[c].parents...)
+		}
+	}
+	return seen
+}
+
+func (g *memGit) Output(env []string, args ...string) (string, error) {
+	return "", fmt.Errorf("memGit does not run git %s", strings.Join(args, " "))
+}
+
+func (g *memGit) Stream(w io.Writer, env []string, args ...string) error {
+	_, err := g.Output(env, args...)
+	return err
+}
+
+func (g *memGit) GitPath(name string) (string, error) {
+	return filepath.Join(g.dir, name), nil
+}
+
+func (g *memGit) CurrentBranch() (string, error) {
+	if branch, ok := strings.CutPrefix(g.head, "refs/heads/"); ok {
+		return branch, nil
+	}
+	return "HEAD", nil
+}
+
+func (g *memGit) RevParse(rev string) (string, error) {
+	return g.resolve(rev)
+}
+
+func (g *memGit) MergeBase(a, b string) (string, error) {
+	ca, err := g.resolve(a)
+	if err != nil {
+		return "", err
+	}
+	cb, err := g.resolve(b)
+	if err != nil {
+		return "", err
+	}
+	ofA := g.ancestors(ca)
+	queue := []string{cb}
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+		if ofA[c] {
+			return c, nil
+		}
+		queue = append(queue, g.commits[c].parents...)
+	}
+	return "", fmt.Errorf("git merge-base: no common ancestor of %s and %s", a, b)
+}
+
+func (g *memGit) Diff(revs ...string) ([]FileChange, error) {
+	var from, to string
+	switch {
+	case len(revs) == 1 && strings.Contains(revs[0], "..."):
+		a, b, _ := strings.Cut(revs[0], "...")
+		mb, err := g.MergeBase(a, b)
+		if err != nil {
+			return nil, err
+		}
+		from, to = mb, b
+	case len(revs) == 2:
+		from, to = revs[0], revs[1]
+	default:
+		return nil, fmt.Errorf("memGit has no index or working tree to diff %q", revs)
+	}
+	cf, err := g.resolve(from)
+	if err != nil {
+		return nil, err
+	}
+	ct, err := g.resolve(to)
+	if err != nil {
+		return nil, err
+	}
+	old, new := g.tree(cf), g.tree(ct)
+
+	var files []FileChange
+	paths := maps.Clone(old)
+	maps.Copy(paths, new)
+	for _, path := range slices.Sorted(maps.Keys(paths)) {
+		o, inOld := old[path]
+		n, inNew := new[path]
+		switch {
+		case !inOld:
+			files = append(files, FileChange{Path: path, Status: statusAdded, LinesAdded: countLines([]byte(n))})
+		case !inNew:
+			files = append(files, FileChange{Path: path, Status: statusDeleted, LinesDeleted: countLines([]byte(o))})
+		case o != n:
+			added, deleted := lineDelta(o, n)
+			files = append(files, FileChange{Path: path, Status: statusModified, LinesAdded: added, LinesDeleted: deleted})
+		}
+	}
+	return files, nil
+}
+
+// lineDelta counts the lines only new has and those only old has, by
+// content.
+func lineDelta(old, new string) (added, deleted int) {
+	count := map[string]int{}
+	for _, l := range strings.SplitAfter(old, "\n") {
+		count[l]++
+	}
+	for _, l := range strings.SplitAfter(new, "\n") {
+		count[l]--
+	}
+	for l, n := range count {
+		switch {
+		case l == "":
+		case n > 0:
+			deleted += n
+		case n < 0:
+			added -= n
+		}
+	}
+	return added, deleted
+}
+
+func (g *memGit) CreateBranch(branch, commit string) error {
+	ref := "refs/heads/" + branch
+	if _, ok := g.refs[ref]; ok {
+		return fmt.Errorf("git branch: fatal: a branch named '%s' already exists", branch)
+	}
+	c, err := g.resolve(commit)
+	if err != nil {
+		return err
+	}
+	g.refs[ref] = c
+	return nil
+}
+
+func (g *memGit) DeleteBranch(branch string) error {
+	ref := "refs/heads/" + branch
+	if _, ok := g.refs[ref]; !ok {
+		return fmt.Errorf("git branch: error: branch '%s' not found", branch)
+	}
+	if g.head == ref {
+		return fmt.Errorf("git branch: error: cannot delete branch '%s' used by worktree", branch)
+	}
+	delete(g.refs, ref)
+	return nil
+}
+
+func (g *memGit) Checkout(rev string) error {
+	if _, ok := g.refs["refs/heads/"+rev]; ok {
+		g.head = "refs/heads/" + rev
+		return nil
+	}
+	c, err := g.resolve(rev)
+	if err != nil {
+		return err
+	}
+	g.head = c
+	return nil
+}
+
+func (g *memGit) CommitTree(c TreeCommit) (string, error) {
+	if c.Patch != "" {
+		return "", errors.New("memGit cannot apply patches")
+	}
+	var parents []string
+	files := map[string]string{}
+	if c.Parent != "" {
+		parent, err := g.resolve(c.Parent)
+		if err != nil {
+			return "", err
+		}
+		parents, files = []string{parent}, g.tree(parent)
+	}
+	if len(c.Paths) > 0 {
+		source, err := g.resolve(c.Source)
+		if err != nil {
+			return "", err
+		}
+		from := g.tree(source)
+		for _, path := range c.Paths {
+			if content, ok := from[path]; ok {
+				files[path] = content
+			} else {
+				delete(files, path)
+			}
+		}
+	}
+	for path, data := range c.Files {
+		files[path] = string(data)
+	}
+	return g.newCommit(parents, files, c.Message), nil
+}
+
+func (g *memGit) UpdateRef(ref, commit, old string) error {
+	if err := g.failures["update-ref "+ref]; err != nil {
+		return err
+	}
+	if old != "" && g.refs[ref] != old {
+		return fmt.Errorf("git update-ref: fatal: cannot lock ref '%s': is at %s but expected %s", ref, g.refs[ref], old)
+	}
+	if commit == "" {
+		delete(g.refs, ref)
+		return nil
+	}
+	c, err := g.resolve(commit)
+	if err != nil {
+		return err
+	}
+	g.refs[ref] = c
+	return nil
+}
+
+func (g *memGit) Push(ref, from, lease string) error {
+	if err := g.failures["push "+ref]; err != nil {
+		return err
+	}
+	if lease != "" && g.origin[ref] != lease {
+		return fmt.Errorf("git push: ! [rejected] %s (stale info)", ref)
+	}
+	tracking := ""
+	if branch, ok := strings.CutPrefix(ref, "refs/heads/"); ok {
+		tracking = "refs/remotes/origin/" + branch
+	}
+	if from == "" {
+		if _, ok := g.origin[ref]; !ok {
+			return fmt.Errorf("git push: error: unable to delete '%s': remote ref does not exist", ref)
+		}
+		delete(g.origin, ref)
+		delete(g.refs, tracking)
+		return nil
+	}
+	c, err := g.resolve(from)
+	if err != nil {
+		return err
+	}
+	g.origin[ref] = c
+	if tracking != "" {
+		g.refs[tracking] = c
+	}
+	return nil
+}
+
+func (g *memGit) Fetch(branch string) error {
+	if err := g.failures["fetch "+branch]; err != nil {
+		return err
+	}
+	c, ok := g.origin["refs/heads/"+branch]
+	if !ok {
+		return fmt.Errorf("git fetch: fatal: couldn't find remote ref %s", branch)
+	}
+	g.refs["refs/remotes/origin/"+branch] = c
+	return nil
+}
+
+func (g *memGit) FastForward(rev string) error {
+	target, err := g.resolve(rev)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(g.head, "refs/heads/") || !g.ancestors(target)[g.refs[g.head]] {
+		return errors.New("git merge: fatal: Not possible to fast-forward, aborting.")
+	}
+	g.refs[g.head] = target
+	return nil
+}
+
+func TestExecGit_ErrorNamesSubcommand(t *testing.T) {
+	dir := newTestRepo(t)
+	_, err := newExecGit().Output(nil, "-C", dir, "rev-parse", "--verify", "no-such-ref")
+	if err == nil || !strings.HasPrefix(err.Error(), "git rev-parse: ") {
+		t.Errorf("err = %v, want it to start with git rev-parse", err)
+	}
+}
+
+func TestMemGit(t *testing.T) {
+	g := useMemGit(t)
+	base := g.commit("main", map[string]string{"a.txt": "a\n"})
+	if err := activeGit.CreateBranch("feature", "main"); err != nil {
+		t.Fatal(err)
+	}
+	if err := activeGit.CreateBranch("feature", "main"); err == nil {
+		t.Error("creating an existing branch should fail")
+	}
+	if err := activeGit.Checkout("feature"); err != nil {
+		t.Fatal(err)
+	}
+	g.commit("feature", map[string]string{"a.txt": "a\nb\n", "b.txt": "b\n"})
+	g.commit("main", map[string]string{"c.txt": "c\n"})
+
+	if mb, err := mergeBase("main", "feature"); err != nil || mb != base {
+		t.Errorf("mergeBase = %s, %v; want %s", mb, err, base)
+	}
+	files, err := activeGit.Diff("main...feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].Path != "a.txt" || files[0].LinesAdded != 1 || files[1].Status != statusAdded {
+		t.Errorf("Diff(main...feature) = %+v", files)
+	}
+	if got, _ := getCurrentBranch(); got != "feature" {
+		t.Errorf("current branch = %s", got)
+	}
+	if err := activeGit.FastForward("main"); err == nil {
+		t.Error("fast-forwarding feature to the diverged main should fail")
+	}
+	if _, err := gitOutput("status"); err == nil {
+		t.Error("memGit should not run raw commands")
+	}
+}
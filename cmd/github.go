@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// githubForge talks to GitHub through the gh CLI.
+type githubForge struct {
+	cli forgeCLI
+}
+
+// childPRFields are the gh --json fields decoded into ChildPR.
+const childPRFields = "number,title,reviewDecision,headRefName,state,mergeable,statusCheckRollup"
+
+func (f githubForge) CreatePR(pr NewPR) (string, error) {
+	args := []string{
+		"pr", "create",
+		"--base", pr.Base,
+		"--head", pr.Head,
+		"--title", pr.Title,
+		"--body", pr.Body,
+	}
+	if pr.Draft {
+		args = append(args, "--draft")
+	}
+	for _, l := range pr.Labels {
+		args = append(args, "--label", l)
+	}
+	for _, r := range pr.Reviewers {
+		args = append(args, "--reviewer", r)
+	}
+	return f.cli.write(args...)
+}
+
+func (f githubForge) ListPRs(base, state string) ([]ChildPR, error) {
+	out, err := f.cli.read("pr", "list", "--base", base, "--state", state, "--json", childPRFields)
+	if err != nil {
+		return nil, err
+	}
+	var prs []ChildPR
+	if err := json.Unmarshal([]byte(out), &prs); err != nil {
+		return nil, fmt.Errorf("failed to parse gh output: %w", err)
+	}
+	return prs, nil
+}
+
+func (f githubForge) ChildPR(number int) (ChildPR, error) {
+	out, err := f.cli.read("pr", "view", strconv.Itoa(number), "--json", childPRFields)
+	if err != nil {
+		if isPRNotFound(err.Error()) {
+			return ChildPR{}, fmt.Errorf("pull request #%d not found", number)
+		}
+		return ChildPR{}, err
+	}
+	var pr ChildPR
+	if err := json.Unmarshal([]byte(out), &pr); err != nil {
+		return ChildPR{}, fmt.Errorf("failed to parse gh output: %w", err)
+	}
+	return pr, nil
+}
+
+func (f githubForge) PR(number int) (*prInfo, error) {
+	out, err := f.cli.read("pr", "view", strconv.Itoa(number), "--json", "number,baseRefName,headRefName")
+	if err != nil {
+		if isPRNotFound(err.Error()) {
+			return nil, fmt.Errorf("pull request #%d not found", number)
+		}
+		return nil, err
+	}
+	var info prInfo
+	if err := json.Unmarshal([]byte(out), &info); err != nil {
+		return nil, fmt.Errorf("failed to parse gh output: %w", err)
+	}
+	if info.BaseRefName == "" {
+		return nil, fmt.Errorf("pull request #%d not found", number)
+	}
+	return &info, nil
+}
+
+// isPRNotFound reports whether gh's stderr says the pull request does not exist.
+func isPRNotFound(stderr string) bool {
+	s := strings.ToLower(stderr)
+	return strings.Contains(s, "could not resolve to a pullrequest") ||
+		strings.Contains(s, "no pull requests found") ||
+		strings.Contains(s, "http 404")
+}
+
+func (f githubForge) FindPR(head string) (int, error) {
+	out, err := f.cli.read("pr", "view", head, "--json", "number", "--jq", ".number")
+	if err != nil {
+		if isPRNotFound(err.Error()) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return strconv.Atoi(out)
+}
+
+func (f githubForge) Comment(number int, body string) error {
+	_, err := f.cli.write("pr", "comment", strconv.Itoa(number), "--body", body)
+	return err
+}
+
+func (f githubForge) EditBody(number int, body string) error {
+	_, err := f.cli.write("pr", "edit", strconv.Itoa(number), "--body", body)
+	return err
+}
+
+func (f githubForge) Merge(number int, method string) error {
+	_, err := f.cli.write("pr", "merge", strconv.Itoa(number), "--"+method)
+	return err
+}
+
+func (f githubForge) Close(number int, comment string) error {
+	_, err := f.cli.write("pr", "close", strconv.Itoa(number), "--comment", comment)
+	return err
+}
+
+func (f githubForge) HeadRef(number int) string {
+	return fmt.Sprintf("refs/pull/%d/head", number)
+}
@@ -0,0 +1,460 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// githubAPI talks to the GitHub REST and GraphQL APIs directly, so prki
+// works without the gh CLI wherever a token is available.
+type githubAPI struct {
+	apiURL     string // REST root, such as https://api.github.com
+	graphqlURL string
+	token      string
+	owner      string
+	repo       string
+	http       *http.Client
+	sleep      func(time.Duration)
+}
+
+const (
+	// githubMaxAttempts is how often a request is tried before giving up.
+	githubMaxAttempts = 4
+	// githubMaxRateLimitWait is the longest prki waits for a rate limit to
+	// reset; beyond that it fails and tells the user when to retry.
+	githubMaxRateLimitWait = 5 * time.Minute
+)
+
+// newGitHubAPI returns a client for the repository at remoteURL, or false
+// when the URL names no GitHub repository or there is no token for its
+// host.
+func newGitHubAPI(remoteURL string) (*githubAPI, bool) {
+	host, repoPath := splitRemoteURL(remoteURL)
+	owner, repo, ok := strings.Cut(repoPath, "/")
+	if host == "" || !ok || owner == "" || repo == "" || strings.Contains(repo, "/") {
+		return nil, false
+	}
+	token := githubToken(host)
+	if token == "" {
+		return nil, false
+	}
+	apiURL := githubAPIURL(host)
+	return &githubAPI{
+		apiURL:     apiURL,
+		graphqlURL: strings.TrimSuffix(apiURL, "/v3") + "/graphql",
+		token:      token,
+		owner:      owner,
+		repo:       repo,
+		http:       &http.Client{Timeout: 30 * time.Second},
+		sleep:      time.Sleep,
+	}, true
+}
+
+// githubToken reads the token for host from the same variables gh uses.
+func githubToken(host string) string {
+	vars := []string{"GH_TOKEN", "GITHUB_TOKEN"}
+	if host != "github.com" {
+		vars = append([]string{"GH_ENTERPRISE_TOKEN", "GITHUB_ENTERPRISE_TOKEN"}, vars...)
+	}
+	for _, v := range vars {
+		if t := os.Getenv(v); t != "" {
+			return t
+		}
+	}
+	return ""
+}
+
+// githubAPIURL returns the REST root for host: github.api_url from the
+// config, else GITHUB_API_URL, else api.github.com or the GitHub Enterprise
+// Server default of https://<host>/api/v3.
+func githubAPIURL(host string) string {
+	if activeConfig != nil && activeConfig.GitHub.APIURL != "" {
+		return strings.TrimRight(activeConfig.GitHub.APIURL, "/")
+	}
+	if u := os.Getenv("GITHUB_API_URL"); u != "" {
+		return strings.TrimRight(u, "/")
+	}
+	if host == "github.com" {
+		return "https://api.github.com"
+	}
+	return "https://" + host + "/api/v3"
+}
+
+func (c *githubAPI) CreatePR(pr NewPR) (string, error) {
+	var created struct {
+		Number  int    `json:"number"`
+		HTMLURL string `json:"html_url"`
+	}
+	err := c.do(http.MethodPost, c.repoPath("pulls"), map[string]any{
+		"base":  pr.Base,
+		"head":  pr.Head,
+		"title": pr.Title,
+		"body":  pr.Body,
+		"draft": pr.Draft,
+	}, &created)
+	if err != nil {
+		return "", err
+	}
+
+	if len(pr.Labels) > 0 {
+		path := c.repoPath(fmt.Sprintf("issues/%d/labels", created.Number))
+		if err := c.do(http.MethodPost, path, map[string]any{"labels": pr.Labels}, nil); err != nil {
+			return created.HTMLURL, fmt.Errorf("failed to label #%d: %w", created.Number, err)
+		}
+	}
+	if len(pr.Reviewers) > 0 {
+		// org/team requests a team, like gh pr create --reviewer
+		users, teams := []string{}, []string{}
+		for _, r := range pr.Reviewers {
+			if _, team, ok := strings.Cut(r, "/"); ok {
+				teams = append(teams, team)
+			} else {
+				users = append(users, r)
+			}
+		}
+		path := c.repoPath(fmt.Sprintf("pulls/%d/requested_reviewers", created.Number))
+		if err := c.do(http.MethodPost, path, map[string]any{"reviewers": users, "team_reviewers": teams}, nil); err != nil {
+			return created.HTMLURL, fmt.Errorf("failed to request reviews on #%d: %w", created.Number, err)
+		}
+	}
+	return created.HTMLURL, nil
+}
+
+// childPRFragment selects what gh pr view --json childPRFields does.
+const childPRFragment = `fragment childPR on PullRequest {
+  number
+  title
+  reviewDecision
+  headRefName
+  state
+  mergeable
+  commits(last: 1) {
+    nodes {
+      commit {
+        statusCheckRollup {
+          contexts(first: 100) {
+            nodes {
+              ... on CheckRun { name status conclusion }
+              ... on StatusContext { context state }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+// childPRsQuery lists the PRs into a base, like gh pr list; childPRQuery
+// fetches one PR by number.
+const childPRsQuery = `query($owner: String!, $repo: String!, $base: String!, $states: [PullRequestState!]) {
+  repository(owner: $owner, name: $repo) {
+    pullRequests(baseRefName: $base, states: $states, first: 100, orderBy: {field: CREATED_AT, direction: DESC}) {
+      nodes { ...childPR }
+    }
+  }
+}
+` + childPRFragment
+
+const childPRQuery = `query($owner: String!, $repo: String!, $number: Int!) {
+  repository(owner: $owner, name: $repo) {
+    pullRequest(number: $number) { ...childPR }
+  }
+}
+` + childPRFragment
+
+// graphqlPR is a childPRFragment result.
+type graphqlPR struct {
+	ChildPR
+	Commits struct {
+		Nodes []struct {
+			Commit struct {
+				StatusCheckRollup *struct {
+					Contexts struct {
+						Nodes []CheckStatus `json:"nodes"`
+					} `json:"contexts"`
+				} `json:"statusCheckRollup"`
+			} `json:"commit"`
+		} `json:"nodes"`
+	} `json:"commits"`
+}
+
+func (n graphqlPR) childPR() ChildPR {
+	pr := n.ChildPR
+	for _, commit := range n.Commits.Nodes {
+		if rollup := commit.Commit.StatusCheckRollup; rollup != nil {
+			pr.StatusCheckRollup = rollup.Contexts.Nodes
+		}
+	}
+	return pr
+}
+
+func (c *githubAPI) ListPRs(base, state string) ([]ChildPR, error) {
+	vars := map[string]any{"owner": c.owner, "repo": c.repo, "base": base}
+	switch state {
+	case "open":
+		vars["states"] = []string{"OPEN"}
+	case "merged":
+		vars["states"] = []string{"MERGED"}
+	case "closed": // as gh pr list counts them
+		vars["states"] = []string{"CLOSED", "MERGED"}
+	}
+	var data struct {
+		Repository struct {
+			PullRequests struct {
+				Nodes []graphqlPR `json:"nodes"`
+			} `json:"pullRequests"`
+		} `json:"repository"`
+	}
+	if err := c.graphql(childPRsQuery, vars, &data); err != nil {
+		return nil, err
+	}
+	prs := make([]ChildPR, 0, len(data.Repository.PullRequests.Nodes))
+	for _, n := range data.Repository.PullRequests.Nodes {
+		prs = append(prs, n.childPR())
+	}
+	return prs, nil
+}
+
+func (c *githubAPI) ChildPR(number int) (ChildPR, error) {
+	var data struct {
+		Repository struct {
+			PullRequest *graphqlPR `json:"pullRequest"`
+		} `json:"repository"`
+	}
+	err := c.graphql(childPRQuery, map[string]any{"owner": c.owner, "repo": c.repo, "number": number}, &data)
+	if err != nil && !isPRNotFound(err.Error()) {
+		return ChildPR{}, err
+	}
+	if err != nil || data.Repository.PullRequest == nil {
+		return ChildPR{}, fmt.Errorf("pull request #%d not found", number)
+	}
+	return data.Repository.PullRequest.childPR(), nil
+}
+
+func (c *githubAPI) PR(number int) (*prInfo, error) {
+	var pr struct {
+		Number int `json:"number"`
+		Base   struct {
+			Ref string `json:"ref"`
+		} `json:"base"`
+		Head struct {
+			Ref string `json:"ref"`
+		} `json:"head"`
+	}
+	if err := c.do(http.MethodGet, c.repoPath(fmt.Sprintf("pulls/%d", number)), nil, &pr); err != nil {
+		if isNotFound(err) {
+			return nil, fmt.Errorf("pull request #%d not found", number)
+		}
+		return nil, err
+	}
+	return &prInfo{Number: pr.Number, BaseRefName: pr.Base.Ref, HeadRefName: pr.Head.Ref}, nil
+}
+
+func (c *githubAPI) FindPR(head string) (int, error) {
+	query := url.Values{"head": {c.owner + ":" + head}, "state": {"open"}}
+	var prs []struct {
+		Number int `json:"number"`
+	}
+	if err := c.do(http.MethodGet, c.repoPath("pulls?"+query.Encode()), nil, &prs); err != nil {
+		return 0, err
+	}
+	if len(prs) == 0 {
+		return 0, nil
+	}
+	return prs[0].Number, nil
+}
+
+func (c *githubAPI) Comment(number int, body string) error {
+	return c.do(http.MethodPost, c.repoPath(fmt.Sprintf("issues/%d/comments", number)), map[string]any{"body": body}, nil)
+}
+
+func (c *githubAPI) EditBody(number int, body string) error {
+	return c.do(http.MethodPatch, c.repoPath(fmt.Sprintf("pulls/%d", number)), map[string]any{"body": body}, nil)
+}
+
+func (c *githubAPI) Merge(number int, method string) error {
+	return c.do(http.MethodPut, c.repoPath(fmt.Sprintf("pulls/%d/merge", number)), map[string]any{"merge_method": method}, nil)
+}
+
+func (c *githubAPI) Close(number int, comment string) error {
+	if err := c.Comment(number, comment); err != nil {
+		return err
+	}
+	return c.do(http.MethodPatch, c.repoPath(fmt.Sprintf("pulls/%d", number)), map[string]any{"state": "closed"}, nil)
+}
+
+func (c *githubAPI) HeadRef(number int) string {
+	return fmt.Sprintf("refs/pull/%d/head", number)
+}
+
+func (c *githubAPI) repoPath(path string) string {
+	return fmt.Sprintf("/repos/%s/%s/%s", url.PathEscape(c.owner), url.PathEscape(c.repo), path)
+}
+
+// githubAPIError is a response the GitHub API answered with an error status.
+type githubAPIError struct {
+	method  string
+	path    string
+	status  int
+	message string
+}
+
+func (e *githubAPIError) Error() string {
+	return fmt.Sprintf("GitHub API %s %s failed: %d %s", e.method, e.path, e.status, e.message)
+}
+
+// isNotFound reports whether err is a 404 from the GitHub API.
+func isNotFound(err error) bool {
+	var apiErr *githubAPIError
+	return errors.As(err, &apiErr) && apiErr.status == http.StatusNotFound
+}
+
+// graphql runs a GraphQL query and decodes its data into out.
+func (c *githubAPI) graphql(query string, vars map[string]any, out any) error {
+	var resp struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := c.do(http.MethodPost, c.graphqlURL, map[string]any{"query": query, "variables": vars}, &resp); err != nil {
+		return err
+	}
+	if len(resp.Errors) > 0 {
+		msgs := make([]string, len(resp.Errors))
+		for i, e := range resp.Errors {
+			msgs[i] = e.Message
+		}
+		return fmt.Errorf("GitHub GraphQL query failed: %s", strings.Join(msgs, "; "))
+	}
+	if err := json.Unmarshal(resp.Data, out); err != nil {
+		return fmt.Errorf("failed to parse GitHub GraphQL response: %w", err)
+	}
+	return nil
+}
+
+// do sends a request with in as its JSON body and decodes the response into
+// out. path is relative to apiURL unless it is a full URL. Requests are
+// retried when rate limited, and on network and server errors unless they
+// might create something twice (POSTs other than GraphQL queries).
+func (c *githubAPI) do(method, path string, in, out any) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	target := path
+	if !strings.HasPrefix(path, "http") {
+		target = c.apiURL + path
+	}
+	retryable := method != http.MethodPost || target == c.graphqlURL
+
+	for attempt := 1; ; attempt++ {
+		last := attempt == githubMaxAttempts
+		req, err := http.NewRequest(method, target, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			if retryable && !last {
+				c.sleep(backoff(attempt))
+				continue
+			}
+			return fmt.Errorf("GitHub API %s %s failed: %w", method, path, err)
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("GitHub API %s %s failed: %w", method, path, err)
+		}
+
+		if wait, limited := rateLimitWait(resp); limited && !last {
+			if wait > githubMaxRateLimitWait {
+				return fmt.Errorf("GitHub API rate limit exceeded; try again after %s", time.Now().Add(wait).Format("15:04"))
+			}
+			c.sleep(wait)
+			continue
+		}
+		if resp.StatusCode >= 500 && retryable && !last {
+			c.sleep(backoff(attempt))
+			continue
+		}
+		if resp.StatusCode >= 300 {
+			return &githubAPIError{method: method, path: path, status: resp.StatusCode, message: githubErrorMessage(data)}
+		}
+		if out != nil && len(data) > 0 {
+			if err := json.Unmarshal(data, out); err != nil {
+				return fmt.Errorf("failed to parse GitHub API response: %w", err)
+			}
+		}
+		return nil
+	}
+}
+
+// backoff is the pause before retry attempt+1: 1s, 2s, 4s...
+func backoff(attempt int) time.Duration {
+	return time.Second << (attempt - 1)
+}
+
+// rateLimitWait reports whether resp says the client is rate limited, and
+// how long to wait before trying again.
+func rateLimitWait(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		return time.Duration(s) * time.Second, true
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			return max(time.Until(time.Unix(reset, 0)), time.Second), true
+		}
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		// secondary rate limits without headers: GitHub asks for a minute
+		return time.Minute, true
+	}
+	return 0, false
+}
+
+// githubErrorMessage extracts the message of a GitHub API error response.
+func githubErrorMessage(data []byte) string {
+	var body struct {
+		Message string `json:"message"`
+		Errors  []struct {
+			Message string `json:"message"`
+			Code    string `json:"code"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(data, &body) != nil || body.Message == "" {
+		return strings.TrimSpace(string(data))
+	}
+	msg := body.Message
+	for _, e := range body.Errors {
+		if e.Message != "" {
+			msg += ": " + e.Message
+		} else if e.Code != "" {
+			msg += ": " + e.Code
+		}
+	}
+	return msg
+}
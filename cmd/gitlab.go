@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// gitlabForge talks to GitLab merge requests through the glab CLI. Reads go
+// through `glab api`, which fills in the project of the current repository
+// for :id.
+type gitlabForge struct {
+	cli forgeCLI
+}
+
+// gitlabMR is the part of a GitLab merge request prki reads.
+type gitlabMR struct {
+	IID                 int    `json:"iid"`
+	Title               string `json:"title"`
+	SourceBranch        string `json:"source_branch"`
+	TargetBranch        string `json:"target_branch"`
+	State               string `json:"state"` // opened, closed, locked or merged
+	HasConflicts        bool   `json:"has_conflicts"`
+	DetailedMergeStatus string `json:"detailed_merge_status"`
+	HeadPipeline        *struct {
+		Status string `json:"status"`
+	} `json:"head_pipeline"`
+}
+
+func (f gitlabForge) CreatePR(pr NewPR) (string, error) {
+	args := []string{
+		"mr", "create",
+		"--target-branch", pr.Base,
+		"--source-branch", pr.Head,
+		"--title", pr.Title,
+		"--description", pr.Body,
+		"--yes",
+	}
+	if pr.Draft {
+		args = append(args, "--draft")
+	}
+	if len(pr.Labels) > 0 {
+		args = append(args, "--label", strings.Join(pr.Labels, ","))
+	}
+	if len(pr.Reviewers) > 0 {
+		args = append(args, "--reviewer", strings.Join(pr.Reviewers, ","))
+	}
+	out, err := f.cli.write(args...)
+	if err != nil {
+		return "", err
+	}
+	// glab prints some progress before the URL
+	lines := strings.Split(out, "\n")
+	return strings.TrimSpace(lines[len(lines)-1]), nil
+}
+
+func (f gitlabForge) ListPRs(base, state string) ([]ChildPR, error) {
+	query := url.Values{"target_branch": {base}, "per_page": {"100"}}
+	switch state {
+	case "open":
+		query.Set("state", "opened")
+	case "merged", "closed":
+		query.Set("state", state)
+	}
+	var mrs []gitlabMR
+	if err := f.api("projects/:id/merge_requests?"+query.Encode(), &mrs); err != nil {
+		return nil, err
+	}
+	prs := make([]ChildPR, 0, len(mrs))
+	for _, mr := range mrs {
+		pr := ChildPR{Number: mr.IID, Title: mr.Title, HeadRefName: mr.SourceBranch, State: strings.ToUpper(mr.State)}
+		if mr.State == "opened" {
+			// the list leaves out the pipeline, and approvals have their own endpoint
+			var err error
+			if pr, err = f.ChildPR(mr.IID); err != nil {
+				return nil, err
+			}
+		}
+		prs = append(prs, pr)
+	}
+	return prs, nil
+}
+
+func (f gitlabForge) ChildPR(number int) (ChildPR, error) {
+	var mr gitlabMR
+	if err := f.api(fmt.Sprintf("projects/:id/merge_requests/%d", number), &mr); err != nil {
+		if strings.Contains(err.Error(), "404") {
+			return ChildPR{}, fmt.Errorf("merge request !%d not found", number)
+		}
+		return ChildPR{}, err
+	}
+	pr := ChildPR{Number: mr.IID, Title: mr.Title, HeadRefName: mr.SourceBranch, State: strings.ToUpper(mr.State)}
+	if mr.State != "opened" {
+		return pr, nil
+	}
+	var approvals struct {
+		Approved bool `json:"approved"`
+	}
+	if err := f.api(fmt.Sprintf("projects/:id/merge_requests/%d/approvals", number), &approvals); err != nil {
+		return ChildPR{}, err
+	}
+	pr.State = "OPEN"
+	pr.ReviewDecision = gitlabReviewDecision(approvals.Approved, mr.DetailedMergeStatus)
+	pr.Mergeable = "MERGEABLE"
+	if mr.HasConflicts {
+		pr.Mergeable = "CONFLICTING"
+	}
+	if mr.HeadPipeline != nil {
+		pr.StatusCheckRollup = []CheckStatus{gitlabPipelineCheck(mr.HeadPipeline.Status)}
+	}
+	return pr, nil
+}
+
+// gitlabReviewDecision maps the approval state of a merge request to
+// GitHub's review decisions.
+func gitlabReviewDecision(approved bool, mergeStatus string) string {
+	switch {
+	case mergeStatus == "requested_changes" || mergeStatus == "discussions_not_resolved":
+		return "CHANGES_REQUESTED"
+	case approved:
+		return "APPROVED"
+	default:
+		return "REVIEW_REQUIRED"
+	}
+}
+
+// gitlabPipelineCheck maps a pipeline status to a commit status.
+func gitlabPipelineCheck(status string) CheckStatus {
+	c := CheckStatus{Context: "pipeline"}
+	switch status {
+	case "success", "skipped", "manual":
+		c.State = "SUCCESS"
+	case "failed":
+		c.State = "FAILURE"
+	case "canceled":
+		c.Conclusion = "CANCELLED"
+	default: // created, waiting_for_resource, preparing, pending, running, scheduled
+		c.State = "PENDING"
+	}
+	return c
+}
+
+func (f gitlabForge) PR(number int) (*prInfo, error) {
+	var mr gitlabMR
+	if err := f.api(fmt.Sprintf("projects/:id/merge_requests/%d", number), &mr); err != nil {
+		if strings.Contains(err.Error(), "404") {
+			return nil, fmt.Errorf("merge request !%d not found", number)
+		}
+		return nil, err
+	}
+	return &prInfo{Number: mr.IID, BaseRefName: mr.TargetBranch, HeadRefName: mr.SourceBranch}, nil
+}
+
+func (f gitlabForge) FindPR(head string) (int, error) {
+	query := url.Values{"source_branch": {head}, "state": {"opened"}}
+	var mrs []gitlabMR
+	if err := f.api("projects/:id/merge_requests?"+query.Encode(), &mrs); err != nil {
+		return 0, err
+	}
+	if len(mrs) == 0 {
+		return 0, nil
+	}
+	return mrs[0].IID, nil
+}
+
+func (f gitlabForge) Comment(number int, body string) error {
+	_, err := f.cli.write("mr", "note", strconv.Itoa(number), "--message", body)
+	return err
+}
+
+func (f gitlabForge) EditBody(number int, body string) error {
+	_, err := f.cli.write("mr", "update", strconv.Itoa(number), "--description", body)
+	return err
+}
+
+func (f gitlabForge) Merge(number int, method string) error {
+	args := []string{"mr", "merge", strconv.Itoa(number), "--yes"}
+	switch method {
+	case "squash":
+		args = append(args, "--squash")
+	case "rebase":
+		args = append(args, "--rebase")
+	}
+	_, err := f.cli.write(args...)
+	return err
+}
+
+func (f gitlabForge) Close(number int, comment string) error {
+	if err := f.Comment(number, comment); err != nil {
+		return err
+	}
+	_, err := f.cli.write("mr", "close", strconv.Itoa(number))
+	return err
+}
+
+func (f gitlabForge) HeadRef(number int) string {
+	return fmt.Sprintf("refs/merge-requests/%d/head", number)
+}
+
+// api GETs a GitLab REST endpoint and decodes the JSON response into v.
+func (f gitlabForge) api(endpoint string, v any) error {
+	out, err := f.cli.read("api", endpoint)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(out), v); err != nil {
+		return fmt.Errorf("failed to parse glab output: %w", err)
+	}
+	return nil
+}
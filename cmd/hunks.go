@@ -0,0 +1,276 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Hunk is one hunk of a file's diff, taken without context lines (-U0) so
+// that every change is a hunk of its own.
+type Hunk struct {
+	Index    int // 1-based position in the file's diff
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Header   string // text after the closing @@, usually the enclosing function
+	Body     string // the -/+ lines, each ending in a newline
+}
+
+// Partial reports whether f covers only some of the hunks of its file.
+func (f *FileChange) Partial() bool {
+	return len(f.Hunks) > 0 && len(f.Hunks) < f.hunkCount
+}
+
+// HunkIndexes returns the indexes of the hunks f covers.
+func (f *FileChange) HunkIndexes() []int {
+	indexes := make([]int, len(f.Hunks))
+	for i, h := range f.Hunks {
+		indexes[i] = h.Index
+	}
+	return indexes
+}
+
+// withHunks returns f narrowed down to hunks, with the line counts and
+// complexity of just those hunks.
+func (f FileChange) withHunks(hunks []Hunk) FileChange {
+	total := f.TotalLines()
+	f.Hunks = slices.SortedFunc(slices.Values(hunks), func(a, b Hunk) int { return a.Index - b.Index })
+	f.LinesAdded, f.LinesDeleted = 0, 0
+	for _, h := range hunks {
+		f.LinesAdded += h.NewLines
+		f.LinesDeleted += h.OldLines
+	}
+	if total > 0 {
+		f.Complexity = f.Complexity * f.TotalLines() / total
+	}
+	return f
+}
+
+// joinHunks combines the entries of files that cover hunks of the same
+// file into one, in place of the first, so that the hunks go into a single
+// patch. An entry for the whole file absorbs the others, and once every
+// hunk is covered the entry stands for the whole file again.
+func joinHunks(files []FileChange) []FileChange {
+	first := map[string]int{}
+	var joined []FileChange
+	for _, f := range files {
+		i, ok := first[f.Path]
+		if !ok {
+			first[f.Path] = len(joined)
+			joined = append(joined, f)
+			continue
+		}
+		g := joined[i]
+		if !g.Partial() || !f.Partial() {
+			if g.Partial() {
+				joined[i] = f
+			}
+			continue
+		}
+		hunks := slices.Clone(g.Hunks)
+		for _, h := range f.Hunks {
+			if !slices.ContainsFunc(hunks, func(o Hunk) bool { return o.Index == h.Index }) {
+				hunks = append(hunks, h)
+			}
+		}
+		joined[i] = g.withHunks(hunks)
+		joined[i].Complexity = g.Complexity + f.Complexity
+	}
+	return joined
+}
+
+// hunkDiffArgs are added to a git diff range to get the hunks of one file.
+// The prefixes are pinned so that diff.noprefix and friends cannot change
+// the patch that is applied later.
+var hunkDiffArgs = []string{"-U0", "--no-color", "--no-ext-diff", "--no-textconv", "--src-prefix=a/", "--dst-prefix=b/"}
+
+// loadHunks reads the hunks of every modified text file in files from
+// `git <diffRange> -U0 -- <path>`, where diffRange is e.g. ["diff", mb, head].
+func loadHunks(files []FileChange, diffRange []string) error {
+	for i := range files {
+		f := &files[i]
+		if f.Binary || f.Status != statusModified {
+			continue
+		}
+		args := append(append(append([]string{}, diffRange...), hunkDiffArgs...), "--", f.Path)
+		out, err := gitOutputEnv([]string{literalPathspecs}, args...)
+		if err != nil {
+			return fmt.Errorf("failed to read the hunks of %s: %w", f.Path, err)
+		}
+		f.patchHeader, f.Hunks = parseHunks(out)
+		f.hunkCount = len(f.Hunks)
+	}
+	return nil
+}
+
+var hunkHeaderRe = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@ ?(.*)$`)
+
+// parseHunks splits the -U0 diff of a single file into the lines before the
+// first hunk (diff --git, index, ---, +++) and its hunks.
+func parseHunks(diff string) (header string, hunks []Hunk) {
+	var head, body strings.Builder
+	var cur *Hunk
+	flush := func() {
+		if cur != nil {
+			cur.Body = body.String()
+			hunks = append(hunks, *cur)
+			body.Reset()
+		}
+	}
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		if line == "" {
+			continue
+		}
+		if m := hunkHeaderRe.FindStringSubmatch(strings.TrimRight(line, "\n")); m != nil {
+			flush()
+			cur = &Hunk{
+				Index:    len(hunks) + 1,
+				OldStart: atoiOr(m[1], 0),
+				OldLines: atoiOr(m[2], 1),
+				NewStart: atoiOr(m[3], 0),
+				NewLines: atoiOr(m[4], 1),
+				Header:   m[5],
+			}
+			continue
+		}
+		if cur == nil {
+			head.WriteString(line)
+			continue
+		}
+		if !strings.HasSuffix(line, "\n") {
+			line += "\n"
+		}
+		body.WriteString(line)
+	}
+	flush()
+	return head.String(), hunks
+}
+
+func atoiOr(s string, def int) int {
+	if s == "" {
+		return def
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// hunkPatch renders the hunks f covers as a patch against the file's old
+// version, for git apply --unidiff-zero. Hunks that are left out shift the
+// lines of the following ones, so the new positions are recomputed from the
+// old ones.
+func hunkPatch(f FileChange) string {
+	var sb strings.Builder
+	sb.WriteString(f.patchHeader)
+	offset := 0
+	for _, h := range f.Hunks {
+		newStart := h.OldStart + offset
+		if h.OldLines == 0 {
+			newStart++ // a pure addition goes after line OldStart
+		}
+		if h.NewLines == 0 {
+			newStart-- // a pure deletion is reported at the line before it
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, newStart, h.NewLines)
+		if h.Header != "" {
+			sb.WriteString(" " + h.Header)
+		}
+		sb.WriteString("\n")
+		sb.WriteString(h.Body)
+		offset += h.NewLines - h.OldLines
+	}
+	return sb.String()
+}
+
+// groupByHunk groups like the default strategy, but splits files that mix
+// rewrites of existing lines with pure additions: the hunks that change or
+// delete lines go to a Refactoring group, and the added code stays with the
+// file's group. See refactoringPosition for where Refactoring is merged.
+//
+// This is a heuristic on the shape of the hunks only. A feature edit of an
+// existing line, such as a changed condition, also counts as refactoring;
+// the README says so, and prki plan lets users move such hunks back.
+func groupByHunk(files []FileChange) []FileGroup {
+	var rest, refactoring []FileChange
+	for _, f := range files {
+		var changed, added []Hunk
+		for _, h := range f.Hunks {
+			if h.OldLines > 0 {
+				changed = append(changed, h)
+			} else {
+				added = append(added, h)
+			}
+		}
+		if len(changed) == 0 || len(added) == 0 {
+			rest = append(rest, f)
+			continue
+		}
+		refactoring = append(refactoring, f.withHunks(changed))
+		rest = append(rest, f.withHunks(added))
+	}
+
+	groups := groupByConfig(rest)
+	if len(refactoring) == 0 {
+		return groups
+	}
+	if i := slices.IndexFunc(groups, func(g FileGroup) bool { return g.Name == refactoringGroup }); i >= 0 {
+		groups[i].Files = joinHunks(append(groups[i].Files, refactoring...))
+		return groups
+	}
+	at := refactoringPosition(groups, activeConfig.groupingRules())
+	groups = slices.Insert(groups, at, FileGroup{Name: refactoringGroup, Files: refactoring})
+	for i := range groups {
+		groups[i].Order = i + 1
+	}
+	return groups
+}
+
+const refactoringGroup = "Refactoring"
+
+// refactoringPosition returns where the Refactoring group goes among groups.
+// A grouping rule named Refactoring places it by its order, like any other
+// rule. Otherwise it goes right after the group merged first, the first rule
+// or Infrastructure & Config, which other code tends to build on.
+func refactoringPosition(groups []FileGroup, rules []compiledRule) int {
+	if len(rules) == 0 {
+		if len(groups) > 0 && groups[0].Name == "Infrastructure & Config" {
+			return 1
+		}
+		return 0
+	}
+	sorted := slices.Clone(rules)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].order < sorted[j].order })
+	rank := func(name string) int {
+		if i := slices.IndexFunc(sorted, func(r compiledRule) bool { return r.name == name }); i >= 0 {
+			return i
+		}
+		return len(sorted) // Other
+	}
+	if r := rank(refactoringGroup); r < len(sorted) {
+		at := 0
+		for at < len(groups) && rank(groups[at].Name) < r {
+			at++
+		}
+		return at
+	}
+	if len(groups) > 0 && groups[0].Name == sorted[0].name {
+		return 1
+	}
+	return 0
+}
+
+// joinInts formats hunk indexes as "1, 3".
+func joinInts(ns []int) string {
+	s := make([]string, len(ns))
+	for i, n := range ns {
+		s[i] = strconv.Itoa(n)
+	}
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,234 @@
+package cmd
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sampleHunkDiff = `diff --git a/calc.go b/calc.go
+index 1111111..2222222 100644
+--- a/calc.go
++++ b/calc.go
+@@ -3 +3 @@ package calc
+-func add(a, b int) int { return a+b }
++func add(a, b int) int { return a + b }
+@@ -5,0 +6,2 @@ func add(a, b int) int { return a+b }
++
++func sub(a, b int) int { return a - b }
+@@ -8,2 +9,0 @@ func mul(a, b int) int { return a * b }
+-// old comment
+-// another
+\ No newline at end of file
+`
+
+func TestParseHunks(t *testing.T) {
+	header, hunks := parseHunks(sampleHunkDiff)
+	if !strings.HasPrefix(header, "diff --git a/calc.go b/calc.go\n") || !strings.HasSuffix(header, "+++ b/calc.go\n") {
+		t.Errorf("header = %q", header)
+	}
+	want := []Hunk{
+		{Index: 1, OldStart: 3, OldLines: 1, NewStart: 3, NewLines: 1, Header: "package calc",
+			Body: "-func add(a, b int) int { return a+b }\n+func add(a, b int) int { return a + b }\n"},
+		{Index: 2, OldStart: 5, OldLines: 0, NewStart: 6, NewLines: 2, Header: "func add(a, b int) int { return a+b }",
+			Body: "+\n+func sub(a, b int) int { return a - b }\n"},
+		{Index: 3, OldStart: 8, OldLines: 2, NewStart: 9, NewLines: 0, Header: "func mul(a, b int) int { return a * b }",
+			Body: "-// old comment\n-// another\n\\ No newline at end of file\n"},
+	}
+	if !reflect.DeepEqual(hunks, want) {
+		t.Errorf("hunks =\n%+v\nwant\n%+v", hunks, want)
+	}
+}
+
+func TestHunkPatch_RenumbersSkippedHunks(t *testing.T) {
+	header, hunks := parseHunks(sampleHunkDiff)
+	f := FileChange{Path: "calc.go", Status: statusModified, Hunks: hunks, hunkCount: len(hunks), patchHeader: header}
+
+	tests := []struct {
+		hunks []Hunk
+		want  []string
+	}{
+		{hunks, []string{"@@ -3,1 +3,1 @@", "@@ -5,0 +6,2 @@", "@@ -8,2 +9,0 @@"}},
+		{[]Hunk{hunks[0], hunks[2]}, []string{"@@ -3,1 +3,1 @@", "@@ -8,2 +7,0 @@"}},
+		{[]Hunk{hunks[2]}, []string{"@@ -8,2 +7,0 @@"}},
+		{[]Hunk{hunks[1]}, []string{"@@ -5,0 +6,2 @@"}},
+	}
+	for _, tt := range tests {
+		patch := hunkPatch(f.withHunks(tt.hunks))
+		var got []string
+		for _, line := range strings.Split(patch, "\n") {
+			if strings.HasPrefix(line, "@@") {
+				got = append(got, line[:strings.LastIndex(line, "@@")+2])
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("hunk headers = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestFileChange_WithHunks(t *testing.T) {
+	_, hunks := parseHunks(sampleHunkDiff)
+	f := FileChange{Path: "calc.go", LinesAdded: 3, LinesDeleted: 3, Complexity: 12, Hunks: hunks, hunkCount: 3}
+	if f.Partial() {
+		t.Error("a file with all its hunks is not partial")
+	}
+
+	part := f.withHunks([]Hunk{hunks[2], hunks[1]})
+	if !part.Partial() || !reflect.DeepEqual(part.HunkIndexes(), []int{2, 3}) {
+		t.Errorf("withHunks() = %+v, want hunks 2 and 3 in order", part)
+	}
+	if part.LinesAdded != 2 || part.LinesDeleted != 2 || part.Complexity != 8 {
+		t.Errorf("withHunks() counts = +%d/-%d complexity %d, want +2/-2 complexity 8", part.LinesAdded, part.LinesDeleted, part.Complexity)
+	}
+	if got := part.Summary(); got != "(2 of 3 hunks, +2/-2 lines)" {
+		t.Errorf("Summary() = %q", got)
+	}
+}
+
+func TestJoinHunks(t *testing.T) {
+	_, hunks := parseHunks(sampleHunkDiff)
+	f := FileChange{Path: "calc.go", LinesAdded: 3, LinesDeleted: 3, Complexity: 12, Hunks: hunks, hunkCount: 3}
+	other := FileChange{Path: "other.go", LinesAdded: 1}
+	first, second, third := f.withHunks(hunks[2:]), f.withHunks(hunks[:1]), f.withHunks(hunks[1:2])
+
+	joined := joinHunks([]FileChange{first, other, second})
+	if len(joined) != 2 || joined[1].Path != "other.go" {
+		t.Fatalf("joinHunks() = %+v, want calc.go and other.go", joined)
+	}
+	if got := joined[0]; !got.Partial() || !reflect.DeepEqual(got.HunkIndexes(), []int{1, 3}) || got.TotalLines() != 4 {
+		t.Errorf("joinHunks() = %+v, want hunks 1 and 3 of calc.go", got)
+	}
+	if got := joinHunks([]FileChange{first, second, third})[0]; got.Partial() || got.TotalLines() != 6 || got.Complexity != 12 {
+		t.Errorf("joinHunks() of every hunk = %+v, want the whole file", got)
+	}
+	if got := joinHunks([]FileChange{first, f}); len(got) != 1 || got[0].Partial() {
+		t.Errorf("joinHunks() with the whole file = %+v", got)
+	}
+}
+
+func TestGroupByHunk(t *testing.T) {
+	_, hunks := parseHunks(sampleHunkDiff)
+	files := []FileChange{
+		{Path: "calc.go", Status: statusModified, LinesAdded: 3, LinesDeleted: 3, Hunks: hunks, hunkCount: 3},
+		{Path: "go.mod", Status: statusModified, LinesAdded: 1},
+		{Path: "README.md", Status: statusModified, LinesAdded: 1},
+	}
+	groups := groupByHunk(files)
+
+	var got []string
+	for _, g := range groups {
+		var desc []string
+		for _, f := range g.Files {
+			desc = append(desc, f.Path+joinIntsIfAny(f.HunkIndexes()))
+		}
+		got = append(got, g.Name+": "+strings.Join(desc, " "))
+		if g.Order != len(got) {
+			t.Errorf("%s has order %d, want %d", g.Name, g.Order, len(got))
+		}
+	}
+	want := []string{
+		"Infrastructure & Config: go.mod",
+		"Refactoring: calc.go[1, 3]",
+		"Core Business Logic: calc.go[2]",
+		"Documentation: README.md",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("groupByHunk() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestGroupByHunk_UsesConfigRules(t *testing.T) {
+	_, hunks := parseHunks(sampleHunkDiff)
+	files := []FileChange{
+		{Path: "calc.go", Status: statusModified, LinesAdded: 3, LinesDeleted: 3, Hunks: hunks, hunkCount: 3},
+		{Path: "go.mod", Status: statusModified, LinesAdded: 1},
+		{Path: "README.md", Status: statusModified, LinesAdded: 1},
+	}
+	tests := []struct {
+		name   string
+		config string
+		want   []string
+	}{
+		{
+			"after the first rule",
+			"grouping:\n  - name: Modules\n    patterns: ['go.mod']\n  - name: Go\n    patterns: ['*.go']\n",
+			[]string{"Modules: go.mod", "Refactoring: calc.go[1, 3]", "Go: calc.go[2]", "Other: README.md"},
+		},
+		{
+			"by a Refactoring rule",
+			"grouping:\n  - name: Go\n    patterns: ['*.go']\n    order: 1\n  - name: Refactoring\n    patterns: ['*.rs']\n    order: 2\n  - name: Modules\n    patterns: ['go.mod']\n    order: 3\n",
+			[]string{"Go: calc.go[2]", "Refactoring: calc.go[1, 3]", "Modules: go.mod", "Other: README.md"},
+		},
+	}
+	t.Cleanup(func() { activeConfig = nil })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseConfig(".prki.yaml", []byte(tt.config))
+			if err != nil {
+				t.Fatal(err)
+			}
+			activeConfig = cfg
+
+			var got []string
+			for _, g := range groupFiles(files, "hunk") {
+				var desc []string
+				for _, f := range g.Files {
+					desc = append(desc, f.Path+joinIntsIfAny(f.HunkIndexes()))
+				}
+				got = append(got, g.Name+": "+strings.Join(desc, " "))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("groupFiles(hunk) =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func joinIntsIfAny(ns []int) string {
+	if len(ns) == 0 {
+		return ""
+	}
+	return "[" + joinInts(ns) + "]"
+}
+
+func TestExecutePlan_Hunks(t *testing.T) {
+	dir := newTestRepo(t)
+	writeFile(t, dir, "calc.go", "package calc\n\nfunc add(a, b int) int { return a+b }\n\nfunc mul(a, b int) int { return a*b }\n\n// helpers\n")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "calc")
+	runGit(t, dir, "checkout", "-q", "-b", "feature")
+	writeFile(t, dir, "calc.go", "package calc\n\nfunc add(a, b int) int { return a + b }\n\nfunc mul(a, b int) int { return a * b }\n\n// helpers\n\nfunc sub(a, b int) int { return a - b }\n")
+	runGit(t, dir, "commit", "-q", "-am", "feature")
+
+	files, err := getChangedFiles(diffOptions{Base: "main", Hunks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || len(files[0].Hunks) != 3 {
+		t.Fatalf("files = %+v, want calc.go with 3 hunks", files)
+	}
+	src, err := newSplitContext("feature", "main", modeBranch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.out, src.auto, src.local = io.Discard, true, true
+	p := newPlan(src, modeBranch, groupByHunk(files))
+	if got := p.Groups[0].Hunks; len(got) != 1 || !reflect.DeepEqual(got[0].Hunks, []int{1, 2}) {
+		t.Fatalf("plan = %+v, want the two rewrites in Refactoring", p.Groups)
+	}
+	if err := p.validate(files); err != nil {
+		t.Fatalf("validate() = %v", err)
+	}
+	if err := executePlan(p, files, src, "json"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := runGit(t, dir, "show", "review/refactoring:calc.go"); got != "package calc\n\nfunc add(a, b int) int { return a + b }\n\nfunc mul(a, b int) int { return a * b }\n\n// helpers" {
+		t.Errorf("review/refactoring has calc.go =\n%s", got)
+	}
+	if got := runGit(t, dir, "show", "review/core-business-logic:calc.go"); got != "package calc\n\nfunc add(a, b int) int { return a+b }\n\nfunc mul(a, b int) int { return a*b }\n\n// helpers\n\nfunc sub(a, b int) int { return a - b }" {
+		t.Errorf("review/core-business-logic has calc.go =\n%s", got)
+	}
+}
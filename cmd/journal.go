@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Kinds of journaled split actions.
+const (
+	actionBranch   = "branch"    // local branch created
+	actionCommit   = "commit"    // commit made for a child branch; unreferenced until the branch action
+	actionPush     = "push"      // branch pushed to origin
+	actionPR       = "pr"        // child PR opened
+	actionTree     = "tree"      // split tree committed to Branch, a refs/prki/tree/ ref
+	actionTreePush = "tree-push" // split tree ref pushed to origin
+)
+
+// Comments a rollback leaves on the child PRs it closes.
+const (
+	closedByRollback     = "Closed by `prki split --rollback`."
+	closedBySplitFailure = "Closed because `prki split` failed and was rolled back."
+)
+
+// journal records what a split did, so that it can be undone: automatically
+// when the split fails half-way, or later with prki split --rollback.
+type journal struct {
+	Parent  string          `json:"parent"`
+	Head    string          `json:"head"` // HEAD commit when the split started
+	Actions []journalAction `json:"actions"`
+
+	path string
+}
+
+type journalAction struct {
+	Kind   string `json:"kind"`
+	Branch string `json:"branch"`
+	Commit string `json:"commit,omitempty"` // branch tip after a branch or commit action
+	PR     string `json:"pr,omitempty"`     // PR URL of a pr action
+	// Previous is the tree ref's commit before a tree action; empty when the
+	// split created the ref.
+	Previous string `json:"previous,omitempty"`
+}
+
+// journalPath is where the journal of the last split lives, inside .git
+// next to the default plan.
+func journalPath() (string, error) {
+	return activeGit.GitPath("prki/journal.json")
+}
+
+// startJournal replaces the journal of the previous split with an empty one.
+func startJournal(parent string) (*journal, error) {
+	path, err := journalPath()
+	if err != nil {
+		return nil, err
+	}
+	head, err := activeGit.RevParse("HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+	j := &journal{Parent: parent, Head: head, Actions: []journalAction{}, path: path}
+	return j, j.save()
+}
+
+func loadJournal() (*journal, error) {
+	path, err := journalPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("nothing to roll back: no split journal at %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read split journal: %w", err)
+	}
+	j := &journal{path: path}
+	if err := json.Unmarshal(data, j); err != nil {
+		return nil, fmt.Errorf("%s: invalid split journal: %w", path, err)
+	}
+	return j, nil
+}
+
+func (j *journal) save() error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(j.path), 0o755); err != nil {
+		return fmt.Errorf("failed to write split journal: %w", err)
+	}
+	if err := os.WriteFile(j.path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write split journal: %w", err)
+	}
+	return nil
+}
+
+// record appends a to the journal and saves it right away, so that a crash
+// does not lose track of what was created. A nil journal records nothing.
+func (j *journal) record(a journalAction) error {
+	if j == nil {
+		return nil
+	}
+	j.Actions = append(j.Actions, a)
+	return j.save()
+}
+
+// branches returns the child branches the journal created.
+func (j *journal) branches() []string {
+	var branches []string
+	for _, a := range j.Actions {
+		if a.Kind == actionBranch {
+			branches = append(branches, a.Branch)
+		}
+	}
+	return branches
+}
+
+// tip returns the last commit the split left on branch.
+func (j *journal) tip(branch string) string {
+	tip := ""
+	for _, a := range j.Actions {
+		if a.Branch == branch && a.Commit != "" {
+			tip = a.Commit
+		}
+	}
+	return tip
+}
+
+// rollback undoes the journaled actions in reverse order: it closes the PRs,
+// deletes the pushed and local branches and restores the split tree. If a
+// child branch is checked out, the parent is checked out first. Branches
+// that moved since the split are left alone. Actions that could not be
+// undone stay in the journal, so rollback can be retried; the journal is
+// removed otherwise. comment is left on the closed PRs.
+func (j *journal) rollback(out io.Writer, comment string) error {
+	var errs []error
+	if current, err := getCurrentBranch(); err == nil && contains(j.branches(), current) {
+		target := j.Parent
+		if target == "HEAD" { // the split started on a detached HEAD
+			target = j.Head
+		}
+		if err := activeGit.Checkout(target); err != nil {
+			return fmt.Errorf("could not return to %s: %w", j.Parent, err)
+		}
+	}
+
+	var failed []journalAction
+	for i := len(j.Actions) - 1; i >= 0; i-- {
+		a := j.Actions[i]
+		var err error
+		switch a.Kind {
+		case actionPR:
+			fmt.Fprintf(out, "  Closing %s...\n", a.PR)
+			err = closePR(a.PR, comment)
+		case actionPush:
+			fmt.Fprintf(out, "  Deleting origin/%s...\n", a.Branch)
+			err = deleteRemoteBranch(a.Branch, j.tip(a.Branch))
+		case actionBranch:
+			fmt.Fprintf(out, "  Deleting branch %s...\n", a.Branch)
+			err = deleteLocalBranch(a.Branch, j.tip(a.Branch))
+		case actionTreePush:
+			fmt.Fprintf(out, "  Restoring origin %s...\n", a.Branch)
+			err = restoreRemoteTreeRef(a.Branch, a.Commit, a.Previous)
+		case actionTree:
+			fmt.Fprintf(out, "  Restoring %s...\n", a.Branch)
+			err = restoreTreeRef(a.Branch, a.Commit, a.Previous)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", a.Kind, a.Branch, err))
+			failed = append([]journalAction{a}, failed...)
+		}
+	}
+
+	if len(errs) > 0 {
+		j.Actions = failed
+		if err := j.save(); err != nil {
+			errs = append(errs, err)
+		}
+		return errors.Join(errs...)
+	}
+	if err := os.Remove(j.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// deleteLocalBranch deletes branch if it still points at tip.
+func deleteLocalBranch(branch, tip string) error {
+	current, err := activeGit.RevParse("refs/heads/" + branch)
+	if err != nil {
+		return nil // already gone
+	}
+	if tip != "" && current != tip {
+		return fmt.Errorf("branch moved since the split (now %s); delete it by hand if it is not needed", shortSHA(current))
+	}
+	return activeGit.DeleteBranch(branch)
+}
+
+// deleteRemoteBranch deletes branch on origin, unless someone pushed to it
+// since the split.
+func deleteRemoteBranch(branch, tip string) error {
+	return activeGit.Push("refs/heads/"+branch, "", tip)
+}
+
+// closePR closes the PR at url with comment.
+func closePR(url, comment string) error {
+	n, err := prNumberFromURL(url)
+	if err != nil {
+		return err
+	}
+	return currentForge(nil).Close(n, comment)
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
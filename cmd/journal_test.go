@@ -0,0 +1,362 @@
+package cmd
+
+import (
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// newTestRepoWithOrigin is newTestRepo with a bare repository as origin.
+func newTestRepoWithOrigin(t *testing.T) (dir, origin string) {
+	t.Helper()
+	dir = newTestRepo(t)
+	origin = filepath.Join(t.TempDir(), "origin.git")
+	runGit(t, dir, "init", "-q", "--bare", origin)
+	runGit(t, dir, "remote", "add", "origin", origin)
+	runGit(t, dir, "push", "-q", "origin", "main")
+	return dir, origin
+}
+
+func twoGroupPlan(parent, mode string) *Plan {
+	return &Plan{
+		Version: planVersion,
+		Parent:  parent,
+		Mode:    mode,
+		Groups: []PlanGroup{
+			{Name: "Code", Branch: "split/code", Order: 1, Files: []string{"edited.go"}},
+			{Name: "Docs", Branch: "split/docs", Order: 2, Files: []string{"README.md"}},
+		},
+	}
+}
+
+func TestExecutePlan_RollsBackOnFailure(t *testing.T) {
+	dir, origin := newTestRepoWithOrigin(t)
+	runGit(t, dir, "branch", "split/docs") // makes the second child branch fail
+	writeFile(t, dir, "edited.go", "package a\n\nfunc f() {}\n")
+	writeFile(t, dir, "README.md", "# a\n")
+	statusBefore := runGit(t, dir, "status", "--porcelain")
+
+	files, err := getChangedFiles(diffOptions{Mode: modeWorktree})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := newSplitContext("main", "", modeWorktree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.out, src.auto = io.Discard, true
+	err = executePlan(twoGroupPlan("main", "worktree"), files, src, "json")
+	if err == nil || !strings.Contains(err.Error(), "rolled back") {
+		t.Fatalf("executePlan() error = %v, want a rollback", err)
+	}
+
+	if got := runGit(t, dir, "branch", "--list", "split/*"); got != "split/docs" {
+		t.Errorf("local branches after rollback: %q", got)
+	}
+	if got := runGit(t, origin, "branch", "--list"); got != "main" {
+		t.Errorf("origin branches after rollback: %q", got)
+	}
+	if got := runGit(t, dir, "status", "--porcelain"); got != statusBefore {
+		t.Errorf("working tree changed:\n%s", got)
+	}
+	path, _ := journalPath()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("journal left behind after a complete rollback: %v", err)
+	}
+}
+
+func TestExecutePlan_RollsBackBranchSplit(t *testing.T) {
+	dir := newTestRepo(t)
+	runGit(t, dir, "checkout", "-q", "-b", "feature")
+	writeFile(t, dir, "edited.go", "package a\n\nfunc f() {}\n")
+	writeFile(t, dir, "README.md", "# a\n")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "feature")
+	runGit(t, dir, "branch", "split/docs", "main")
+	head := runGit(t, dir, "rev-parse", "HEAD")
+
+	files, err := getChangedFiles(diffOptions{Base: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := newSplitContext("feature", "main", modeBranch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.out, src.auto = io.Discard, true
+	if err := executePlan(twoGroupPlan("feature", "branch"), files, src, "json"); err == nil {
+		t.Fatal("executePlan() should fail")
+	}
+
+	if got := runGit(t, dir, "rev-parse", "--abbrev-ref", "HEAD"); got != "feature" {
+		t.Errorf("HEAD is on %s after rollback", got)
+	}
+	if got := runGit(t, dir, "rev-parse", "HEAD"); got != head {
+		t.Errorf("feature moved to %s", got)
+	}
+	if got := runGit(t, dir, "branch", "--list", "split/code"); got != "" {
+		t.Errorf("split/code not deleted")
+	}
+}
+
+// useFeatureMemGit makes a memGit the activeGit whose feature branch, checked
+// out, changes edited.go and adds README.md on top of main. Both branches
+// are on origin.
+func useFeatureMemGit(t *testing.T) *memGit {
+	t.Helper()
+	g := useMemGit(t)
+	g.commit("main", map[string]string{"edited.go": "package a\n"})
+	if err := g.CreateBranch("feature", "main"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Checkout("feature"); err != nil {
+		t.Fatal(err)
+	}
+	g.commit("feature", map[string]string{"edited.go": "package a\n\nfunc f() {}\n", "README.md": "# a\n"})
+	g.push("main", "feature")
+	return g
+}
+
+// splitRefs returns the split/* branches and tree refs in refs.
+func splitRefs(refs map[string]string) []string {
+	var names []string
+	for ref := range refs {
+		if strings.Contains(ref, "/split/") || strings.HasPrefix(ref, "refs/prki/") {
+			names = append(names, ref)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestExecutePlan_ChildBranches(t *testing.T) {
+	g := useFeatureMemGit(t)
+	base := g.refs["refs/heads/main"]
+	g.commit("main", map[string]string{"later.txt": "merged after feature forked\n"})
+
+	files, err := getChangedFiles(diffOptions{Base: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := newSplitContext("feature", "main", modeBranch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.out, src.auto, src.local = io.Discard, true, true
+	if err := executePlan(twoGroupPlan("feature", "branch"), files, src, "json"); err != nil {
+		t.Fatal(err)
+	}
+
+	for branch, want := range map[string]map[string]string{
+		"split/code": {"edited.go": "package a\n\nfunc f() {}\n"},
+		"split/docs": {"edited.go": "package a\n", "README.md": "# a\n"},
+	} {
+		c := g.commits[g.refs["refs/heads/"+branch]]
+		if !slices.Equal(c.parents, []string{base}) {
+			t.Errorf("%s starts from %v, want the merge-base %s", branch, c.parents, base)
+		}
+		if !maps.Equal(c.files, want) {
+			t.Errorf("%s files = %v, want %v", branch, c.files, want)
+		}
+	}
+	tree := g.commits[g.refs[treeRef("feature")]]
+	if !strings.Contains(tree.files[treeFile], `"branch": "split/docs"`) {
+		t.Errorf("split tree not recorded:\n%s", tree.files[treeFile])
+	}
+	if got := splitRefs(g.origin); got != nil {
+		t.Errorf("a local split pushed %v", got)
+	}
+	if got, _ := getCurrentBranch(); got != "feature" {
+		t.Errorf("the split checked out %s", got)
+	}
+}
+
+func TestExecutePlan_PushFailure(t *testing.T) {
+	g := useFeatureMemGit(t)
+	files, err := getChangedFiles(diffOptions{Base: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := newSplitContext("feature", "main", modeBranch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	src.out, src.auto = &out, true
+
+	g.fail("push", "refs/heads/split/code", "fatal: unable to access 'https://example.com/': Could not resolve host")
+	err = executePlan(twoGroupPlan("feature", "branch"), files, src, "json")
+	if err == nil {
+		t.Fatal("executePlan() should fail when a push fails")
+	}
+
+	if !strings.Contains(out.String(), "Rolling back...") {
+		t.Errorf("output does not mention the rollback:\n%s", out.String())
+	}
+	if got := splitRefs(g.refs); got != nil {
+		t.Errorf("local refs left after rollback: %v", got)
+	}
+	if got := splitRefs(g.origin); got != nil {
+		t.Errorf("origin refs left after rollback: %v", got)
+	}
+}
+
+func TestExecutePlan_Local(t *testing.T) {
+	dir, origin := newTestRepoWithOrigin(t)
+	writeFile(t, dir, "edited.go", "package a\n\nfunc f() {}\n")
+	writeFile(t, dir, "README.md", "# a\n")
+	files, err := getChangedFiles(diffOptions{Mode: modeWorktree})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := newSplitContext("main", "", modeWorktree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.out, src.auto, src.local = io.Discard, true, true
+	if err := executePlan(twoGroupPlan("main", "worktree"), files, src, "json"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := runGit(t, dir, "branch", "--list", "split/*"); got != "split/code\n  split/docs" {
+		t.Errorf("local branches: %q", got)
+	}
+	if got := runGit(t, origin, "for-each-ref", "--format=%(refname)"); got != "refs/heads/main" {
+		t.Errorf("a local split pushed to origin: %q", got)
+	}
+}
+
+func TestJournalRollback_RemoteDeleteFails(t *testing.T) {
+	g := useMemGit(t)
+	base := g.commit("main", map[string]string{"a.txt": "a\n"})
+	if err := g.CreateBranch("split/a", base); err != nil {
+		t.Fatal(err)
+	}
+	g.push("split/a")
+	j, err := startJournal("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range []journalAction{
+		{Kind: actionBranch, Branch: "split/a", Commit: base},
+		{Kind: actionPush, Branch: "split/a"},
+	} {
+		if err := j.record(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	g.fail("push", "refs/heads/split/a", "fatal: the remote end hung up unexpectedly")
+	err = j.rollback(io.Discard, closedByRollback)
+	if err == nil || !strings.Contains(err.Error(), "push split/a: git push: fatal: the remote end hung up") {
+		t.Fatalf("rollback() error = %v", err)
+	}
+	if _, ok := g.refs["refs/heads/split/a"]; ok {
+		t.Errorf("local split/a not deleted")
+	}
+	if _, ok := g.origin["refs/heads/split/a"]; !ok {
+		t.Errorf("origin split/a deleted although the push failed")
+	}
+
+	// once the remote is back, the rollback can be finished
+	clear(g.failures)
+	left, err := loadJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left.Actions) != 1 || left.Actions[0].Kind != actionPush {
+		t.Fatalf("journal after failed rollback: %+v", left.Actions)
+	}
+	if err := left.rollback(io.Discard, closedByRollback); err != nil {
+		t.Fatal(err)
+	}
+	if got := splitRefs(g.origin); got != nil {
+		t.Errorf("origin refs left: %v", got)
+	}
+}
+
+func TestJournalRollback_LeavesCheckedOutChildBranch(t *testing.T) {
+	dir := newTestRepo(t)
+	base := runGit(t, dir, "rev-parse", "HEAD")
+	runGit(t, dir, "checkout", "-q", "-b", "split/a")
+
+	j, err := startJournal("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.record(journalAction{Kind: actionBranch, Branch: "split/a", Commit: base}); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.rollback(io.Discard, closedByRollback); err != nil {
+		t.Fatal(err)
+	}
+	if got := runGit(t, dir, "rev-parse", "--abbrev-ref", "HEAD"); got != "main" {
+		t.Errorf("HEAD is on %s after rollback", got)
+	}
+	if got := runGit(t, dir, "branch", "--list", "split/*"); got != "" {
+		t.Errorf("split/a not deleted")
+	}
+}
+
+func TestJournalRollback_KeepsMovedBranches(t *testing.T) {
+	dir, origin := newTestRepoWithOrigin(t)
+	base := runGit(t, dir, "rev-parse", "HEAD")
+	runGit(t, dir, "branch", "split/a")
+	runGit(t, dir, "branch", "split/b")
+	runGit(t, dir, "push", "-q", "origin", "split/a", "split/b")
+
+	j, err := startJournal("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range []journalAction{
+		{Kind: actionBranch, Branch: "split/a", Commit: base},
+		{Kind: actionPush, Branch: "split/a"},
+		{Kind: actionBranch, Branch: "split/b", Commit: base},
+		{Kind: actionPush, Branch: "split/b"},
+	} {
+		if err := j.record(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// someone pushes a fixup to split/b after the split
+	runGit(t, dir, "checkout", "-q", "split/b")
+	runGit(t, dir, "commit", "-q", "--allow-empty", "-m", "fixup")
+	runGit(t, dir, "push", "-q", "origin", "split/b")
+	runGit(t, dir, "checkout", "-q", "main")
+
+	loaded, err := loadJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = loaded.rollback(io.Discard, closedByRollback)
+	if err == nil || !strings.Contains(err.Error(), "split/b") {
+		t.Fatalf("rollback() error = %v, want split/b to be kept", err)
+	}
+	if got := runGit(t, dir, "branch", "--list", "split/*"); got != "split/b" {
+		t.Errorf("local branches: %q", got)
+	}
+	if got := runGit(t, origin, "branch", "--list", "split/*"); got != "split/b" {
+		t.Errorf("origin branches: %q", got)
+	}
+
+	// the journal keeps what could not be undone
+	left, err := loadJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left.Actions) != 2 || left.Actions[0].Branch != "split/b" || left.Actions[1].Branch != "split/b" {
+		t.Errorf("journal after partial rollback: %+v", left.Actions)
+	}
+}
+
+func TestLoadJournal_Missing(t *testing.T) {
+	newTestRepo(t)
+	if _, err := loadJournal(); err == nil || !strings.Contains(err.Error(), "nothing to roll back") {
+		t.Errorf("loadJournal() error = %v", err)
+	}
+}
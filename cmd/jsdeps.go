@@ -0,0 +1,435 @@
+package cmd
+
+import (
+	"encoding/json"
+	"maps"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// jsExtensions are the files scanned for ES/CommonJS imports.
+var jsExtensions = []string{".ts", ".tsx", ".js", ".jsx", ".mjs", ".cjs", ".mts", ".cts", ".vue", ".svelte"}
+
+// jsResolveExtensions are tried, in order, for a specifier without one.
+var jsResolveExtensions = []string{".ts", ".tsx", ".js", ".jsx", ".mjs", ".cjs", ".mts", ".cts"}
+
+var (
+	// import x from 'a', import {a, b} from "a", import 'a', export * from 'a', import type {T} from 'a'
+	jsImportRe = regexp.MustCompile(`(?:^|[^\w$.])(?:import|export)\s+(?:type\s+)?(?:[\w*${},\s]+?\s+from\s+)?['"]([^'"\n]+)['"]`)
+	// require('a'), import('a')
+	jsCallRe = regexp.MustCompile(`(?:^|[^\w$.])(?:require|import)\s*\(\s*['"]([^'"\n]+)['"]\s*\)`)
+	// export * from 'a', export {a} from 'a'
+	jsReexportRe = regexp.MustCompile(`(?:^|[^\w$.])export\s+(?:type\s+)?(?:\*(?:\s+as\s+[\w$]+)?|\{[^}]*\})\s+from\s+['"]([^'"\n]+)['"]`)
+)
+
+func isJSFile(p string) bool {
+	return slices.Contains(jsExtensions, path.Ext(p))
+}
+
+// isBarrel reports whether p is an index file that typically re-exports its
+// directory, like components/index.ts.
+func isBarrel(p string) bool {
+	base := path.Base(p)
+	return strings.TrimSuffix(base, path.Ext(base)) == "index" && isJSFile(p)
+}
+
+// scanJSImports returns the module specifiers src imports, re-exports or
+// requires. It is a lightweight scan, not a parser: comments are skipped,
+// but specifiers built at run time are not seen.
+func scanJSImports(src []byte) []string {
+	return scanSpecifiers(src, jsImportRe, jsCallRe)
+}
+
+// scanJSReexports returns the specifiers src re-exports from.
+func scanJSReexports(src []byte) []string {
+	return scanSpecifiers(src, jsReexportRe)
+}
+
+func scanSpecifiers(src []byte, res ...*regexp.Regexp) []string {
+	code := stripJSComments(string(src))
+	var specs []string
+	for _, re := range res {
+		for _, m := range re.FindAllStringSubmatch(code, -1) {
+			if !slices.Contains(specs, m[1]) {
+				specs = append(specs, m[1])
+			}
+		}
+	}
+	return specs
+}
+
+// stripJSComments removes // and /* */ comments outside string literals.
+// Template literals are treated like strings.
+func stripJSComments(s string) string {
+	var sb strings.Builder
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			sb.WriteByte(c)
+			if c == '\\' && i+1 < len(s) {
+				i++
+				sb.WriteByte(s[i])
+			} else if c == quote || (c == '\n' && quote != '`') {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+			sb.WriteByte(c)
+		case c == '/' && i+1 < len(s) && s[i+1] == '/':
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+			if i < len(s) {
+				sb.WriteByte('\n')
+			}
+		case c == '/' && i+1 < len(s) && s[i+1] == '*':
+			end := strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				return sb.String()
+			}
+			sb.WriteByte(' ')
+			i += end + 3
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// jsAlias is one entry of tsconfig compilerOptions.paths, such as
+// "@/*": ["src/*"].
+type jsAlias struct {
+	pattern string
+	targets []string
+}
+
+// match returns the paths spec maps to, relative to baseUrl.
+func (a jsAlias) match(spec string) []string {
+	prefix, suffix, wildcard := strings.Cut(a.pattern, "*")
+	if !wildcard {
+		if spec == a.pattern {
+			return a.targets
+		}
+		return nil
+	}
+	if !strings.HasPrefix(spec, prefix) || !strings.HasSuffix(spec, suffix) || len(spec) < len(prefix)+len(suffix) {
+		return nil
+	}
+	star := spec[len(prefix) : len(spec)-len(suffix)]
+	var paths []string
+	for _, t := range a.targets {
+		paths = append(paths, strings.Replace(t, "*", star, 1))
+	}
+	return paths
+}
+
+// jsResolver resolves import specifiers to repository paths the way
+// TypeScript's bundler resolution roughly does.
+type jsResolver struct {
+	read    readFunc
+	changed map[string]bool
+	baseURL string // relative to the repository root; "" when not set
+	aliases []jsAlias
+	exists  map[string]bool
+}
+
+func newJSResolver(read readFunc, changed map[string]bool) *jsResolver {
+	r := &jsResolver{read: read, changed: changed, exists: map[string]bool{}}
+	for _, name := range []string{"tsconfig.json", "jsconfig.json"} {
+		data, err := read(name)
+		if err != nil {
+			continue
+		}
+		var cfg struct {
+			CompilerOptions struct {
+				BaseURL string              `json:"baseUrl"`
+				Paths   map[string][]string `json:"paths"`
+			} `json:"compilerOptions"`
+		}
+		if err := json.Unmarshal([]byte(jsoncToJSON(string(data))), &cfg); err != nil {
+			continue
+		}
+		r.baseURL = cfg.CompilerOptions.BaseURL
+		for _, pattern := range slices.Sorted(maps.Keys(cfg.CompilerOptions.Paths)) {
+			r.aliases = append(r.aliases, jsAlias{pattern: pattern, targets: cfg.CompilerOptions.Paths[pattern]})
+		}
+		// longest pattern first, so "@/components/*" wins over "@/*"
+		slices.SortStableFunc(r.aliases, func(a, b jsAlias) int { return len(b.pattern) - len(a.pattern) })
+		break
+	}
+	return r
+}
+
+var trailingCommaRe = regexp.MustCompile(`,(\s*[}\]])`)
+
+// jsoncToJSON turns tsconfig's JSON with comments and trailing commas into
+// plain JSON.
+func jsoncToJSON(s string) string {
+	return trailingCommaRe.ReplaceAllString(stripJSComments(s), "$1")
+}
+
+// resolve returns the file spec refers to when imported from the file from,
+// or "" for packages and files that do not exist.
+func (r *jsResolver) resolve(from, spec string) string {
+	var bases []string
+	switch {
+	case strings.HasPrefix(spec, "./") || strings.HasPrefix(spec, "../") || spec == "." || spec == "..":
+		bases = []string{path.Join(path.Dir(from), spec)}
+	default:
+		for _, a := range r.aliases {
+			if targets := a.match(spec); targets != nil {
+				for _, t := range targets {
+					bases = append(bases, path.Join(r.baseDir(), t))
+				}
+				break
+			}
+		}
+		if len(bases) == 0 && r.baseURL != "" {
+			bases = []string{path.Join(r.baseDir(), spec)}
+		}
+	}
+	for _, base := range bases {
+		if strings.HasPrefix(base, "../") {
+			continue // outside the repository
+		}
+		for _, c := range resolveCandidates(base) {
+			if r.fileExists(c) {
+				return c
+			}
+		}
+	}
+	return ""
+}
+
+func (r *jsResolver) baseDir() string {
+	if r.baseURL == "" {
+		return "."
+	}
+	return r.baseURL
+}
+
+// resolveCandidates lists the files base may stand for: itself, with an
+// extension, a .ts source for a .js specifier, or an index file.
+func resolveCandidates(base string) []string {
+	candidates := []string{base}
+	if ext := path.Ext(base); ext == ".js" || ext == ".jsx" || ext == ".mjs" || ext == ".cjs" {
+		stem := strings.TrimSuffix(base, ext)
+		candidates = append(candidates, stem+".ts", stem+".tsx", stem+".mts", stem+".cts")
+	}
+	for _, ext := range jsResolveExtensions {
+		candidates = append(candidates, base+ext)
+	}
+	for _, ext := range jsResolveExtensions {
+		candidates = append(candidates, base+"/index"+ext)
+	}
+	return candidates
+}
+
+func (r *jsResolver) fileExists(p string) bool {
+	if r.changed[p] {
+		return true
+	}
+	if ok, seen := r.exists[p]; seen {
+		return ok
+	}
+	_, err := r.read(p)
+	r.exists[p] = err == nil
+	return r.exists[p]
+}
+
+// targets returns the changed files an import of spec from the file from
+// depends on. Imports of a barrel also depend on the changed files the
+// barrel re-exports, even when the barrel itself is unchanged.
+func (r *jsResolver) targets(from, spec string, visited map[string]bool) []string {
+	target := r.resolve(from, spec)
+	if target == "" || visited[target] {
+		return nil
+	}
+	visited[target] = true
+	var targets []string
+	if r.changed[target] {
+		targets = append(targets, target)
+	}
+	if isBarrel(target) {
+		if src, err := r.read(target); err == nil {
+			for _, s := range scanJSReexports(src) {
+				targets = append(targets, r.targets(target, s, visited)...)
+			}
+		}
+	}
+	return targets
+}
+
+// jsImportGraph returns, for each changed JS/TS file, the other changed
+// files it imports.
+func jsImportGraph(files []FileChange, read readFunc) map[string][]string {
+	changed := map[string]bool{}
+	for _, f := range files {
+		if isJSFile(f.Path) && f.Status != statusDeleted && !f.Binary {
+			changed[f.Path] = true
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	r := newJSResolver(read, changed)
+	graph := map[string][]string{}
+	for _, p := range slices.Sorted(maps.Keys(changed)) {
+		src, err := read(p)
+		if err != nil {
+			continue
+		}
+		for _, spec := range scanJSImports(src) {
+			for _, t := range r.targets(p, spec, map[string]bool{p: true}) {
+				if !slices.Contains(graph[p], t) {
+					graph[p] = append(graph[p], t)
+				}
+			}
+		}
+	}
+	return graph
+}
+
+// coupledFiles returns sets of changed files that belong in the same child
+// PR: files that import each other in a cycle, and a changed barrel with
+// the changed files it re-exports.
+func coupledFiles(graph map[string][]string, read readFunc) [][]string {
+	parent := map[string]string{}
+	var find func(string) string
+	find = func(p string) string {
+		if parent[p] == "" || parent[p] == p {
+			parent[p] = p
+			return p
+		}
+		parent[p] = find(parent[p])
+		return parent[p]
+	}
+	union := func(a, b string) { parent[find(a)] = find(b) }
+
+	for _, scc := range stronglyConnected(graph) {
+		for _, p := range scc[1:] {
+			union(p, scc[0])
+		}
+	}
+	changed := map[string]bool{}
+	for p := range graph {
+		changed[p] = true
+	}
+	for p, deps := range graph {
+		if !isBarrel(p) {
+			continue
+		}
+		src, err := read(p)
+		if err != nil {
+			continue
+		}
+		r := newJSResolver(read, changed)
+		for _, spec := range scanJSReexports(src) {
+			if t := r.resolve(p, spec); slices.Contains(deps, t) {
+				union(t, p)
+			}
+		}
+	}
+
+	sets := map[string][]string{}
+	for p := range parent {
+		root := find(p)
+		sets[root] = append(sets[root], p)
+	}
+	var coupled [][]string
+	for _, root := range slices.Sorted(maps.Keys(sets)) {
+		if set := sets[root]; len(set) > 1 {
+			slices.Sort(set)
+			coupled = append(coupled, set)
+		}
+	}
+	return coupled
+}
+
+// stronglyConnected returns the strongly connected components of graph with
+// more than one file (Tarjan's algorithm).
+func stronglyConnected(graph map[string][]string) [][]string {
+	index := map[string]int{}
+	low := map[string]int{}
+	onStack := map[string]bool{}
+	var stack []string
+	var sccs [][]string
+	next := 0
+
+	var visit func(string)
+	visit = func(v string) {
+		index[v], low[v] = next, next
+		next++
+		stack = append(stack, v)
+		onStack[v] = true
+		for _, w := range graph[v] {
+			if _, seen := index[w]; !seen {
+				visit(w)
+				low[v] = min(low[v], low[w])
+			} else if onStack[w] {
+				low[v] = min(low[v], index[w])
+			}
+		}
+		if low[v] == index[v] {
+			var scc []string
+			for {
+				w := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[w] = false
+				scc = append(scc, w)
+				if w == v {
+					break
+				}
+			}
+			if len(scc) > 1 {
+				slices.Sort(scc)
+				sccs = append(sccs, scc)
+			}
+		}
+	}
+	for _, v := range slices.Sorted(maps.Keys(graph)) {
+		if _, seen := index[v]; !seen {
+			visit(v)
+		}
+	}
+	return sccs
+}
+
+// keepCoupledTogether moves each set of coupled files into the group of
+// its earliest member and drops groups left empty. Files split by hunks
+// stay where they are.
+func keepCoupledTogether(groups []FileGroup, coupled [][]string) []FileGroup {
+	groupOf := map[string]int{}
+	for i, g := range groups {
+		for _, f := range g.Files {
+			if !f.Partial() {
+				if _, ok := groupOf[f.Path]; !ok {
+					groupOf[f.Path] = i
+				}
+			}
+		}
+	}
+	for _, set := range coupled {
+		target := -1
+		for _, p := range set {
+			if i, ok := groupOf[p]; ok && (target < 0 || groups[i].Order < groups[target].Order) {
+				target = i
+			}
+		}
+		for _, p := range set {
+			i, ok := groupOf[p]
+			if !ok || i == target {
+				continue
+			}
+			idx := slices.IndexFunc(groups[i].Files, func(f FileChange) bool { return f.Path == p && !f.Partial() })
+			groups[target].Files = append(groups[target].Files, groups[i].Files[idx])
+			groups[i].Files = slices.Delete(groups[i].Files, idx, idx+1)
+			groupOf[p] = target
+		}
+	}
+	return slices.DeleteFunc(groups, func(g FileGroup) bool { return len(g.Files) == 0 })
+}
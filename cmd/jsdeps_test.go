@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+var jsRepo = map[string]string{
+	"tsconfig.json": `{
+  // aliases
+  "compilerOptions": {
+    "baseUrl": ".",
+    "paths": { "@/*": ["src/*"], "@ui/*": ["src/components/*"], },
+  },
+}`,
+	"src/api/client.ts":            "export const get = (url: string) => fetch(url)\n",
+	"src/api/users.ts":             "import { get } from './client'\nimport type { User } from '@/types'\nexport const users = () => get('/users')\n",
+	"src/types.ts":                 "export type User = { id: string }\n",
+	"src/components/index.ts":      "export * from './Button'\nexport { Modal } from \"./Modal\"\n",
+	"src/components/Button.tsx":    "import React from 'react'\nexport const Button = () => null\n",
+	"src/components/Modal.tsx":     "import { Button } from '@ui/Button'\nexport const Modal = () => null\n",
+	"src/pages/Home.tsx":           "import { Button } from '../components'\nimport { users } from '@/api/users.js'\n// import { old } from './old'\nconst Lazy = () => import('./Lazy')\n",
+	"src/pages/Lazy.tsx":           "const { helper } = require(\"../util/helper\")\n",
+	"src/util/helper.js":           "module.exports = { helper: () => 1 }\n",
+	"src/cycle/a.ts":               "import { b } from './b'\nexport const a = 1\n",
+	"src/cycle/b.ts":               "import { a } from './a'\nexport const b = 2\n",
+	"src/pages/Home.test.tsx":      "import { Home } from './Home'\n",
+	"src/components/Button.css":    ".button {}\n",
+	"src/components/unchanged.tsx": "export const x = 1\n",
+}
+
+func TestScanJSImports(t *testing.T) {
+	src := `import React, { useState } from "react"
+import type {
+  User,
+  Role,
+} from '@/types'
+import './styles.css'
+export * from './a'
+export { b as c } from './b'
+/* import { gone } from './commented' */
+const url = "http://example.com" // import x from './also-commented'
+const m = await import('./lazy')
+const h = require("./helper")
+obj.import('./not-an-import')
+`
+	want := []string{"react", "@/types", "./styles.css", "./a", "./b", "./lazy", "./helper"}
+	if got := scanJSImports([]byte(src)); !reflect.DeepEqual(got, want) {
+		t.Errorf("scanJSImports() =\n%q\nwant\n%q", got, want)
+	}
+	if got, want := scanJSReexports([]byte(src)), []string{"./a", "./b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("scanJSReexports() = %q, want %q", got, want)
+	}
+}
+
+func TestJSResolver_Resolve(t *testing.T) {
+	r := newJSResolver(mapReader(jsRepo), map[string]bool{})
+	tests := []struct {
+		from, spec string
+		want       string
+	}{
+		{"src/api/users.ts", "./client", "src/api/client.ts"},
+		{"src/api/users.ts", "@/types", "src/types.ts"},
+		{"src/pages/Home.tsx", "@/api/users.js", "src/api/users.ts"},
+		{"src/pages/Home.tsx", "../components", "src/components/index.ts"},
+		{"src/components/Modal.tsx", "@ui/Button", "src/components/Button.tsx"},
+		{"src/pages/Lazy.tsx", "../util/helper", "src/util/helper.js"},
+		{"src/components/index.ts", "./Button.css", "src/components/Button.css"},
+		{"src/components/Button.tsx", "react", ""},
+		{"src/api/users.ts", "./missing", ""},
+		{"src/api/users.ts", "../../../outside", ""},
+	}
+	for _, tt := range tests {
+		if got := r.resolve(tt.from, tt.spec); got != tt.want {
+			t.Errorf("resolve(%q, %q) = %q, want %q", tt.from, tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestJSImportGraph(t *testing.T) {
+	var files []FileChange
+	for _, p := range []string{
+		"src/api/client.ts", "src/api/users.ts", "src/components/Button.tsx", "src/components/Modal.tsx",
+		"src/pages/Home.tsx", "src/pages/Lazy.tsx", "src/util/helper.js", "src/pages/Home.test.tsx",
+	} {
+		files = append(files, FileChange{Path: p})
+	}
+	got := jsImportGraph(files, mapReader(jsRepo))
+	want := map[string][]string{
+		"src/api/users.ts":         {"src/api/client.ts"},
+		"src/components/Modal.tsx": {"src/components/Button.tsx"},
+		// through the unchanged barrel src/components/index.ts
+		"src/pages/Home.tsx":      {"src/components/Button.tsx", "src/components/Modal.tsx", "src/api/users.ts", "src/pages/Lazy.tsx"},
+		"src/pages/Lazy.tsx":      {"src/util/helper.js"},
+		"src/pages/Home.test.tsx": {"src/pages/Home.tsx"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("jsImportGraph() =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestCoupledFiles(t *testing.T) {
+	var files []FileChange
+	for _, p := range []string{"src/cycle/a.ts", "src/cycle/b.ts", "src/components/index.ts", "src/components/Button.tsx", "src/api/users.ts", "src/api/client.ts"} {
+		files = append(files, FileChange{Path: p})
+	}
+	read := mapReader(jsRepo)
+	got := coupledFiles(jsImportGraph(files, read), read)
+	want := [][]string{
+		{"src/components/Button.tsx", "src/components/index.ts"},
+		{"src/cycle/a.ts", "src/cycle/b.ts"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("coupledFiles() = %q, want %q", got, want)
+	}
+}
+
+func TestGroupChanges_Imports(t *testing.T) {
+	files := []FileChange{
+		{Path: "src/cycle/a.ts"},
+		{Path: "src/cycle/b.ts"},
+		{Path: "src/components/index.ts"},
+		{Path: "src/components/Button.tsx"},
+		{Path: "src/pages/Home.tsx"},
+		{Path: "src/api/users.ts"},
+		{Path: "src/api/client.ts"},
+	}
+	cfg, err := parseConfig(".prki.yaml", []byte(`grouping:
+  - {name: Pages, patterns: ["src/pages/**"], order: 1}
+  - {name: Components, patterns: ["src/components/*.tsx"], order: 2}
+  - {name: Barrels, patterns: ["index.ts"], order: 3}
+  - {name: API, patterns: ["src/api/**"], order: 4}
+  - {name: Cycle A, patterns: [src/cycle/a.ts], order: 5}
+  - {name: Cycle B, patterns: [src/cycle/b.ts], order: 6}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	activeConfig = cfg
+	t.Cleanup(func() { activeConfig = nil })
+
+	groups, err := groupChanges(files, "imports", 0, mapReader(jsRepo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, g := range groups {
+		desc := g.Name + ":"
+		for _, f := range g.Files {
+			desc += " " + f.Path
+		}
+		got = append(got, desc)
+	}
+	want := []string{
+		"Components: src/components/Button.tsx src/components/index.ts",
+		"API: src/api/users.ts src/api/client.ts",
+		"Pages: src/pages/Home.tsx",
+		"Cycle A: src/cycle/a.ts src/cycle/b.ts",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("groupChanges() =\n%q\nwant\n%q", got, want)
+	}
+	pages := groups[2]
+	wantDeps := []GroupDependency{
+		{Group: "Components", Packages: []string{"src/components/Button.tsx", "src/components/index.ts"}},
+		{Group: "API", Packages: []string{"src/api/users.ts"}},
+	}
+	if !reflect.DeepEqual(pages.DependsOn, wantDeps) {
+		t.Errorf("Pages depends on %+v, want %+v", pages.DependsOn, wantDeps)
+	}
+}
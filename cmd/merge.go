@@ -0,0 +1,281 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	mergeAuto       bool
+	mergeBaseBranch string
+	mergeForce      bool
+	mergeMethod     string
+	mergeStrategy   string
+	mergeParts      int
+)
+
+// Check states returned by checksState.
+const (
+	checksPassing = "passing"
+	checksPending = "pending"
+	checksFailing = "failing"
+)
+
+var mergeCmd = &cobra.Command{
+	Use:   "merge",
+	Short: "Merge approved child PRs into the parent branch",
+	Long: `Merge approved child PRs into the current (parent) branch in group order,
+e.g. Infrastructure & Config before Core Business Logic before Tests. The
+order is the one recorded by prki split; for child PRs opened without it,
+the changes are grouped again with --strategy and --parts.
+
+Child PRs that are not approved or whose checks are failing or pending are
+skipped unless --force is given, and so are all child PRs after them, which
+may build on their changes. Merging stops at the first child PR that
+conflicts with the parent or fails to merge. Finally the parent diff that no merged child PR
+covers is printed, which is what the final parent review has to look at.
+
+Examples:
+  prki merge
+  prki merge --auto
+  prki merge --force
+  prki merge --method squash`,
+	RunE: runMerge,
+}
+
+func runMerge(cmd *cobra.Command, args []string) error {
+	switch mergeMethod {
+	case "merge", "squash", "rebase":
+	default:
+		return fmt.Errorf("invalid --method %q (merge|squash|rebase)", mergeMethod)
+	}
+
+	parentBranch, err := getCurrentBranch()
+	if err != nil {
+		return fmt.Errorf("failed to get current branch: %w", err)
+	}
+
+	prs, err := fetchChildPRs(parentBranch)
+	if err != nil {
+		return fmt.Errorf("could not fetch child PRs: %w", err)
+	}
+	if len(prs) == 0 {
+		fmt.Printf("No open child PRs found for %s.\n", parentBranch)
+		return printResidualDiff(parentBranch)
+	}
+
+	order, err := mergeOrder(parentBranch)
+	if err != nil {
+		return err
+	}
+	sortChildPRsByOrder(prs, order)
+
+	fmt.Printf("Parent branch: %s\n\n", parentBranch)
+	fmt.Println("Merge plan:")
+	ready := planMerge(os.Stdout, prs, parentBranch, mergeForce)
+	if len(ready) == 0 {
+		fmt.Println("\nNothing to merge.")
+		return nil
+	}
+
+	if !mergeAuto {
+		fmt.Printf("\nMerge %d child PR(s) into %s? [Y/n] ", len(ready), parentBranch)
+		reader := bufio.NewReader(os.Stdin)
+		ans, _ := reader.ReadString('\n')
+		if strings.TrimSpace(strings.ToLower(ans)) == "n" {
+			fmt.Println("Cancelled.")
+			return nil
+		}
+	}
+
+	fmt.Println()
+	forge := currentForge(nil)
+	var mergeErr error
+	merged := 0
+	for _, pr := range ready {
+		if strings.EqualFold(pr.Mergeable, "CONFLICTING") {
+			mergeErr = fmt.Errorf("child PR #%d conflicts with %s; resolve it on %s and run `prki merge` again", pr.Number, parentBranch, pr.HeadRefName)
+			break
+		}
+		fmt.Printf("  Merging #%d %s...\n", pr.Number, pr.Title)
+		if err := forge.Merge(pr.Number, mergeMethod); err != nil {
+			mergeErr = fmt.Errorf("merging child PR #%d failed: %w", pr.Number, err)
+			break
+		}
+		merged++
+	}
+	if mergeErr != nil {
+		fmt.Fprintf(os.Stderr, "  ✗ %v\n  Stopped; remaining child PRs were not merged.\n", mergeErr)
+	}
+	fmt.Printf("\n%d child PR(s) merged into %s.\n", merged, parentBranch)
+
+	if merged > 0 {
+		syncParentBranch(parentBranch)
+	}
+	if err := printResidualDiff(parentBranch); err != nil {
+		fmt.Fprintf(os.Stderr, "  (Could not compute residual diff: %v)\n", err)
+	}
+	return mergeErr
+}
+
+// planMerge prints the merge plan for prs, in group order, and returns the
+// child PRs to merge. Later groups build on earlier ones, so every child PR
+// after one that is blocked waits for it rather than being merged ahead.
+func planMerge(w io.Writer, prs []ChildPR, parentBranch string, force bool) []ChildPR {
+	var ready []ChildPR
+	var blocked *ChildPR
+	for i, pr := range prs {
+		if blocked != nil {
+			fmt.Fprintf(w, "  - #%d %s (skipped: waits for #%d)\n", pr.Number, pr.Title, blocked.Number)
+			continue
+		}
+		if reason := mergeBlocker(pr, force); reason != "" {
+			fmt.Fprintf(w, "  - #%d %s (skipped: %s)\n", pr.Number, pr.Title, reason)
+			blocked = &prs[i]
+			continue
+		}
+		if strings.EqualFold(pr.Mergeable, "CONFLICTING") {
+			fmt.Fprintf(w, "  ✗ #%d %s (conflicts with %s; merging stops here)\n", pr.Number, pr.Title, parentBranch)
+		} else {
+			fmt.Fprintf(w, "  ✓ #%d %s\n", pr.Number, pr.Title)
+		}
+		ready = append(ready, pr)
+	}
+	return ready
+}
+
+// mergeBlocker returns why pr must be skipped, or "" when it may be merged.
+// force overrides missing approvals and checks. Conflicts are not skipped:
+// merging stops at them so later groups are not merged out of order.
+func mergeBlocker(pr ChildPR, force bool) string {
+	if force {
+		return ""
+	}
+	if !strings.EqualFold(pr.ReviewDecision, "APPROVED") {
+		return reviewLabel(pr.ReviewDecision)
+	}
+	switch checksState(pr.StatusCheckRollup) {
+	case checksFailing:
+		return "checks failing"
+	case checksPending:
+		return "checks pending"
+	}
+	return ""
+}
+
+// checksState summarizes a status check rollup. No checks counts as passing.
+func checksState(checks []CheckStatus) string {
+	state := checksPassing
+	for _, c := range checks {
+		switch strings.ToUpper(c.Conclusion) {
+		case "FAILURE", "CANCELLED", "TIMED_OUT", "ACTION_REQUIRED", "STARTUP_FAILURE":
+			return checksFailing
+		}
+		switch strings.ToUpper(c.State) {
+		case "FAILURE", "ERROR":
+			return checksFailing
+		case "PENDING", "EXPECTED":
+			state = checksPending
+		}
+		if c.Status != "" && !strings.EqualFold(c.Status, "COMPLETED") {
+			state = checksPending
+		}
+	}
+	return state
+}
+
+// mergeOrder maps the child branches of parentBranch to their group order,
+// taken from the split tree or, without one, by grouping the parent's
+// changes again.
+func mergeOrder(parentBranch string) (map[string]int, error) {
+	tree, err := loadTree(parentBranch)
+	if err != nil {
+		return nil, err
+	}
+	if tree != nil {
+		return tree.orderByBranch(), nil
+	}
+	files, err := getChangedFiles(diffOptions{Base: mergeBaseBranch, Hunks: mergeStrategy == "hunk"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get changed files: %w", err)
+	}
+	measureComplexity(files)
+	groups, err := groupChanges(files, mergeStrategy, mergeParts, changeReader(modeBranch, ""))
+	if err != nil {
+		return nil, err
+	}
+	return groupOrderByBranch(groups), nil
+}
+
+// groupOrderByBranch maps child branch names to their group's Order.
+func groupOrderByBranch(groups []FileGroup) map[string]int {
+	order := map[string]int{}
+	for _, g := range groups {
+		order[toBranchName(g.Name)] = g.Order
+	}
+	return order
+}
+
+// sortChildPRsByOrder sorts PRs by the order of their group; PRs whose branch
+// belongs to no known group go last, by number.
+func sortChildPRsByOrder(prs []ChildPR, order map[string]int) {
+	sort.SliceStable(prs, func(i, j int) bool {
+		oi, iok := order[prs[i].HeadRefName]
+		oj, jok := order[prs[j].HeadRefName]
+		switch {
+		case iok && jok && oi != oj:
+			return oi < oj
+		case iok != jok:
+			return iok
+		default:
+			return prs[i].Number < prs[j].Number
+		}
+	})
+}
+
+// syncParentBranch fast-forwards the local parent branch to the remote one,
+// which now contains the child merges.
+func syncParentBranch(parentBranch string) {
+	if err := activeGit.Fetch(parentBranch); err != nil {
+		fmt.Printf("  ⚠  Could not fetch %s (%v); run `git pull` before continuing.\n", parentBranch, err)
+		return
+	}
+	if err := activeGit.FastForward("origin/" + parentBranch); err != nil {
+		fmt.Printf("  ⚠  Local %s has diverged from origin/%s; run `git pull` to integrate the merges.\n", parentBranch, parentBranch)
+	}
+}
+
+// printResidualDiff prints what is left to review in the parent.
+func printResidualDiff(parentBranch string) error {
+	prs, err := listChildPRs(parentBranch, "all")
+	if err != nil {
+		return err
+	}
+	report, err := computeResidual(parentBranch, mergeBaseBranch, prs)
+	if err != nil {
+		return err
+	}
+	fmt.Println()
+	printResidualReport(report)
+	if len(report.Residual) > 0 {
+		fmt.Println("Run `prki diff` to see the residual patch.")
+	}
+	return nil
+}
+
+func init() {
+	mergeCmd.Flags().BoolVar(&mergeAuto, "auto", false, "Skip the confirmation prompt")
+	mergeCmd.Flags().StringVar(&mergeBaseBranch, "base", "", "Base branch of the parent (default: origin's default branch)")
+	mergeCmd.Flags().BoolVar(&mergeForce, "force", false, "Also merge child PRs that are not approved or whose checks fail")
+	mergeCmd.Flags().StringVar(&mergeMethod, "method", "merge", "Merge method (merge|squash|rebase)")
+	mergeCmd.Flags().StringVar(&mergeStrategy, "strategy", "semantic", "Grouping strategy used for split, to derive the merge order without a split tree (semantic|directory|filetype|hunk|imports)")
+	mergeCmd.Flags().IntVar(&mergeParts, "parts", 0, "--parts used for split, to derive the merge order without a split tree")
+
+	rootCmd.AddCommand(mergeCmd)
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestChecksState(t *testing.T) {
+	tests := []struct {
+		name   string
+		checks []CheckStatus
+		want   string
+	}{
+		{"no checks", nil, checksPassing},
+		{"all passed", []CheckStatus{{Status: "COMPLETED", Conclusion: "SUCCESS"}, {State: "SUCCESS"}}, checksPassing},
+		{"skipped and neutral pass", []CheckStatus{{Status: "COMPLETED", Conclusion: "SKIPPED"}, {Status: "COMPLETED", Conclusion: "NEUTRAL"}}, checksPassing},
+		{"check run failed", []CheckStatus{{Status: "COMPLETED", Conclusion: "SUCCESS"}, {Status: "COMPLETED", Conclusion: "FAILURE"}}, checksFailing},
+		{"commit status error", []CheckStatus{{State: "ERROR"}}, checksFailing},
+		{"in progress", []CheckStatus{{Status: "IN_PROGRESS"}}, checksPending},
+		{"status pending", []CheckStatus{{State: "PENDING"}}, checksPending},
+		{"failure wins over pending", []CheckStatus{{Status: "QUEUED"}, {Status: "COMPLETED", Conclusion: "TIMED_OUT"}}, checksFailing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checksState(tt.checks); got != tt.want {
+				t.Errorf("checksState() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeBlocker(t *testing.T) {
+	failing := []CheckStatus{{Status: "COMPLETED", Conclusion: "FAILURE"}}
+	tests := []struct {
+		name  string
+		pr    ChildPR
+		force bool
+		want  string
+	}{
+		{"approved and green", ChildPR{ReviewDecision: "APPROVED"}, false, ""},
+		{"pending review", ChildPR{ReviewDecision: "REVIEW_REQUIRED"}, false, "pending review"},
+		{"changes requested", ChildPR{ReviewDecision: "CHANGES_REQUESTED"}, false, "changes requested"},
+		{"failing checks", ChildPR{ReviewDecision: "APPROVED", StatusCheckRollup: failing}, false, "checks failing"},
+		{"pending checks", ChildPR{ReviewDecision: "APPROVED", StatusCheckRollup: []CheckStatus{{Status: "QUEUED"}}}, false, "checks pending"},
+		{"force overrides review", ChildPR{ReviewDecision: ""}, true, ""},
+		{"force overrides checks", ChildPR{StatusCheckRollup: failing}, true, ""},
+		{"conflicts are not skipped", ChildPR{ReviewDecision: "APPROVED", Mergeable: "CONFLICTING"}, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeBlocker(tt.pr, tt.force); got != tt.want {
+				t.Errorf("mergeBlocker() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanMerge_StopsAtBlockedChild(t *testing.T) {
+	prs := []ChildPR{
+		{Number: 1, Title: "Infrastructure & Config", ReviewDecision: "REVIEW_REQUIRED"},
+		{Number: 2, Title: "Core Business Logic", ReviewDecision: "APPROVED"},
+		{Number: 3, Title: "Tests", ReviewDecision: "APPROVED"},
+	}
+	var out bytes.Buffer
+	if ready := planMerge(&out, prs, "feature", false); len(ready) != 0 {
+		t.Errorf("planMerge() = %+v, want nothing after a blocked first group", ready)
+	}
+	for _, want := range []string{"#1 Infrastructure & Config (skipped: pending review)", "#2 Core Business Logic (skipped: waits for #1)", "#3 Tests (skipped: waits for #1)"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("plan does not contain %q:\n%s", want, out.String())
+		}
+	}
+
+	if ready := planMerge(io.Discard, prs, "feature", true); len(ready) != 3 {
+		t.Errorf("planMerge() with force = %+v, want all three", ready)
+	}
+	prs[0].ReviewDecision = "APPROVED"
+	prs[1].ReviewDecision = "CHANGES_REQUESTED"
+	if ready := planMerge(io.Discard, prs, "feature", false); len(ready) != 1 || ready[0].Number != 1 {
+		t.Errorf("planMerge() = %+v, want only #1", ready)
+	}
+}
+
+func TestSortChildPRsByOrder(t *testing.T) {
+	groups := []FileGroup{
+		{Name: "Infrastructure & Config", Order: 1},
+		{Name: "Core Business Logic", Order: 2},
+		{Name: "Tests", Order: 4},
+	}
+	prs := []ChildPR{
+		{Number: 7, HeadRefName: "someone/else"},
+		{Number: 3, HeadRefName: "review/tests"},
+		{Number: 5, HeadRefName: "review/infrastructure-config"},
+		{Number: 2, HeadRefName: "hotfix"},
+		{Number: 4, HeadRefName: "review/core-business-logic"},
+	}
+	sortChildPRsByOrder(prs, groupOrderByBranch(groups))
+
+	want := []int{5, 4, 3, 2, 7}
+	for i, n := range want {
+		if prs[i].Number != n {
+			t.Fatalf("order = %v, want %v", prNumbers(prs), want)
+		}
+	}
+}
+
+func prNumbers(prs []ChildPR) []int {
+	var ns []int
+	for _, pr := range prs {
+		ns = append(ns, pr.Number)
+	}
+	return ns
+}
+
+func TestSyncParentBranch(t *testing.T) {
+	tests := []struct {
+		name        string
+		fetchFails  bool
+		localCommit bool // feature has a commit origin/feature lacks
+		want        string
+		moved       bool
+	}{
+		{name: "fast-forward", moved: true},
+		{
+			name:       "fetch fails",
+			fetchFails: true,
+			want:       "Could not fetch feature (git fetch: boom); run `git pull` before continuing.",
+		},
+		{
+			name:        "diverged",
+			localCommit: true,
+			want:        "Local feature has diverged from origin/feature",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := useFeatureMemGit(t)
+			// a child PR merged into feature on origin
+			before := g.refs["refs/heads/feature"]
+			merged := g.commit("feature", map[string]string{"child.txt": "merged\n"})
+			g.push("feature")
+			g.refs["refs/heads/feature"], g.refs["refs/remotes/origin/feature"] = before, before
+			if tt.localCommit {
+				before = g.commit("feature", map[string]string{"local.txt": "not pushed\n"})
+			}
+			if tt.fetchFails {
+				g.fail("fetch", "feature", "boom")
+			}
+
+			out, _ := captureStdout(t, func() error {
+				syncParentBranch("feature")
+				return nil
+			})
+			if tt.want == "" && out != "" || !strings.Contains(out, tt.want) {
+				t.Errorf("output = %q, want %q", out, tt.want)
+			}
+			want := before
+			if tt.moved {
+				want = merged
+			}
+			if got := g.refs["refs/heads/feature"]; got != want {
+				t.Errorf("feature at %s, want %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// schemaVersion is the version of the JSON/YAML output of every command.
+// Fields may be added within a version; renaming or removing one bumps it.
+// See docs/output.md.
+const schemaVersion = 1
+
+// outputFormats are the values accepted by --output.
+var outputFormats = []string{"text", "json", "yaml"}
+
+// reportHeader starts every machine-readable report.
+type reportHeader struct {
+	SchemaVersion int    `json:"schemaVersion" yaml:"schemaVersion"`
+	Kind          string `json:"kind" yaml:"kind"`
+}
+
+func newReportHeader(kind string) reportHeader {
+	return reportHeader{SchemaVersion: schemaVersion, Kind: kind}
+}
+
+// fileChangeView is the output schema of a FileChange.
+type fileChangeView struct {
+	Path         string `json:"path" yaml:"path"`
+	LinesAdded   int    `json:"linesAdded" yaml:"linesAdded"`
+	LinesDeleted int    `json:"linesDeleted" yaml:"linesDeleted"`
+	Complexity   int    `json:"complexity" yaml:"complexity"`
+	Status       string `json:"status,omitempty" yaml:"status,omitempty"`   // A|M|D|R|C|T
+	OldPath      string `json:"oldPath,omitempty" yaml:"oldPath,omitempty"` // renames and copies
+	Binary       bool   `json:"binary,omitempty" yaml:"binary,omitempty"`
+	SizeDelta    int64  `json:"sizeDelta,omitempty" yaml:"sizeDelta,omitempty"` // bytes, binary files only
+	Hunks        []int  `json:"hunks,omitempty" yaml:"hunks,omitempty"`         // when only some hunks of the file are in the group
+}
+
+// fileGroupView is the output schema of a FileGroup.
+type fileGroupView struct {
+	Name       string           `json:"name" yaml:"name"`
+	Order      int              `json:"order" yaml:"order"`
+	Branch     string           `json:"branch" yaml:"branch"`
+	Lines      int              `json:"lines" yaml:"lines"`
+	Complexity int              `json:"complexity" yaml:"complexity"`
+	RiskLevel  string           `json:"riskLevel" yaml:"riskLevel"` // low|medium|high
+	Files      []fileChangeView `json:"files" yaml:"files"`
+	DependsOn  []dependencyView `json:"dependsOn,omitempty" yaml:"dependsOn,omitempty"`
+}
+
+// dependencyView is the output schema of a GroupDependency.
+type dependencyView struct {
+	Group    string   `json:"group" yaml:"group"`
+	Packages []string `json:"packages" yaml:"packages"`
+}
+
+// splitResultView is the output schema of a splitResult.
+type splitResultView struct {
+	Group  string `json:"group" yaml:"group"`
+	Branch string `json:"branch" yaml:"branch"`
+	PRURL  string `json:"prUrl,omitempty" yaml:"prUrl,omitempty"`
+	Error  string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// childPRView is the output schema of a ChildPR.
+type childPRView struct {
+	Number         int    `json:"number" yaml:"number"`
+	Title          string `json:"title" yaml:"title"`
+	Branch         string `json:"branch" yaml:"branch"`
+	State          string `json:"state,omitempty" yaml:"state,omitempty"`
+	ReviewDecision string `json:"reviewDecision" yaml:"reviewDecision"`
+	Checks         string `json:"checks" yaml:"checks"` // passing|pending|failing
+	Mergeable      string `json:"mergeable,omitempty" yaml:"mergeable,omitempty"`
+}
+
+func partialHunks(f FileChange) []int {
+	if !f.Partial() {
+		return nil
+	}
+	return f.HunkIndexes()
+}
+
+func newFileChangeViews(files []FileChange) []fileChangeView {
+	views := make([]fileChangeView, 0, len(files))
+	for _, f := range files {
+		views = append(views, fileChangeView{
+			Path:         f.Path,
+			LinesAdded:   f.LinesAdded,
+			LinesDeleted: f.LinesDeleted,
+			Complexity:   f.Complexity,
+			Status:       f.Status,
+			OldPath:      f.OldPath,
+			Binary:       f.Binary,
+			SizeDelta:    f.SizeDelta,
+			Hunks:        partialHunks(f),
+		})
+	}
+	return views
+}
+
+func newFileGroupViews(groups []FileGroup) []fileGroupView {
+	views := make([]fileGroupView, 0, len(groups))
+	for _, g := range groups {
+		views = append(views, fileGroupView{
+			Name:       g.Name,
+			Order:      g.Order,
+			Branch:     toBranchName(g.Name),
+			Lines:      g.TotalLines(),
+			Complexity: g.Complexity(),
+			RiskLevel:  riskLabel(g.RiskLevel()),
+			Files:      newFileChangeViews(g.Files),
+			DependsOn:  newDependencyViews(g.DependsOn),
+		})
+	}
+	return views
+}
+
+func newDependencyViews(deps []GroupDependency) []dependencyView {
+	var views []dependencyView
+	for _, d := range deps {
+		views = append(views, dependencyView{Group: d.Group, Packages: d.Packages})
+	}
+	return views
+}
+
+func newChildPRViews(prs []ChildPR) []childPRView {
+	views := make([]childPRView, 0, len(prs))
+	for _, pr := range prs {
+		views = append(views, childPRView{
+			Number:         pr.Number,
+			Title:          pr.Title,
+			Branch:         pr.HeadRefName,
+			State:          pr.State,
+			ReviewDecision: pr.ReviewDecision,
+			Checks:         checksState(pr.StatusCheckRollup),
+			Mergeable:      pr.Mergeable,
+		})
+	}
+	return views
+}
+
+// riskLabel translates FileGroup.RiskLevel into English.
+func riskLabel(risk string) string {
+	return map[string]string{"低": "low", "中": "medium", "高": "high"}[risk]
+}
+
+// validateOutput checks an --output value against outputFormats plus any
+// command specific formats.
+func validateOutput(format string, extra ...string) error {
+	formats := append(append([]string{}, outputFormats...), extra...)
+	if !contains(formats, format) {
+		return fmt.Errorf("invalid --output %q (%s)", format, strings.Join(formats, "|"))
+	}
+	return nil
+}
+
+// writeReport writes report as JSON or YAML, or renders it with text.
+func writeReport(w io.Writer, format string, report any, text func(io.Writer) error) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case "yaml":
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		return text(w)
+	}
+}
+
+// progressWriter is where commands print progress and prompts: stdout for
+// text output, stderr when stdout carries a machine-readable report.
+func progressWriter(format string) io.Writer {
+	if format == "text" {
+		return os.Stdout
+	}
+	return os.Stderr
+}
+
+func addOutputFlag(c *cobra.Command, p *string) {
+	c.Flags().StringVarP(p, "output", "o", "text", "Output format ("+strings.Join(outputFormats, "|")+")")
+}
@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func sampleAnalysisReport() analysisReport {
+	files := []FileChange{
+		{Path: "go.mod", LinesAdded: 2, LinesDeleted: 1, Complexity: 0},
+		{Path: "cmd/analyze.go", LinesAdded: 400, LinesDeleted: 200, Complexity: 120},
+	}
+	return newAnalysisReport(files, groupBySemantic(files), 500)
+}
+
+func TestAnalysisReport_JSONSchema(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeReport(&buf, "json", sampleAnalysisReport(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if got["schemaVersion"] != float64(schemaVersion) || got["kind"] != "analysis" {
+		t.Errorf("header = %v/%v", got["schemaVersion"], got["kind"])
+	}
+	if got["needsSplit"] != true || got["totalLines"] != float64(603) {
+		t.Errorf("needsSplit/totalLines = %v/%v", got["needsSplit"], got["totalLines"])
+	}
+	groups := got["groups"].([]any)
+	core := groups[1].(map[string]any)
+	want := map[string]any{
+		"name":       "Core Business Logic",
+		"order":      float64(2),
+		"branch":     "review/core-business-logic",
+		"riskLevel":  "high",
+		"complexity": float64(120),
+		"lines":      float64(600),
+	}
+	for k, v := range want {
+		if core[k] != v {
+			t.Errorf("groups[1].%s = %v, want %v", k, core[k], v)
+		}
+	}
+	file := core["files"].([]any)[0].(map[string]any)
+	if file["path"] != "cmd/analyze.go" || file["linesAdded"] != float64(400) || file["linesDeleted"] != float64(200) {
+		t.Errorf("file = %v", file)
+	}
+}
+
+func TestAnalysisReport_YAMLMatchesJSON(t *testing.T) {
+	report := sampleAnalysisReport()
+	var jsonBuf, yamlBuf bytes.Buffer
+	if err := writeReport(&jsonBuf, "json", report, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeReport(&yamlBuf, "yaml", report, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var fromJSON, fromYAML map[string]any
+	if err := json.Unmarshal(jsonBuf.Bytes(), &fromJSON); err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal(yamlBuf.Bytes(), &fromYAML); err != nil {
+		t.Fatal(err)
+	}
+	for k := range fromJSON {
+		if _, ok := fromYAML[k]; !ok {
+			t.Errorf("YAML output lacks key %q:\n%s", k, yamlBuf.String())
+		}
+	}
+	if fromYAML["schemaVersion"] != schemaVersion {
+		t.Errorf("YAML schemaVersion = %v", fromYAML["schemaVersion"])
+	}
+}
+
+func TestWriteReport_Text(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeReport(&buf, "text", sampleAnalysisReport(), func(w io.Writer) error {
+		_, err := io.WriteString(w, "rendered")
+		return err
+	})
+	if err != nil || buf.String() != "rendered" {
+		t.Errorf("text formatter not used: %q, %v", buf.String(), err)
+	}
+
+	wantErr := errors.New("boom")
+	if err := writeReport(&buf, "text", nil, func(io.Writer) error { return wantErr }); err != wantErr {
+		t.Errorf("error from text formatter not returned: %v", err)
+	}
+}
+
+func TestWriteAnalysisText(t *testing.T) {
+	var buf bytes.Buffer
+	writeAnalysisText(&buf, sampleAnalysisReport())
+	out := buf.String()
+	for _, want := range []string{
+		"Current changes: 2 files, 603 lines",
+		"Split proposal:",
+		"├─ Core Business Logic 🔴",
+		"- complexity: high",
+		"• cmd/analyze.go",
+		"Recommendation: split into 2 child PR(s)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+
+	buf.Reset()
+	writeAnalysisText(&buf, newAnalysisReport(nil, nil, 500))
+	if buf.String() != "No changed files found.\n" {
+		t.Errorf("empty analysis = %q", buf.String())
+	}
+
+	buf.Reset()
+	small := []FileChange{{Path: "a.go", LinesAdded: 10}}
+	writeAnalysisText(&buf, newAnalysisReport(small, groupBySemantic(small), 500))
+	if !strings.Contains(buf.String(), "✓ Change size looks fine (10 lines <= threshold 500)") {
+		t.Errorf("small analysis = %q", buf.String())
+	}
+}
+
+func TestStatusReport(t *testing.T) {
+	prs := []ChildPR{
+		{Number: 101, Title: "review/config", ReviewDecision: "APPROVED", HeadRefName: "review/config"},
+		{Number: 102, Title: "review/core", ReviewDecision: "CHANGES_REQUESTED"},
+	}
+	r := newStatusReport("feature/x", prs, nil, []FileChange{{LinesAdded: 100, LinesDeleted: 50}}, nil)
+
+	if len(r.ChildPRs) != 2 || r.ChildPRs[0].Branch != "review/config" || r.ChildPRs[0].Checks != checksPassing {
+		t.Errorf("ChildPRs = %+v", r.ChildPRs)
+	}
+	if len(r.NextActions.Fix) != 1 || r.NextActions.Fix[0] != 102 || len(r.NextActions.Merge) != 1 || r.NextActions.Merge[0] != 101 {
+		t.Errorf("NextActions = %+v", r.NextActions)
+	}
+	if r.Changes == nil || r.Changes.Files != 1 || r.Changes.Lines != 150 {
+		t.Errorf("Changes = %+v", r.Changes)
+	}
+
+	var buf bytes.Buffer
+	writeStatusText(&buf, r)
+	for _, want := range []string{
+		"Current branch: feature/x",
+		"├─ Child PR #101: review/config [approved ✓]",
+		"└─ Child PR #102: review/core [changes requested]",
+		"• Fix changes requested: review/core",
+		"• Ready to merge: review/config",
+		"1 files, 150 lines",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output lacks %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestStatusReport_Errors(t *testing.T) {
+	r := newStatusReport("feature/x", nil, errors.New("gh CLI not found"), nil, errors.New("no base"))
+	if r.ChildPRError != "gh CLI not found" || r.Changes != nil {
+		t.Errorf("report = %+v", r)
+	}
+	var buf bytes.Buffer
+	writeStatusText(&buf, r)
+	if !strings.Contains(buf.String(), "(Could not fetch child PR status: gh CLI not found)") ||
+		!strings.Contains(buf.String(), "Could not retrieve changed files") {
+		t.Errorf("output:\n%s", buf.String())
+	}
+}
+
+func TestWriteSplitText(t *testing.T) {
+	r := splitReport{
+		Parent: "feature/x",
+		Base:   "origin/main",
+		Results: []splitResultView{
+			{Group: "Tests", Branch: "review/tests", PRURL: "https://github.com/o/r/pull/3"},
+			{Group: "Docs", Branch: "review/docs"},
+			{Group: "Core", Branch: "review/core", Error: "already exists"},
+		},
+	}
+	var buf bytes.Buffer
+	writeSplitText(&buf, r)
+	out := buf.String()
+	for _, want := range []string{
+		"2 child PR(s) created:",
+		"✓ [Tests] branch: review/tests\n    https://github.com/o/r/pull/3",
+		"✓ [Docs] branch: review/docs  (push and create PR manually)",
+		"merge parent PR into main",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "review/core") {
+		t.Errorf("failed groups should not be listed as created:\n%s", out)
+	}
+}
+
+func TestValidateOutput(t *testing.T) {
+	for _, f := range []string{"text", "json", "yaml"} {
+		if err := validateOutput(f); err != nil {
+			t.Errorf("validateOutput(%q): %v", f, err)
+		}
+	}
+	if err := validateOutput("github"); err == nil {
+		t.Error("github should only be valid where allowed")
+	}
+	if err := validateOutput("github", "github"); err != nil {
+		t.Errorf("validateOutput(github, github): %v", err)
+	}
+}
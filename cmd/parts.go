@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// fileWeight is what balanceGroups evens out: changed lines plus ten per
+// point of complexity, so that both count about the same. Every file,
+// binaries included, weighs at least 1.
+func fileWeight(f FileChange) int {
+	return max(f.TotalLines()+10*f.Complexity, 1)
+}
+
+func groupWeight(g FileGroup) int {
+	w := 0
+	for _, f := range g.Files {
+		w += fileWeight(f)
+	}
+	return w
+}
+
+// balancedGroup is a FileGroup while balanceGroups works on it; base is the
+// name of the group it was split from, and members are the names of the
+// groups merged into it, which its and other groups' DependsOn refer to.
+type balancedGroup struct {
+	FileGroup
+	base    string
+	members []string
+}
+
+// balanceGroups merges or splits groups until there are exactly parts of
+// them, keeping their weights as even as it can:
+//
+//   - while there are too many, the lightest group is merged into the group
+//     it depends on or that depends on it, else one sharing its top
+//     directory, else the lightest other group;
+//   - while there are too few, the heaviest group is cut in two between its
+//     files sorted by path, preferring a cut between directories (and so
+//     between Go packages) over an even one.
+//
+// Groups split this way are numbered, e.g. "Core Business Logic (2/3)".
+// DependsOn should be linked beforehand; the result needs relinking.
+func balanceGroups(groups []FileGroup, parts int) ([]FileGroup, error) {
+	files := 0
+	for _, g := range groups {
+		files += len(g.Files)
+	}
+	if parts < 1 {
+		return nil, fmt.Errorf("--parts must be at least 1, got %d", parts)
+	}
+	if parts > files {
+		return nil, fmt.Errorf("cannot split %d file(s) into %d parts", files, parts)
+	}
+
+	bs := make([]balancedGroup, len(groups))
+	for i, g := range groups {
+		bs[i] = balancedGroup{FileGroup: g, base: g.Name, members: []string{g.Name}}
+	}
+	for len(bs) > parts {
+		bs = mergeLightest(bs)
+	}
+	for len(bs) < parts {
+		bs = splitHeaviest(bs)
+	}
+
+	sort.SliceStable(bs, func(i, j int) bool { return bs[i].Order < bs[j].Order })
+	counts, seen := map[string]int{}, map[string]int{}
+	for _, b := range bs {
+		counts[b.base]++
+	}
+	balanced := make([]FileGroup, len(bs))
+	for i, b := range bs {
+		g := b.FileGroup
+		g.Order = i + 1
+		g.DependsOn = nil
+		if counts[b.base] > 1 {
+			seen[b.base]++
+			g.Name = fmt.Sprintf("%s (%d/%d)", b.base, seen[b.base], counts[b.base])
+		}
+		balanced[i] = g
+	}
+	return balanced, nil
+}
+
+func mergeLightest(bs []balancedGroup) []balancedGroup {
+	light := 0
+	for i, b := range bs {
+		if groupWeight(b.FileGroup) < groupWeight(bs[light].FileGroup) {
+			light = i
+		}
+	}
+	cohesion := func(b balancedGroup) int {
+		switch {
+		case dependsOnAny(b.FileGroup, bs[light].members) || dependsOnAny(bs[light].FileGroup, b.members):
+			return 2
+		case topDir(b.FileGroup) != "" && topDir(b.FileGroup) == topDir(bs[light].FileGroup):
+			return 1
+		}
+		return 0
+	}
+	partner := -1
+	for i, b := range bs {
+		if i == light {
+			continue
+		}
+		if partner < 0 || cohesion(b) > cohesion(bs[partner]) ||
+			(cohesion(b) == cohesion(bs[partner]) && groupWeight(b.FileGroup) < groupWeight(bs[partner].FileGroup)) {
+			partner = i
+		}
+	}
+
+	a, b := bs[min(light, partner)], bs[max(light, partner)]
+	members := append(slices.Clone(a.members), b.members...)
+	var deps []GroupDependency
+	for _, d := range append(slices.Clone(a.DependsOn), b.DependsOn...) {
+		if !slices.Contains(members, d.Group) {
+			deps = append(deps, d)
+		}
+	}
+	merged := balancedGroup{
+		FileGroup: FileGroup{
+			Name:      a.Name + " + " + b.Name,
+			Files:     joinHunks(append(slices.Clone(a.Files), b.Files...)),
+			Order:     min(a.Order, b.Order),
+			DependsOn: deps,
+		},
+		members: members,
+	}
+	merged.base = merged.Name
+	bs[min(light, partner)] = merged
+	return slices.Delete(bs, max(light, partner), max(light, partner)+1)
+}
+
+func splitHeaviest(bs []balancedGroup) []balancedGroup {
+	heavy := -1
+	for i, b := range bs {
+		if len(b.Files) > 1 && (heavy < 0 || groupWeight(b.FileGroup) > groupWeight(bs[heavy].FileGroup)) {
+			heavy = i
+		}
+	}
+	g := bs[heavy]
+	files := slices.Clone(g.Files)
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	total := groupWeight(g.FileGroup)
+	cut, best, left := 1, -1, 0
+	for k := 1; k < len(files); k++ {
+		left += fileWeight(files[k-1])
+		cost := abs(total - 2*left)
+		if path.Dir(files[k-1].Path) == path.Dir(files[k].Path) {
+			cost += total / 2 // a cut inside a directory has to be much more even to win
+		}
+		if best < 0 || cost < best {
+			cut, best = k, cost
+		}
+	}
+
+	first, second := g, g
+	first.Files, second.Files = files[:cut:cut], files[cut:]
+	bs[heavy] = first
+	return slices.Insert(bs, heavy+1, second)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// dependsOnGroup reports whether g depends on the group named name.
+func dependsOnGroup(g FileGroup, name string) bool {
+	return dependsOnAny(g, []string{name})
+}
+
+// dependsOnAny reports whether g depends on any of the groups named names.
+func dependsOnAny(g FileGroup, names []string) bool {
+	return slices.ContainsFunc(g.DependsOn, func(d GroupDependency) bool { return slices.Contains(names, d.Group) })
+}
+
+// topDir returns the top-level directory all files of g are in, or "" when
+// they are spread over several or sit at the root.
+func topDir(g FileGroup) string {
+	dir := ""
+	for i, f := range g.Files {
+		top, _, nested := strings.Cut(f.Path, "/")
+		if !nested {
+			return ""
+		}
+		if i == 0 {
+			dir = top
+		} else if top != dir {
+			return ""
+		}
+	}
+	return dir
+}
@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// describeGroups renders groups as "Name: path path".
+func describeGroups(groups []FileGroup) []string {
+	var desc []string
+	for _, g := range groups {
+		var paths []string
+		for _, f := range g.Files {
+			paths = append(paths, f.Path)
+		}
+		desc = append(desc, g.Name+": "+strings.Join(paths, " "))
+	}
+	return desc
+}
+
+func TestBalanceGroups_Merge(t *testing.T) {
+	groups := []FileGroup{
+		{Name: "Config", Order: 1, Files: []FileChange{{Path: "go.mod", LinesAdded: 2}}},
+		{Name: "Store", Order: 2, Files: []FileChange{{Path: "store/store.go", LinesAdded: 300}}},
+		{Name: "API", Order: 3, Files: []FileChange{{Path: "api/handler.go", LinesAdded: 250}}},
+		{Name: "Store tests", Order: 4, Files: []FileChange{{Path: "store/store_test.go", LinesAdded: 40}},
+			DependsOn: []GroupDependency{{Group: "Store"}}},
+		{Name: "Docs", Order: 5, Files: []FileChange{{Path: "README.md", LinesAdded: 20}}},
+	}
+	balanced, err := balanceGroups(groups, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Config goes into the lightest other group, Docs; then Config + Docs,
+	// still the lightest, into Store tests
+	want := []string{
+		"Config + Docs + Store tests: go.mod README.md store/store_test.go",
+		"Store: store/store.go",
+		"API: api/handler.go",
+	}
+	if got := describeGroups(balanced); !reflect.DeepEqual(got, want) {
+		t.Errorf("balanceGroups() =\n%q\nwant\n%q", got, want)
+	}
+	for i, g := range balanced {
+		if g.Order != i+1 || g.DependsOn != nil {
+			t.Errorf("%s: order %d, depends on %+v", g.Name, g.Order, g.DependsOn)
+		}
+	}
+}
+
+func TestBalanceGroups_MergePrefersDependencies(t *testing.T) {
+	groups := []FileGroup{
+		{Name: "Store", Order: 1, Files: []FileChange{{Path: "store/store.go", LinesAdded: 300}}},
+		{Name: "Docs", Order: 2, Files: []FileChange{{Path: "docs/a.md", LinesAdded: 50}}},
+		{Name: "Store tests", Order: 3, Files: []FileChange{{Path: "store/store_test.go", LinesAdded: 10}},
+			DependsOn: []GroupDependency{{Group: "Store"}}},
+	}
+	balanced, err := balanceGroups(groups, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Store + Store tests: store/store.go store/store_test.go", "Docs: docs/a.md"}
+	if got := describeGroups(balanced); !reflect.DeepEqual(got, want) {
+		t.Errorf("balanceGroups() = %q, want %q", got, want)
+	}
+}
+
+func TestBalanceGroups_MergeFollowsDependenciesOfMergedGroups(t *testing.T) {
+	groups := []FileGroup{
+		{Name: "Store", Order: 1, Files: []FileChange{{Path: "store/store.go", LinesAdded: 300}}},
+		{Name: "Docs", Order: 2, Files: []FileChange{{Path: "docs/a.md", LinesAdded: 100}}},
+		{Name: "Store tests", Order: 3, Files: []FileChange{{Path: "storetest/store_test.go", LinesAdded: 10}},
+			DependsOn: []GroupDependency{{Group: "Store"}}},
+		{Name: "Fixtures", Order: 4, Files: []FileChange{{Path: "fixtures/store.go", LinesAdded: 20}},
+			DependsOn: []GroupDependency{{Group: "Store"}}},
+	}
+	balanced, err := balanceGroups(groups, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Fixtures depends on Store, which the first merge renamed
+	want := []string{
+		"Store + Store tests + Fixtures: store/store.go storetest/store_test.go fixtures/store.go",
+		"Docs: docs/a.md",
+	}
+	if got := describeGroups(balanced); !reflect.DeepEqual(got, want) {
+		t.Errorf("balanceGroups() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestBalanceGroups_Split(t *testing.T) {
+	groups := []FileGroup{
+		{Name: "Core", Order: 1, Files: []FileChange{
+			{Path: "payment/refund.go", LinesAdded: 100},
+			{Path: "billing/invoice.go", LinesAdded: 120},
+			{Path: "payment/charge.go", LinesAdded: 150},
+			{Path: "billing/tax.go", LinesAdded: 30},
+			{Path: "payment/card.go", LinesAdded: 20},
+		}},
+		{Name: "Docs", Order: 2, Files: []FileChange{{Path: "README.md", LinesAdded: 10}}},
+	}
+	balanced, err := balanceGroups(groups, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// billing (150) | payment (270) is cut between directories even though
+	// cutting inside payment would be more even
+	want := []string{
+		"Core (1/2): billing/invoice.go billing/tax.go",
+		"Core (2/2): payment/card.go payment/charge.go payment/refund.go",
+		"Docs: README.md",
+	}
+	if got := describeGroups(balanced); !reflect.DeepEqual(got, want) {
+		t.Errorf("balanceGroups() =\n%q\nwant\n%q", got, want)
+	}
+
+	balanced, err = balanceGroups(groups, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		"Core (1/3): billing/invoice.go billing/tax.go",
+		"Core (2/3): payment/card.go payment/charge.go",
+		"Core (3/3): payment/refund.go",
+		"Docs: README.md",
+	}
+	if got := describeGroups(balanced); !reflect.DeepEqual(got, want) {
+		t.Errorf("balanceGroups() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestBalanceGroups_Errors(t *testing.T) {
+	groups := []FileGroup{{Name: "Core", Files: []FileChange{{Path: "a.go"}, {Path: "b.go"}}}}
+	for parts, want := range map[int]string{
+		-1: "--parts must be at least 1, got -1",
+		3:  "cannot split 2 file(s) into 3 parts",
+	} {
+		if _, err := balanceGroups(groups, parts); err == nil || err.Error() != want {
+			t.Errorf("balanceGroups(%d) error = %v, want %q", parts, err, want)
+		}
+	}
+	balanced, err := balanceGroups(groups, 1)
+	if err != nil || len(balanced) != 1 || balanced[0].Name != "Core" {
+		t.Errorf("balanceGroups(1) = %+v, %v", balanced, err)
+	}
+}
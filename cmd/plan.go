@@ -0,0 +1,511 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// planVersion is the version of the plan file format.
+const planVersion = 1
+
+// Plan is a split plan: which changed files go to which child branch, and in
+// what order the child PRs are meant to be merged. prki plan writes it, a
+// human may edit it, and prki apply executes it as is.
+type Plan struct {
+	Version int    `yaml:"version"`
+	Parent  string `yaml:"parent"`
+	Base    string `yaml:"base,omitempty"` // base branch; empty for uncommitted changes
+	Mode    string `yaml:"mode"`
+	// Head is the commit the plan was made at, and Snapshot the tree of the
+	// uncommitted changes it splits (see snapshotTree). Hunk numbers are
+	// only meaningful for these exact changes.
+	Head     string      `yaml:"head"`
+	Snapshot string      `yaml:"snapshot,omitempty"`
+	Groups   []PlanGroup `yaml:"groups"`
+}
+
+// PlanGroup is one child branch of a Plan.
+type PlanGroup struct {
+	Name   string      `yaml:"name"`
+	Branch string      `yaml:"branch"`
+	Title  string      `yaml:"title,omitempty"` // empty: rendered from pr_template at apply time
+	Order  int         `yaml:"order"`
+	Files  []string    `yaml:"files"`
+	Hunks  []PlanHunks `yaml:"hunks,omitempty"` // parts of files split by the hunk strategy
+}
+
+// PlanHunks assigns some hunks of a file to a group. Hunks are numbered from
+// 1 in the order of the file's diff.
+type PlanHunks struct {
+	File  string `yaml:"file" json:"file"`
+	Hunks []int  `yaml:"hunks" json:"hunks"`
+}
+
+const planHeader = `# prki split plan. Move files between groups, rename branches and titles,
+# add or remove groups, then run ` + "`prki apply`" + `.
+# Every changed file must belong to exactly one group, or each of its hunks
+# to exactly one group.
+`
+
+var (
+	planFile     string
+	planBase     string
+	planStrategy string
+	planParts    int
+	planModes    diffModeFlags
+
+	applyFile      string
+	applyAuto      bool
+	applyLocal     bool
+	applyDryRun    bool
+	applyDraft     bool
+	applyReviewers string
+	applyOutput    string
+)
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Write an editable split plan",
+	Long: `Analyze changes like prki split, but write the proposed split to a plan
+file instead of creating branches. Edit the file to move files between groups
+or to rename branches and PR titles, then run prki apply.
+
+The plan is written to .git/prki/plan.yaml unless --file is given.
+
+Examples:
+  prki plan
+  prki plan --strategy directory
+  prki plan --worktree
+  prki plan --file split.yaml`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		parentBranch, err := getCurrentBranch()
+		if err != nil {
+			return fmt.Errorf("failed to get current branch: %w", err)
+		}
+		mode := planModes.mode()
+		files, err := getChangedFiles(diffOptions{Base: planBase, Mode: mode, Hunks: planStrategy == "hunk"})
+		if err != nil {
+			return fmt.Errorf("failed to get changed files: %w", err)
+		}
+		if len(files) == 0 {
+			fmt.Println("No changed files found.")
+			return nil
+		}
+		src, err := newSplitContext(parentBranch, planBase, mode)
+		if err != nil {
+			return err
+		}
+		measureComplexity(files)
+		read := changeReader(mode, "")
+		groups, err := groupChanges(files, planStrategy, planParts, read)
+		if err != nil {
+			return err
+		}
+		p := newPlan(src, mode, groups)
+
+		path, err := planPath(planFile)
+		if err != nil {
+			return err
+		}
+		if p.Head, p.Snapshot, err = changesID(mode, path); err != nil {
+			return err
+		}
+		if err := savePlan(path, p); err != nil {
+			return err
+		}
+		groups = p.fileGroups(files)
+		linkDependencies(groups, read)
+		printProposal(os.Stdout, files, groups)
+		fmt.Printf("\nPlan written to %s\nEdit it if needed, then run `prki apply`.\n", path)
+		return nil
+	},
+}
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Create child branches and PRs from a split plan",
+	Long: `Execute the split plan written by prki plan exactly as it stands.
+
+Before anything is created the plan is checked against the current diff:
+every changed file must be assigned to exactly one group, and the plan must
+not list files that are no longer changed. A plan is refused once the branch
+has new commits, or the uncommitted changes it splits have changed; run prki
+plan again then. Like prki split, a failed apply is rolled back, and
+prki split --rollback undoes the last apply.
+
+Examples:
+  prki apply
+  prki apply --auto
+  prki apply --dry-run
+  prki apply --file split.yaml`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateOutput(applyOutput); err != nil {
+			return err
+		}
+		path, err := planPath(applyFile)
+		if err != nil {
+			return err
+		}
+		p, err := loadPlan(path)
+		if err != nil {
+			return err
+		}
+		mode, err := parseDiffMode(p.Mode)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		parentBranch, err := getCurrentBranch()
+		if err != nil {
+			return fmt.Errorf("failed to get current branch: %w", err)
+		}
+		if parentBranch != p.Parent {
+			return fmt.Errorf("%s is a plan for %s, but the current branch is %s", path, p.Parent, parentBranch)
+		}
+		if err := p.checkUpToDate(mode, path); err != nil {
+			return fmt.Errorf("%s is out of date (run `prki plan` again): %w", path, err)
+		}
+		files, err := getChangedFiles(diffOptions{Base: p.Base, Mode: mode, Hunks: p.usesHunks()})
+		if err != nil {
+			return fmt.Errorf("failed to get changed files: %w", err)
+		}
+		files = withoutPath(files, path)
+		if err := p.validate(files); err != nil {
+			return fmt.Errorf("%s does not match the current changes (fix it or run `prki plan` again):\n%w", path, err)
+		}
+
+		src, err := newSplitContext(parentBranch, p.Base, mode)
+		if err != nil {
+			return err
+		}
+		src.out = progressWriter(applyOutput)
+		src.auto, src.local, src.draft, src.reviewers = applyAuto, applyLocal, applyDraft, applyReviewers
+		if applyDryRun {
+			src.enableDryRun()
+		}
+		measureComplexity(files)
+		return executePlan(p, files, src, applyOutput)
+	},
+}
+
+// newPlan builds the default plan for groups, one child branch per group.
+func newPlan(src splitContext, mode diffMode, groups []FileGroup) *Plan {
+	p := &Plan{Version: planVersion, Parent: src.parentBranch, Base: src.baseBranch, Mode: mode.String()}
+	for _, g := range groups {
+		pg := PlanGroup{Name: g.Name, Branch: toBranchName(g.Name), Title: childPRTitle(src, g), Order: g.Order}
+		for _, f := range g.Files {
+			if f.Partial() {
+				pg.Hunks = append(pg.Hunks, PlanHunks{File: f.Path, Hunks: f.HunkIndexes()})
+			} else {
+				pg.Files = append(pg.Files, f.Path)
+			}
+		}
+		p.Groups = append(p.Groups, pg)
+	}
+	p.sortGroups()
+	return p
+}
+
+// changesID returns the HEAD commit and, for uncommitted changes, their
+// snapshot tree, which together identify the changes a plan splits. The plan
+// file at planFile is not part of them.
+func changesID(mode diffMode, planFile string) (head, snapshot string, err error) {
+	head, err = activeGit.RevParse("HEAD")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+	if mode.uncommitted() {
+		var exclude []string
+		if rel, ok := repoRelPath(planFile); ok {
+			exclude = append(exclude, rel)
+		}
+		if snapshot, err = snapshotTree(gitOutputEnv, mode, exclude...); err != nil {
+			return "", "", fmt.Errorf("failed to snapshot %s changes: %w", mode, err)
+		}
+	}
+	return head, snapshot, nil
+}
+
+// checkUpToDate fails when the changes differ from those the plan was made
+// for, so that its files and hunk numbers cannot silently mean something
+// else.
+func (p *Plan) checkUpToDate(mode diffMode, planFile string) error {
+	if p.Head == "" {
+		return fmt.Errorf("the plan does not record the commit it was made at")
+	}
+	head, snapshot, err := changesID(mode, planFile)
+	if err != nil {
+		return err
+	}
+	if head != p.Head {
+		return fmt.Errorf("%s has moved from %s to %s since the plan was written", p.Parent, shortSHA(p.Head), shortSHA(head))
+	}
+	if snapshot != p.Snapshot {
+		return fmt.Errorf("the %s changes differ from when the plan was written", mode)
+	}
+	return nil
+}
+
+// usesHunks reports whether the plan assigns hunks rather than whole files
+// anywhere, so that the hunks have to be loaded to apply it.
+func (p *Plan) usesHunks() bool {
+	for _, g := range p.Groups {
+		if len(g.Hunks) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// sortGroups orders the groups by Order, keeping the file order for ties.
+func (p *Plan) sortGroups() {
+	sort.SliceStable(p.Groups, func(i, j int) bool { return p.Groups[i].Order < p.Groups[j].Order })
+}
+
+// validate checks the plan against the current changes. All problems are
+// reported at once so the plan can be fixed in one go.
+func (p *Plan) validate(files []FileChange) error {
+	var errs []error
+	if p.Version != planVersion {
+		errs = append(errs, fmt.Errorf("  version: unsupported plan version %d (want %d)", p.Version, planVersion))
+	}
+	if len(p.Groups) == 0 {
+		errs = append(errs, fmt.Errorf("  groups: at least one group is required"))
+	}
+
+	changed := map[string]FileChange{}
+	for _, f := range files {
+		changed[f.Path] = f
+	}
+	branches := map[string]string{}
+	owner := map[string]string{}
+	hunkOwner := map[string]map[int]string{} // path -> hunk -> group
+	for i, g := range p.Groups {
+		name := g.Name
+		where := fmt.Sprintf("  groups[%d]", i)
+		if name == "" {
+			errs = append(errs, fmt.Errorf("%s: name is required", where))
+			name = strings.TrimSpace(where)
+		} else {
+			where = fmt.Sprintf("  groups[%d] (%s)", i, name)
+		}
+		switch {
+		case g.Branch == "":
+			errs = append(errs, fmt.Errorf("%s: branch is required", where))
+		case g.Branch == p.Parent:
+			errs = append(errs, fmt.Errorf("%s: branch must differ from the parent branch", where))
+		case branches[g.Branch] != "":
+			errs = append(errs, fmt.Errorf("%s: branch %s is also used by %s", where, g.Branch, branches[g.Branch]))
+		default:
+			branches[g.Branch] = name
+		}
+		if len(g.Files) == 0 && len(g.Hunks) == 0 {
+			errs = append(errs, fmt.Errorf("%s: at least one file is required", where))
+		}
+		for _, path := range g.Files {
+			switch {
+			case owner[path] == name:
+				errs = append(errs, fmt.Errorf("  %s: listed twice in %s", path, name))
+			case owner[path] != "":
+				errs = append(errs, fmt.Errorf("  %s: assigned to both %s and %s", path, owner[path], name))
+			case changed[path].Path == "":
+				errs = append(errs, fmt.Errorf("  %s: not in the current diff", path))
+			}
+			owner[path] = name
+		}
+		for _, ph := range g.Hunks {
+			f, ok := changed[ph.File]
+			if !ok {
+				errs = append(errs, fmt.Errorf("  %s: not in the current diff", ph.File))
+				continue
+			}
+			if hunkOwner[ph.File] == nil {
+				hunkOwner[ph.File] = map[int]string{}
+			}
+			for _, n := range ph.Hunks {
+				switch {
+				case n < 1 || n > f.hunkCount:
+					errs = append(errs, fmt.Errorf("  %s: hunk %d does not exist (the file has %d)", ph.File, n, f.hunkCount))
+				case hunkOwner[ph.File][n] == name:
+					errs = append(errs, fmt.Errorf("  %s: hunk %d listed twice in %s", ph.File, n, name))
+				case hunkOwner[ph.File][n] != "":
+					errs = append(errs, fmt.Errorf("  %s: hunk %d assigned to both %s and %s", ph.File, n, hunkOwner[ph.File][n], name))
+				}
+				hunkOwner[ph.File][n] = name
+			}
+		}
+	}
+	for _, f := range files {
+		hunks, split := hunkOwner[f.Path]
+		switch {
+		case split && owner[f.Path] != "":
+			errs = append(errs, fmt.Errorf("  %s: assigned to %s as a whole and by hunks", f.Path, owner[f.Path]))
+		case split:
+			for n := 1; n <= f.hunkCount; n++ {
+				if hunks[n] == "" {
+					errs = append(errs, fmt.Errorf("  %s: hunk %d changed but not assigned to any group", f.Path, n))
+				}
+			}
+		case owner[f.Path] == "":
+			errs = append(errs, fmt.Errorf("  %s: changed but not assigned to any group", f.Path))
+		}
+	}
+
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errors.Join(errs...)
+}
+
+// fileGroups resolves the plan's paths against the current changes. It
+// assumes the plan has been validated against files.
+func (p *Plan) fileGroups(files []FileChange) []FileGroup {
+	byPath := map[string]FileChange{}
+	for _, f := range files {
+		byPath[f.Path] = f
+	}
+	groups := make([]FileGroup, 0, len(p.Groups))
+	for _, pg := range p.Groups {
+		g := FileGroup{Name: pg.Name, Order: pg.Order}
+		for _, path := range pg.Files {
+			g.Files = append(g.Files, byPath[path])
+		}
+		for _, ph := range pg.Hunks {
+			f := byPath[ph.File]
+			var hunks []Hunk
+			for _, n := range ph.Hunks {
+				hunks = append(hunks, f.Hunks[n-1])
+			}
+			g.Files = append(g.Files, f.withHunks(hunks))
+		}
+		g.Files = joinHunks(g.Files)
+		groups = append(groups, g)
+	}
+	return groups
+}
+
+func parsePlan(path string, data []byte) (*Plan, error) {
+	p := &Plan{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(p); err != nil && err != io.EOF { // io.EOF: empty file
+		return nil, fmt.Errorf("%s: invalid plan: %w", path, err)
+	}
+	p.sortGroups()
+	return p, nil
+}
+
+func loadPlan(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no plan at %s; run `prki plan` first", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+	return parsePlan(path, data)
+}
+
+func savePlan(path string, p *Plan) error {
+	var buf bytes.Buffer
+	buf.WriteString(planHeader)
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(p); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+	return nil
+}
+
+// planPath returns file, or the default plan location inside .git so the
+// plan never shows up as a change itself.
+func planPath(file string) (string, error) {
+	if file != "" {
+		return file, nil
+	}
+	p, err := activeGit.GitPath("prki/plan.yaml")
+	if err != nil {
+		return "", err
+	}
+	return p, nil
+}
+
+// withoutPath drops the plan file itself from files, in case it was written
+// into the working tree and shows up as an untracked change.
+func withoutPath(files []FileChange, path string) []FileChange {
+	rel, ok := repoRelPath(path)
+	if !ok {
+		return files
+	}
+	kept := files[:0:0]
+	for _, f := range files {
+		if f.Path != rel {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// repoRelPath returns path relative to the repository root, or false when
+// it lies outside the working tree.
+func repoRelPath(path string) (string, bool) {
+	root, err := repoRoot()
+	if err != nil {
+		return "", false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// parseDiffMode is the inverse of diffMode.String.
+func parseDiffMode(s string) (diffMode, error) {
+	for _, m := range []diffMode{modeBranch, modeStaged, modeUnstaged, modeWorktree} {
+		if m.String() == s {
+			return m, nil
+		}
+	}
+	return modeBranch, fmt.Errorf("unknown mode %q (branch|staged|unstaged|worktree)", s)
+}
+
+func init() {
+	planCmd.Flags().StringVarP(&planFile, "file", "f", "", "Plan file to write (default: .git/prki/plan.yaml)")
+	planCmd.Flags().StringVar(&planBase, "base", "", "Base branch to compare against (default: origin's default branch)")
+	planCmd.Flags().StringVar(&planStrategy, "strategy", "semantic", "Grouping strategy (semantic|directory|filetype|hunk|imports)")
+	planCmd.Flags().IntVar(&planParts, "parts", 0, "Merge or split the groups into exactly this many balanced child PRs (0: as the strategy groups them)")
+	planModes.register(planCmd)
+	planCmd.MarkFlagsMutuallyExclusive("base", "staged", "unstaged", "worktree")
+
+	applyCmd.Flags().StringVarP(&applyFile, "file", "f", "", "Plan file to apply (default: .git/prki/plan.yaml)")
+	applyCmd.Flags().BoolVar(&applyAuto, "auto", false, "Skip all confirmation prompts")
+	applyCmd.Flags().BoolVar(&applyDraft, "draft", true, "Create child PRs as drafts")
+	applyCmd.Flags().BoolVar(&applyLocal, "local", false, "Only create the child branches locally; do not push them or open PRs")
+	applyCmd.Flags().BoolVar(&applyDryRun, "dry-run", false, "Print the git and gh commands instead of running them")
+	applyCmd.Flags().StringVar(&applyReviewers, "reviewers", "", "Comma-separated list of reviewers")
+	addOutputFlag(applyCmd, &applyOutput)
+
+	rootCmd.AddCommand(planCmd)
+	rootCmd.AddCommand(applyCmd)
+}
@@ -0,0 +1,303 @@
+package cmd
+
+import (
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlanValidate(t *testing.T) {
+	files := []FileChange{{Path: "go.mod"}, {Path: "cmd/a.go", hunkCount: 3}, {Path: "cmd/a_test.go"}}
+	valid := func() *Plan {
+		return &Plan{
+			Version: planVersion,
+			Parent:  "feature/x",
+			Mode:    "branch",
+			Groups: []PlanGroup{
+				{Name: "Config", Branch: "review/config", Order: 1, Files: []string{"go.mod"}},
+				{Name: "Core", Branch: "review/core", Order: 2, Files: []string{"cmd/a.go", "cmd/a_test.go"}},
+			},
+		}
+	}
+
+	tests := []struct {
+		name string
+		edit func(p *Plan)
+		want []string
+	}{
+		{"valid", func(p *Plan) {}, nil},
+		{"unassigned file", func(p *Plan) { p.Groups[1].Files = []string{"cmd/a.go"} }, []string{
+			"cmd/a_test.go: changed but not assigned to any group",
+		}},
+		{"file in two groups", func(p *Plan) { p.Groups[0].Files = append(p.Groups[0].Files, "cmd/a.go") }, []string{
+			"cmd/a.go: assigned to both Config and Core",
+		}},
+		{"file listed twice", func(p *Plan) { p.Groups[0].Files = append(p.Groups[0].Files, "go.mod") }, []string{
+			"go.mod: listed twice in Config",
+		}},
+		{"stale file", func(p *Plan) { p.Groups[0].Files = append(p.Groups[0].Files, "gone.go") }, []string{
+			"gone.go: not in the current diff",
+		}},
+		{"duplicate branch", func(p *Plan) { p.Groups[1].Branch = "review/config" }, []string{
+			"groups[1] (Core): branch review/config is also used by Config",
+		}},
+		{"branch is parent", func(p *Plan) { p.Groups[0].Branch = "feature/x" }, []string{
+			"groups[0] (Config): branch must differ from the parent branch",
+		}},
+		{"missing fields", func(p *Plan) { p.Groups[0] = PlanGroup{} }, []string{
+			"go.mod: changed but not assigned to any group",
+			"groups[0]: at least one file is required",
+			"groups[0]: branch is required",
+			"groups[0]: name is required",
+		}},
+		{"wrong version", func(p *Plan) { p.Version = 2 }, []string{
+			"version: unsupported plan version 2 (want 1)",
+		}},
+		{"hunks", func(p *Plan) {
+			p.Groups[1].Files = []string{"cmd/a_test.go"}
+			p.Groups[0].Hunks = []PlanHunks{{File: "cmd/a.go", Hunks: []int{2}}}
+			p.Groups[1].Hunks = []PlanHunks{{File: "cmd/a.go", Hunks: []int{3, 1}}}
+		}, nil},
+		{"hunk problems", func(p *Plan) {
+			p.Groups[1].Files = []string{"cmd/a_test.go"}
+			p.Groups[0].Hunks = []PlanHunks{{File: "cmd/a.go", Hunks: []int{1, 4}}, {File: "gone.go", Hunks: []int{1}}}
+			p.Groups[1].Hunks = []PlanHunks{{File: "cmd/a.go", Hunks: []int{1, 2, 2}}}
+		}, []string{
+			"cmd/a.go: hunk 1 assigned to both Config and Core",
+			"cmd/a.go: hunk 2 listed twice in Core",
+			"cmd/a.go: hunk 3 changed but not assigned to any group",
+			"cmd/a.go: hunk 4 does not exist (the file has 3)",
+			"gone.go: not in the current diff",
+		}},
+		{"file both whole and by hunks", func(p *Plan) {
+			p.Groups[0].Hunks = []PlanHunks{{File: "cmd/a.go", Hunks: []int{1, 2, 3}}}
+		}, []string{
+			"cmd/a.go: assigned to Core as a whole and by hunks",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := valid()
+			tt.edit(p)
+			err := p.validate(files)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("validate() = nil, want %v", tt.want)
+			}
+			var got []string
+			for _, l := range strings.Split(err.Error(), "\n") {
+				got = append(got, strings.TrimSpace(l))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validate() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestNewPlan(t *testing.T) {
+	groups := []FileGroup{
+		{Name: "Tests", Order: 4, Files: []FileChange{{Path: "a_test.go"}}},
+		{Name: "Infrastructure & Config", Order: 1, Files: []FileChange{{Path: "go.mod"}, {Path: "go.sum"}}},
+	}
+	p := newPlan(splitContext{parentBranch: "feature/x", baseBranch: "origin/main"}, modeBranch, groups)
+
+	want := &Plan{
+		Version: planVersion,
+		Parent:  "feature/x",
+		Base:    "origin/main",
+		Mode:    "branch",
+		Groups: []PlanGroup{
+			{Name: "Infrastructure & Config", Branch: "review/infrastructure-config", Title: "[Review] Infrastructure & Config", Order: 1, Files: []string{"go.mod", "go.sum"}},
+			{Name: "Tests", Branch: "review/tests", Title: "[Review] Tests", Order: 4, Files: []string{"a_test.go"}},
+		},
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("newPlan() =\n%+v\nwant\n%+v", p, want)
+	}
+}
+
+func TestPlanFileGroups(t *testing.T) {
+	files := []FileChange{{Path: "a.go", LinesAdded: 3}, {Path: "b.go", LinesDeleted: 2}}
+	p := &Plan{Groups: []PlanGroup{
+		{Name: "B", Order: 1, Files: []string{"b.go"}},
+		{Name: "A", Order: 2, Files: []string{"a.go"}},
+	}}
+	groups := p.fileGroups(files)
+	if len(groups) != 2 || groups[0].Name != "B" || !reflect.DeepEqual(groups[0].Files[0], files[1]) || !reflect.DeepEqual(groups[1].Files[0], files[0]) {
+		t.Errorf("fileGroups() = %+v", groups)
+	}
+}
+
+func TestSaveAndLoadPlan(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "plan.yaml")
+	p := &Plan{
+		Version: planVersion,
+		Parent:  "feature/x",
+		Mode:    "worktree",
+		Groups:  []PlanGroup{{Name: "Core", Branch: "review/core", Title: "Core changes", Order: 1, Files: []string{"a b.go"}}},
+	}
+	if err := savePlan(path, p); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadPlan(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, p) {
+		t.Errorf("loadPlan() = %+v, want %+v", got, p)
+	}
+}
+
+func TestParsePlan(t *testing.T) {
+	t.Run("sorts groups by order", func(t *testing.T) {
+		p, err := parsePlan("plan.yaml", []byte(`version: 1
+parent: feature/x
+mode: branch
+groups:
+  - {name: Tests, branch: review/tests, order: 2, files: [a_test.go]}
+  - {name: Core, branch: review/core, order: 1, files: [a.go]}
+`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Groups[0].Name != "Core" || p.Groups[1].Name != "Tests" {
+			t.Errorf("groups = %+v", p.Groups)
+		}
+	})
+	t.Run("unknown key", func(t *testing.T) {
+		_, err := parsePlan("plan.yaml", []byte("version: 1\ngroups:\n  - name: Core\n    file: [a.go]\n"))
+		if err == nil || !strings.Contains(err.Error(), "plan.yaml: invalid plan") {
+			t.Errorf("parsePlan() error = %v", err)
+		}
+	})
+}
+
+func TestLoadPlan_Missing(t *testing.T) {
+	_, err := loadPlan(filepath.Join(t.TempDir(), "plan.yaml"))
+	if err == nil || !strings.Contains(err.Error(), "run `prki plan` first") {
+		t.Errorf("loadPlan() error = %v", err)
+	}
+}
+
+func TestParseDiffMode(t *testing.T) {
+	for _, m := range []diffMode{modeBranch, modeStaged, modeUnstaged, modeWorktree} {
+		if got, err := parseDiffMode(m.String()); err != nil || got != m {
+			t.Errorf("parseDiffMode(%q) = %v, %v", m.String(), got, err)
+		}
+	}
+	if _, err := parseDiffMode("index"); err == nil {
+		t.Error("parseDiffMode(index) should fail")
+	}
+}
+
+func TestPlanPath_DefaultIsInsideGitDir(t *testing.T) {
+	newTestRepo(t)
+	path, err := planPath("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.ToSlash(path) != ".git/prki/plan.yaml" {
+		t.Errorf("planPath() = %q", path)
+	}
+	if got, _ := planPath("split.yaml"); got != "split.yaml" {
+		t.Errorf("planPath(split.yaml) = %q", got)
+	}
+}
+
+func TestWithoutPath(t *testing.T) {
+	newTestRepo(t)
+	files := []FileChange{{Path: "a.go"}, {Path: "split.yaml"}}
+	if got := withoutPath(files, "split.yaml"); len(got) != 1 || got[0].Path != "a.go" {
+		t.Errorf("withoutPath() = %+v", got)
+	}
+	if got := withoutPath(files, filepath.Join(t.TempDir(), "split.yaml")); len(got) != 2 {
+		t.Errorf("files outside the repository should be kept: %+v", got)
+	}
+}
+
+// TestExecutePlan_Worktree applies an edited plan to uncommitted changes,
+// creating the branches locally only.
+func TestExecutePlan_Worktree(t *testing.T) {
+	dir := newTestRepo(t)
+	writeFile(t, dir, "edited.go", "package a\n\nfunc f() {}\n")
+	writeFile(t, dir, "new.go", "package a\n")
+	writeFile(t, dir, "README.md", "# a\n")
+
+	files, err := getChangedFiles(diffOptions{Mode: modeWorktree})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Plan{
+		Version: planVersion,
+		Parent:  "main",
+		Mode:    "worktree",
+		Groups: []PlanGroup{
+			{Name: "Code", Branch: "split/code", Order: 1, Files: []string{"edited.go", "new.go"}},
+			{Name: "Docs", Branch: "split/docs", Order: 2, Files: []string{"README.md"}},
+		},
+	}
+	if err := p.validate(files); err != nil {
+		t.Fatal(err)
+	}
+	src, err := newSplitContext("main", "", modeWorktree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.out, src.auto, src.local = io.Discard, true, true
+	if err := executePlan(p, files, src, "json"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := runGit(t, dir, "diff", "--name-only", "main", "split/code"); got != "edited.go\nnew.go" {
+		t.Errorf("split/code changes %q", got)
+	}
+	if got := runGit(t, dir, "diff", "--name-only", "main", "split/docs"); got != "README.md" {
+		t.Errorf("split/docs changes %q", got)
+	}
+	if got := runGit(t, dir, "rev-parse", "--abbrev-ref", "HEAD"); got != "main" {
+		t.Errorf("HEAD moved to %s", got)
+	}
+}
+
+func TestApply_RefusesOutdatedPlan(t *testing.T) {
+	dir := newTestRepo(t)
+	writeFile(t, dir, "edited.go", "package a\n\nfunc f() {}\n")
+	writeFile(t, dir, "README.md", "# a\n")
+	setFlag(t, &planModes, diffModeFlags{worktree: true})
+	setFlag(t, &planFile, "split.yaml") // in the working tree, but not part of the changes
+	setFlag(t, &applyFile, "split.yaml")
+	setFlag(t, &applyDryRun, true)
+	setFlag(t, &applyOutput, "json")
+	apply := func() error {
+		_, err := captureStdout(t, func() error { return applyCmd.RunE(applyCmd, nil) })
+		return err
+	}
+
+	if _, err := captureStdout(t, func() error { return planCmd.RunE(planCmd, nil) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := apply(); err != nil {
+		t.Fatalf("apply of a fresh plan: %v", err)
+	}
+
+	writeFile(t, dir, "edited.go", "package a\n\nfunc g() {}\n")
+	if err := apply(); err == nil || !strings.Contains(err.Error(), "the worktree changes differ from when the plan was written") {
+		t.Errorf("apply after editing a file: %v", err)
+	}
+
+	if _, err := captureStdout(t, func() error { return planCmd.RunE(planCmd, nil) }); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "commit", "-q", "--allow-empty", "-m", "more")
+	if err := apply(); err == nil || !strings.Contains(err.Error(), "main has moved from") {
+		t.Errorf("apply after a new commit: %v", err)
+	}
+}
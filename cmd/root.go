@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
@@ -17,12 +19,32 @@ prki rescues already-large PRs by splitting them into meaningful groups.
 Commands:
   prki analyze    Analyze changes and propose a split plan
   prki split      Execute the split and create child branches/PRs
+  prki plan       Write an editable split plan
+  prki apply      Execute an edited split plan
   prki status     Show status of parent and child PRs
-  prki merge      Merge approved child PRs into the parent branch`,
+  prki merge      Merge approved child PRs into the parent branch
+  prki diff       Show the parent diff not covered by merged child PRs
+  prki check      Fail when the change exceeds size limits (CI, pre-push)`,
+	SilenceErrors: true,
+}
+
+// exitError makes Execute exit with a specific status code. The command has
+// already reported the problem, so nothing more is printed.
+type exitError struct {
+	code int
+}
+
+func (e *exitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
 }
 
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
+		var ee *exitError
+		if errors.As(err, &ee) {
+			os.Exit(ee.code)
+		}
+		fmt.Fprintln(os.Stderr, "Error:", err)
 		os.Exit(1)
 	}
 }
@@ -3,8 +3,8 @@ package cmd
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -12,15 +12,59 @@ import (
 
 var (
 	splitAuto      bool
+	splitBase      string
+	splitLocal     bool
+	splitDryRun    bool
 	splitDraft     bool
 	splitReviewers string
+	splitRollback  bool
 	splitStrategy  string
+	splitParts     int
+	splitModeFlags diffModeFlags
+	splitOutput    string
 )
 
+// splitContext says where child branches start from, where the group files
+// are taken from, and what the child PRs point back to.
+type splitContext struct {
+	parentBranch string
+	baseBranch   string    // branch the parent PR targets; empty for uncommitted changes
+	parentPR     int       // parent PR number, 0 if unknown
+	mode         diffMode  // which changes are split
+	base         string    // commit each child branch starts from
+	contents     string    // commit or branch holding the changed files; a snapshot is taken on execution when empty
+	out          io.Writer // progress and prompts
+
+	auto      bool // skip prompts
+	local     bool // create the child branches only, without pushing them or opening PRs
+	draft     bool
+	reviewers string // comma-separated
+	// dryRun, when set, receives every git and gh command that would change
+	// the repository or the remote instead of running it.
+	dryRun *commandRecorder
+	// journal records what the split created, for rollback.
+	journal *journal
+}
+
 type splitResult struct {
 	group  FileGroup
 	branch string
+	commit string
 	prURL  string
+	err    error // set when the child branch could not be created
+}
+
+// splitReport is the output of prki split and prki apply.
+type splitReport struct {
+	reportHeader `yaml:",inline"`
+	Parent       string            `json:"parent" yaml:"parent"`
+	Base         string            `json:"base,omitempty" yaml:"base,omitempty"`
+	Mode         string            `json:"mode" yaml:"mode"`
+	DryRun       bool              `json:"dryRun" yaml:"dryRun"`
+	Cancelled    bool              `json:"cancelled" yaml:"cancelled"`
+	RolledBack   bool              `json:"rolledBack" yaml:"rolledBack"` // a child branch failed and everything created was undone
+	Groups       []fileGroupView   `json:"groups" yaml:"groups"`
+	Results      []splitResultView `json:"results" yaml:"results"`
 }
 
 var splitCmd = &cobra.Command{
@@ -29,115 +73,343 @@ var splitCmd = &cobra.Command{
 	Long: `Analyze changes in the current branch, create child branches for each group,
 and open draft PRs against the current branch for focused review.
 
-Each child branch is created from main with only the files in its group,
-so reviewers see a clean, focused diff.
+Each child branch is created from the merge-base of the current branch and
+the base branch (--base, or the remote's default branch) with only the files
+in its group, so reviewers see a clean, focused diff.
+
+With --staged, --unstaged or --worktree, uncommitted changes are split
+instead: child branches start from HEAD and receive the uncommitted
+contents of their files.
+
+Child commits are built in a temporary index, so the current checkout, the
+index and any uncommitted work are never touched.
+
+With --dry-run nothing is changed: every git and gh command that would run is
+printed instead, including the rendered child PR titles and bodies.
+
+Every branch, commit, push and PR the split creates is journaled. When a
+child branch cannot be created, pushed or given its PR, everything created
+so far is rolled back, leaving the parent branch as it was. With --local the
+child branches are only created locally, to push and open PRs for by hand. prki split --rollback undoes the last
+split, e.g. to start over with a different grouping.
+
+The resulting parent/child tree is committed to refs/prki/tree/<parent> and
+pushed with the child branches; prki status, diff and merge read the child
+PRs from it.
+
+To adjust the grouping by hand, use prki plan and prki apply instead.
 
 Examples:
   prki split
   prki split --auto
+  prki split --dry-run
+  prki split --local
+  prki split --rollback
   prki split --draft=false
   prki split --reviewers alice,bob
-  prki split --strategy directory`,
+  prki split --strategy directory
+  prki split --parts 3
+  prki split --base develop
+  prki split --unstaged
+  prki split --auto --output json`,
 	RunE: runSplit,
 }
 
 func runSplit(cmd *cobra.Command, args []string) error {
+	if err := validateOutput(splitOutput); err != nil {
+		return err
+	}
+	if splitRollback {
+		return rollbackSplit()
+	}
+
 	parentBranch, err := getCurrentBranch()
 	if err != nil {
 		return fmt.Errorf("failed to get current branch: %w", err)
 	}
 
-	files, err := getChangedFiles("")
+	mode := splitModeFlags.mode()
+	files, err := getChangedFiles(diffOptions{Base: splitBase, Mode: mode, Hunks: splitStrategy == "hunk"})
 	if err != nil {
 		return fmt.Errorf("failed to get changed files: %w", err)
 	}
 	if len(files) == 0 {
-		fmt.Println("No changed files found.")
-		return nil
+		report := newSplitReport(&Plan{Parent: parentBranch, Mode: mode.String()})
+		return writeReport(os.Stdout, splitOutput, report, func(w io.Writer) error {
+			fmt.Fprintln(w, "No changed files found.")
+			return nil
+		})
 	}
 
-	calculateComplexity(files)
-	groups := groupFiles(files, splitStrategy)
+	src, err := newSplitContext(parentBranch, splitBase, mode)
+	if err != nil {
+		return err
+	}
+	src.out = progressWriter(splitOutput)
+	src.auto, src.local, src.draft, src.reviewers = splitAuto, splitLocal, splitDraft, splitReviewers
+	if splitDryRun {
+		src.enableDryRun()
+	}
+
+	measureComplexity(files)
+	groups, err := groupChanges(files, splitStrategy, splitParts, changeReader(mode, ""))
+	if err != nil {
+		return err
+	}
+	return executePlan(newPlan(src, mode, groups), files, src, splitOutput)
+}
 
+// newSplitContext works out where the child branches of parentBranch start
+// from and where their contents come from.
+func newSplitContext(parentBranch, base string, mode diffMode) (splitContext, error) {
+	src := splitContext{parentBranch: parentBranch, mode: mode, out: os.Stdout}
+	if !mode.uncommitted() {
+		var err error
+		src.baseBranch, err = resolveBase(base)
+		if err != nil {
+			return src, err
+		}
+		src.base, err = mergeBase(src.baseBranch, parentBranch)
+		if err != nil {
+			return src, err
+		}
+		src.contents = parentBranch
+	} else {
+		head, err := activeGit.RevParse("HEAD")
+		if err != nil {
+			return src, fmt.Errorf("failed to resolve HEAD: %w", err)
+		}
+		src.base = head
+	}
+	if usesPlaceholder("{parent_pr_number}") {
+		src.parentPR = findPRNumber(parentBranch)
+	}
+	return src, nil
+}
+
+// rollbackSplit undoes the split recorded in the journal.
+func rollbackSplit() error {
+	j, err := loadJournal()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Rolling back the split of %s...\n", j.Parent)
+	if err := j.rollback(os.Stdout, closedByRollback); err != nil {
+		return fmt.Errorf("rollback incomplete; fix the problems below and run `prki split --rollback` again:\n%w", err)
+	}
+	fmt.Println("Rolled back.")
+	return nil
+}
+
+// enableDryRun makes src record commands instead of running them. Prompts
+// are skipped, as nothing is created that could be confirmed.
+func (src *splitContext) enableDryRun() {
+	src.dryRun = newCommandRecorder(src.out)
+	src.auto = true
+}
+
+// repo is the Git the split changes the repository with.
+func (src splitContext) repo() Git {
+	if src.dryRun != nil {
+		return src.dryRun.repo()
+	}
+	return activeGit
+}
+
+// gitEnv is the gitFunc for the plumbing commands of a snapshot.
+func (src splitContext) gitEnv(env []string, args ...string) (string, error) {
+	if src.dryRun != nil {
+		return src.dryRun.git(env, args...)
+	}
+	return gitOutputEnv(env, args...)
+}
+
+// forge returns the forge to create child PRs on; in dry-run mode it only
+// records the commands.
+func (src splitContext) forge() Forge {
+	return currentForge(src.dryRun)
+}
+
+func newSplitReport(p *Plan) splitReport {
+	return splitReport{
+		reportHeader: newReportHeader("split"),
+		Parent:       p.Parent,
+		Base:         p.Base,
+		Mode:         p.Mode,
+		Groups:       []fileGroupView{},
+		Results:      []splitResultView{},
+	}
+}
+
+// printProposal shows the child branches about to be created for groups.
+func printProposal(w io.Writer, files []FileChange, groups []FileGroup) {
 	totalLines := 0
 	for _, f := range files {
 		totalLines += f.TotalLines()
 	}
 
-	fmt.Print("\n🌳 Analyzing PR tree...\n\n")
-	fmt.Printf("Current changes: %d files, %d lines\n\n", len(files), totalLines)
-	fmt.Println("Split proposal:")
+	fmt.Fprint(w, "\n🌳 Analyzing PR tree...\n\n")
+	fmt.Fprintf(w, "Current changes: %d files, %d lines\n\n", len(files), totalLines)
+	fmt.Fprintln(w, "Split proposal:")
 	for i, g := range groups {
 		connector := "├─"
 		if i == len(groups)-1 {
 			connector = "└─"
 		}
-		fmt.Printf("  %s %s (%d files, %d lines)\n", connector, g.Name, len(g.Files), g.TotalLines())
+		fmt.Fprintf(w, "  %s %s (%d files, %d lines)\n", connector, g.Name, len(g.Files), g.TotalLines())
+	}
+	var order []string
+	for _, g := range groups {
+		order = append(order, g.Name)
 	}
+	writeDependencyNotes(w, order, dependencyWarnings(groups))
+}
 
-	if !splitAuto {
-		fmt.Print("\nProceed? [Y/n] ")
+// executePlan creates the child branches and PRs of p, which must have been
+// validated against files, and writes the split report in format.
+func executePlan(p *Plan, files []FileChange, src splitContext, format string) error {
+	groups := p.fileGroups(files)
+	linkDependencies(groups, changeReader(src.mode, src.contents))
+	report := newSplitReport(p)
+	report.Groups = newFileGroupViews(groups)
+	for i := range report.Groups {
+		report.Groups[i].Branch = p.Groups[i].Branch
+	}
+
+	report.DryRun = src.dryRun != nil
+
+	printProposal(src.out, files, groups)
+	if !src.auto {
+		fmt.Fprint(src.out, "\nProceed? [Y/n] ")
 		reader := bufio.NewReader(os.Stdin)
 		ans, _ := reader.ReadString('\n')
 		if strings.TrimSpace(strings.ToLower(ans)) == "n" {
-			fmt.Println("Cancelled.")
-			return nil
+			report.Cancelled = true
+			return writeReport(os.Stdout, format, report, func(w io.Writer) error {
+				fmt.Fprintln(w, "Cancelled.")
+				return nil
+			})
 		}
 	}
 
-	fmt.Println()
+	fmt.Fprintln(src.out)
+	if src.dryRun == nil {
+		j, err := startJournal(src.parentBranch)
+		if err != nil {
+			return err
+		}
+		src.journal = j
+	}
+	if src.contents == "" {
+		snapshot, err := snapshotCommit(src.gitEnv, src.mode)
+		if err != nil {
+			return fmt.Errorf("failed to snapshot %s changes: %w", src.mode, err)
+		}
+		src.contents = snapshot
+	}
 	var results []splitResult
-	for _, g := range groups {
-		r, err := createChildBranchAndPR(g, parentBranch)
+	for i, g := range groups {
+		pg := p.Groups[i]
+		r, err := createChildBranchAndPR(g, pg, src)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "  ✗ %s: %v\n", g.Name, err)
-			// always return to parent before continuing
-			_ = gitSilent("checkout", parentBranch)
-			continue
+			results = append(results, splitResult{group: g, branch: pg.Branch, err: err})
+			if src.journal == nil {
+				continue
+			}
+			fmt.Fprintln(src.out, "\n  Rolling back...")
+			if rbErr := src.journal.rollback(src.out, closedBySplitFailure); rbErr != nil {
+				return fmt.Errorf("split failed at %s: %w\nrollback incomplete; fix the problems below and run `prki split --rollback`:\n%w", g.Name, err, rbErr)
+			}
+			report.RolledBack = true
+			break
 		}
 		results = append(results, *r)
 	}
+	if !report.RolledBack && src.parentBranch != "HEAD" {
+		if err := saveSplitTree(src, results); err != nil {
+			fmt.Fprintf(os.Stderr, "  ⚠  Could not record the split tree: %v\n", err)
+		}
+	}
 
-	// ensure we are back on the parent branch
-	_ = gitSilent("checkout", parentBranch)
-
-	fmt.Printf("\n%d child PR(s) created:\n", len(results))
 	for _, r := range results {
-		if r.prURL != "" {
-			fmt.Printf("  ✓ [%s] branch: %s\n    %s\n", r.group.Name, r.branch, r.prURL)
-		} else {
-			fmt.Printf("  ✓ [%s] branch: %s  (push and create PR manually)\n", r.group.Name, r.branch)
+		v := splitResultView{Group: r.group.Name, Branch: r.branch, PRURL: r.prURL}
+		if r.err != nil {
+			v.Error = r.err.Error()
 		}
+		report.Results = append(report.Results, v)
+	}
+	if err := writeReport(os.Stdout, format, report, func(w io.Writer) error {
+		writeSplitText(w, report)
+		return nil
+	}); err != nil {
+		return err
+	}
+	if report.RolledBack {
+		return fmt.Errorf("split failed and was rolled back")
 	}
-	fmt.Println("\nNext steps:")
-	fmt.Println("  1. Request reviews on each child PR")
-	fmt.Println("  2. After all approvals, merge parent PR into main")
 	return nil
 }
 
-func createChildBranchAndPR(g FileGroup, parentBranch string) (*splitResult, error) {
-	branch := toBranchName(g.Name)
-	filePaths := make([]string, len(g.Files))
-	for i, f := range g.Files {
-		filePaths[i] = f.Path
+func writeSplitText(w io.Writer, r splitReport) {
+	if r.DryRun {
+		fmt.Fprintf(w, "\nDry run: %d child PR(s) would be created; nothing was changed.\n", len(r.Results))
+		for _, res := range r.Results {
+			fmt.Fprintf(w, "  • [%s] branch: %s\n", res.Group, res.Branch)
+		}
+		return
 	}
-
-	// Create child branch from main
-	fmt.Printf("  Creating branch %s...\n", branch)
-	if err := gitSilent("checkout", "-b", branch, "main"); err != nil {
-		return nil, fmt.Errorf("could not create branch %s (already exists?): %w", branch, err)
+	if r.RolledBack {
+		failed := r.Results[len(r.Results)-1]
+		fmt.Fprintf(w, "\nCreating %s failed: %s\n", failed.Branch, failed.Error)
+		fmt.Fprintf(w, "Everything the split created was rolled back; %s is unchanged.\n", r.Parent)
+		return
+	}
+	created := 0
+	for _, res := range r.Results {
+		if res.Error == "" {
+			created++
+		}
+	}
+	fmt.Fprintf(w, "\n%d child PR(s) created:\n", created)
+	for _, res := range r.Results {
+		switch {
+		case res.Error != "":
+			continue
+		case res.PRURL != "":
+			fmt.Fprintf(w, "  ✓ [%s] branch: %s\n    %s\n", res.Group, res.Branch, res.PRURL)
+		default:
+			fmt.Fprintf(w, "  ✓ [%s] branch: %s  (push and create PR manually)\n", res.Group, res.Branch)
+		}
 	}
+	fmt.Fprintln(w, "\nNext steps:")
+	fmt.Fprintln(w, "  1. Request reviews on each child PR")
+	if r.Base == "" {
+		fmt.Fprintf(w, "  2. After all approvals, pull %s to pick up the merged changes\n", r.Parent)
+	} else {
+		fmt.Fprintf(w, "  2. After all approvals, merge parent PR into %s\n", strings.TrimPrefix(r.Base, "origin/"))
+	}
+}
 
-	// Checkout only this group's files from the parent branch
-	checkoutArgs := append([]string{"checkout", parentBranch, "--"}, filePaths...)
-	if err := gitSilent(checkoutArgs...); err != nil {
-		return nil, fmt.Errorf("failed to checkout files from %s: %w", parentBranch, err)
+func createChildBranchAndPR(g FileGroup, pg PlanGroup, src splitContext) (*splitResult, error) {
+	parentBranch := src.parentBranch
+	branch := pg.Branch
+	var filePaths []string
+	var patch strings.Builder
+	for _, f := range g.Files {
+		if f.Partial() {
+			patch.WriteString(hunkPatch(f))
+		} else {
+			filePaths = append(filePaths, f.Paths()...)
+		}
 	}
 
+	fmt.Fprintf(src.out, "  Creating branch %s...\n", branch)
+
 	// Commit message
 	commitMsg := defaultCommitMsg(g.Name)
-	if !splitAuto {
-		fmt.Printf("  Commit message for %s\n  (Enter to use default: %q): ", branch, commitMsg)
+	if !src.auto {
+		fmt.Fprintf(src.out, "  Commit message for %s\n  (Enter to use default: %q): ", branch, commitMsg)
 		reader := bufio.NewReader(os.Stdin)
 		input, _ := reader.ReadString('\n')
 		if msg := strings.TrimSpace(input); msg != "" {
@@ -145,55 +417,108 @@ func createChildBranchAndPR(g FileGroup, parentBranch string) (*splitResult, err
 		}
 	}
 
-	if err := gitSilent("commit", "-m", commitMsg); err != nil {
+	// Commit this group's files from the parent on top of the merge-base
+	commit, err := src.repo().CommitTree(TreeCommit{
+		Parent:  src.base,
+		Source:  src.contents,
+		Paths:   filePaths,
+		Patch:   patch.String(),
+		Message: commitMsg,
+	})
+	if err != nil {
 		return nil, fmt.Errorf("commit failed: %w", err)
 	}
+	if err := src.journal.record(journalAction{Kind: actionCommit, Branch: branch, Commit: commit}); err != nil {
+		return nil, err
+	}
+	if err := src.repo().CreateBranch(branch, commit); err != nil {
+		return nil, fmt.Errorf("could not create branch %s (already exists?): %w", branch, err)
+	}
+	if err := src.journal.record(journalAction{Kind: actionBranch, Branch: branch, Commit: commit}); err != nil {
+		return nil, err
+	}
+
+	if src.local {
+		return &splitResult{group: g, branch: branch, commit: commit}, nil
+	}
 
 	// Push
-	fmt.Printf("  Pushing %s...\n", branch)
-	if err := gitSilent("push", "-u", "origin", branch); err != nil {
-		fmt.Printf("  ⚠  Push failed — branch %s created locally only.\n", branch)
-		return &splitResult{group: g, branch: branch}, nil
+	fmt.Fprintf(src.out, "  Pushing %s...\n", branch)
+	if err := src.repo().Push("refs/heads/"+branch, branch, ""); err != nil {
+		return nil, fmt.Errorf("push failed: %w", err)
+	}
+	if err := src.journal.record(journalAction{Kind: actionPush, Branch: branch}); err != nil {
+		return nil, err
 	}
 
-	// Create PR via gh CLI
-	prURL, err := ghCreatePR(branch, parentBranch, g)
+	prURL, err := createChildPR(pg, src, g)
+	if err != nil && prURL == "" {
+		return nil, fmt.Errorf("PR creation into %s failed: %w", parentBranch, err)
+	}
 	if err != nil {
-		fmt.Printf("  ⚠  PR creation failed: %v\n    Create it manually: gh pr create --base %s --head %s\n", err, parentBranch, branch)
-		return &splitResult{group: g, branch: branch}, nil
+		fmt.Fprintf(src.out, "  ⚠  %v\n", err)
 	}
 
-	return &splitResult{group: g, branch: branch, prURL: prURL}, nil
+	if err := src.journal.record(journalAction{Kind: actionPR, Branch: branch, PR: prURL}); err != nil {
+		return nil, err
+	}
+	return &splitResult{group: g, branch: branch, commit: commit, prURL: prURL}, nil
 }
 
-func ghCreatePR(branch, base string, g FileGroup) (string, error) {
-	if _, err := exec.LookPath("gh"); err != nil {
-		return "", fmt.Errorf("gh CLI not found (https://cli.github.com)")
+func createChildPR(pg PlanGroup, src splitContext, g FileGroup) (string, error) {
+	pr := NewPR{
+		Base:  src.parentBranch,
+		Head:  pg.Branch,
+		Title: pg.Title,
+		Body:  childPRBody(src, g),
+		Draft: src.draft,
 	}
-
-	ghArgs := []string{
-		"pr", "create",
-		"--base", base,
-		"--head", branch,
-		"--title", fmt.Sprintf("[Review] %s", g.Name),
-		"--body", buildPRBody(base, g),
+	if pr.Title == "" {
+		pr.Title = childPRTitle(src, g)
 	}
-	if splitDraft {
-		ghArgs = append(ghArgs, "--draft")
+	if activeConfig != nil {
+		pr.Labels = activeConfig.GitHub.AddLabels
 	}
-	if splitReviewers != "" {
-		for _, r := range strings.Split(splitReviewers, ",") {
-			if r = strings.TrimSpace(r); r != "" {
-				ghArgs = append(ghArgs, "--reviewer", r)
-			}
+	for _, r := range strings.Split(src.reviewers, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			pr.Reviewers = append(pr.Reviewers, r)
 		}
 	}
+	return src.forge().CreatePR(pr)
+}
+
+// childPRTitle renders the configured title template, defaulting to "[Review] <group>".
+func childPRTitle(src splitContext, g FileGroup) string {
+	if activeConfig != nil && activeConfig.PRTemplate.Child.Title != "" {
+		return renderTemplate(activeConfig.PRTemplate.Child.Title, src.parentBranch, src.baseBranch, src.parentPR, g)
+	}
+	return fmt.Sprintf("[Review] %s", g.Name)
+}
+
+// childPRBody renders the configured body template, defaulting to buildPRBody.
+func childPRBody(src splitContext, g FileGroup) string {
+	if activeConfig != nil && activeConfig.PRTemplate.Child.Body != "" {
+		return renderTemplate(activeConfig.PRTemplate.Child.Body, src.parentBranch, src.baseBranch, src.parentPR, g)
+	}
+	return buildPRBody(src.parentBranch, g)
+}
+
+// usesPlaceholder reports whether the configured PR templates reference ph.
+func usesPlaceholder(ph string) bool {
+	if activeConfig == nil {
+		return false
+	}
+	t := activeConfig.PRTemplate.Child
+	return strings.Contains(t.Title, ph) || strings.Contains(t.Body, ph)
+}
 
-	out, err := exec.Command("gh", ghArgs...).Output()
+// findPRNumber returns the number of the open PR whose head is branch, or 0.
+func findPRNumber(branch string) int {
+	n, err := currentForge(nil).FindPR(branch)
 	if err != nil {
-		return "", err
+		return 0
 	}
-	return strings.TrimSpace(string(out)), nil
+	return n
 }
 
 func buildPRBody(parentBranch string, g FileGroup) string {
@@ -204,7 +529,7 @@ func buildPRBody(parentBranch string, g FileGroup) string {
 	sb.WriteString(fmt.Sprintf("**Group:** %s\n\n", g.Name))
 	sb.WriteString("## Files in This PR\n\n")
 	for _, f := range g.Files {
-		sb.WriteString(fmt.Sprintf("- `%s` (+%d/-%d lines)\n", f.Path, f.LinesAdded, f.LinesDeleted))
+		sb.WriteString(fileListItem(f))
 	}
 	sb.WriteString("\n## Context\n\n")
 	sb.WriteString("This PR is part of a larger feature split for easier review.  \n")
@@ -213,23 +538,16 @@ func buildPRBody(parentBranch string, g FileGroup) string {
 	return sb.String()
 }
 
-func defaultCommitMsg(groupName string) string {
-	return fmt.Sprintf("[Review] %s", groupName)
-}
-
-// gitSilent runs a git command, suppressing stdout but showing stderr.
-func gitSilent(args ...string) error {
-	cmd := exec.Command("git", args...)
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+// fileListItem is the Markdown list item of f in a PR body.
+func fileListItem(f FileChange) string {
+	if f.Status == statusRenamed && f.OldPath != "" {
+		return fmt.Sprintf("- `%s` → `%s` %s\n", f.OldPath, f.Path, f.Summary())
+	}
+	return fmt.Sprintf("- `%s` %s\n", f.Path, f.Summary())
 }
 
-func getCurrentBranch() (string, error) {
-	out, err := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD").Output()
-	if err != nil {
-		return "", err
-	}
-	return strings.TrimSpace(string(out)), nil
+func defaultCommitMsg(groupName string) string {
+	return fmt.Sprintf("[Review] %s", groupName)
 }
 
 func toBranchName(groupName string) string {
@@ -246,9 +564,17 @@ func toBranchName(groupName string) string {
 
 func init() {
 	splitCmd.Flags().BoolVar(&splitAuto, "auto", false, "Skip all confirmation prompts")
+	splitCmd.Flags().StringVar(&splitBase, "base", "", "Base branch to compare against (default: origin's default branch)")
+	splitCmd.Flags().BoolVar(&splitLocal, "local", false, "Only create the child branches locally; do not push them or open PRs")
+	splitCmd.Flags().BoolVar(&splitDryRun, "dry-run", false, "Print the git and gh commands instead of running them")
 	splitCmd.Flags().BoolVar(&splitDraft, "draft", true, "Create child PRs as drafts")
 	splitCmd.Flags().StringVar(&splitReviewers, "reviewers", "", "Comma-separated list of reviewers")
-	splitCmd.Flags().StringVar(&splitStrategy, "strategy", "semantic", "Grouping strategy (semantic|directory|filetype)")
+	splitCmd.Flags().BoolVar(&splitRollback, "rollback", false, "Undo the last split: close its PRs and delete its branches")
+	splitCmd.Flags().StringVar(&splitStrategy, "strategy", "semantic", "Grouping strategy (semantic|directory|filetype|hunk|imports)")
+	splitCmd.Flags().IntVar(&splitParts, "parts", 0, "Merge or split the groups into exactly this many balanced child PRs (0: as the strategy groups them)")
+	splitModeFlags.register(splitCmd)
+	addOutputFlag(splitCmd, &splitOutput)
+	splitCmd.MarkFlagsMutuallyExclusive("base", "staged", "unstaged", "worktree")
 
 	rootCmd.AddCommand(splitCmd)
 }
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"fmt"
+	"io"
 	"strings"
 	"testing"
 )
@@ -100,6 +102,43 @@ func TestBuildPRBody_DeletionOnly(t *testing.T) {
 	}
 }
 
+func TestBuildPRBody_RenamedAndDeleted(t *testing.T) {
+	g := FileGroup{
+		Name: "Cleanup",
+		Files: []FileChange{
+			{Path: "cmd/new.go", OldPath: "cmd/old.go", Status: statusRenamed, LinesAdded: 2, LinesDeleted: 1},
+			{Path: "cmd/merge.go", Status: statusDeleted, LinesDeleted: 38},
+		},
+	}
+	body := buildPRBody("feature/cleanup", g)
+	for _, want := range []string{
+		"- `cmd/old.go` → `cmd/new.go` (renamed, +2/-1 lines)",
+		"- `cmd/merge.go` (deleted, -38 lines)",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("buildPRBody() lacks %q, body:\n%s", want, body)
+		}
+	}
+}
+
+func TestFileChange_Summary(t *testing.T) {
+	tests := []struct {
+		f    FileChange
+		want string
+	}{
+		{FileChange{LinesAdded: 10, LinesDeleted: 2}, "(+10/-2 lines)"},
+		{FileChange{Binary: true, SizeDelta: 200}, "(binary, +200 B)"},
+		{FileChange{Binary: true, SizeDelta: -1536}, "(binary, -1.5 KB)"},
+		{FileChange{Binary: true, SizeDelta: 3 << 20}, "(binary, +3.0 MB)"},
+		{FileChange{Binary: true, Status: statusDeleted, SizeDelta: -10}, "(binary, deleted)"},
+	}
+	for _, tt := range tests {
+		if got := tt.f.Summary(); got != tt.want {
+			t.Errorf("%+v.Summary() = %q, want %q", tt.f, got, tt.want)
+		}
+	}
+}
+
 func TestToBranchName_EdgeCases(t *testing.T) {
 	tests := []struct {
 		input string
@@ -124,3 +163,212 @@ func TestToBranchName_EdgeCases(t *testing.T) {
 		})
 	}
 }
+
+func TestChildPRTitleAndBody_Template(t *testing.T) {
+	g := FileGroup{Name: "Tests", Files: []FileChange{{Path: "a_test.go", LinesAdded: 1}}}
+	src := splitContext{parentBranch: "feature/x", baseBranch: "main", parentPR: 42}
+
+	if got := childPRTitle(src, g); got != "[Review] Tests" {
+		t.Errorf("default title = %q", got)
+	}
+	if got := childPRBody(src, g); got != buildPRBody("feature/x", g) {
+		t.Errorf("default body should be buildPRBody, got:\n%s", got)
+	}
+
+	cfg, err := parseConfig(".prki.yaml", []byte("pr_template:\n  child:\n    title: '{group_name} -> #{parent_pr_number}'\n    body: 'files:\n\n      {file_list}'\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	activeConfig = cfg
+	t.Cleanup(func() { activeConfig = nil })
+
+	if got := childPRTitle(src, g); got != "Tests -> #42" {
+		t.Errorf("templated title = %q", got)
+	}
+	if got := childPRBody(src, g); !strings.Contains(got, "- `a_test.go` (+1/-0 lines)") {
+		t.Errorf("templated body = %q", got)
+	}
+	if !usesPlaceholder("{parent_pr_number}") || usesPlaceholder("{base_branch}") {
+		t.Error("usesPlaceholder should reflect the configured templates")
+	}
+}
+
+func TestExecutePlan_BranchModeLeavesCheckoutAlone(t *testing.T) {
+	dir := newTestRepo(t)
+	runGit(t, dir, "checkout", "-q", "-b", "feature")
+	writeFile(t, dir, "edited.go", "package a\n\nfunc f() {}\n")
+	writeFile(t, dir, "README.md", "# a\n")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "feature")
+	// uncommitted work that must survive the split
+	writeFile(t, dir, "edited.go", "package a // wip\n")
+	writeFile(t, dir, "scratch.txt", "notes\n")
+	runGit(t, dir, "add", "scratch.txt")
+	statusBefore := runGit(t, dir, "status", "--porcelain")
+
+	files, err := getChangedFiles(diffOptions{Base: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := newSplitContext("feature", "main", modeBranch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.out, src.auto, src.local = io.Discard, true, true
+	if err := executePlan(newPlan(src, modeBranch, groupBySemantic(files)), files, src, "json"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := runGit(t, dir, "status", "--porcelain"); got != statusBefore {
+		t.Errorf("status changed:\n%s\nwant:\n%s", got, statusBefore)
+	}
+	if got := runGit(t, dir, "rev-parse", "--abbrev-ref", "HEAD"); got != "feature" {
+		t.Errorf("HEAD moved to %s", got)
+	}
+	if got := runGit(t, dir, "show", "review/core-business-logic:edited.go"); got != "package a\n\nfunc f() {}" {
+		t.Errorf("child branch has edited.go = %q, want the committed version", got)
+	}
+	if got := runGit(t, dir, "diff", "--name-only", "main", "review/documentation"); got != "README.md" {
+		t.Errorf("review/documentation changes %q", got)
+	}
+}
+
+func TestExecutePlan_RenamesAndDeletions(t *testing.T) {
+	dir := newTestRepo(t)
+	writeFile(t, dir, "old.go", "package a\n\nfunc g() {}\n")
+	writeFile(t, dir, "gone.md", "# gone\n")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "more")
+	runGit(t, dir, "checkout", "-q", "-b", "feature")
+	runGit(t, dir, "mv", "old.go", "new.go")
+	runGit(t, dir, "rm", "-q", "gone.md")
+	runGit(t, dir, "commit", "-q", "-m", "feature")
+
+	files, err := getChangedFiles(diffOptions{Base: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := newSplitContext("feature", "main", modeBranch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.out, src.auto, src.local = io.Discard, true, true
+	p := &Plan{
+		Version: planVersion,
+		Parent:  "feature",
+		Mode:    "branch",
+		Groups: []PlanGroup{
+			{Name: "Move", Branch: "split/move", Order: 1, Files: []string{"new.go"}},
+			{Name: "Delete", Branch: "split/delete", Order: 2, Files: []string{"gone.md"}},
+		},
+	}
+	if err := executePlan(p, files, src, "json"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := runGit(t, dir, "diff", "--name-status", "-M", "main", "split/move"); got != "R100\told.go\tnew.go" {
+		t.Errorf("split/move changes %q, want a rename", got)
+	}
+	if got := runGit(t, dir, "diff", "--name-status", "main", "split/delete"); got != "D\tgone.md" {
+		t.Errorf("split/delete changes %q, want a deletion", got)
+	}
+}
+
+func TestExecutePlan_BinaryFiles(t *testing.T) {
+	dir := newTestRepo(t)
+	runGit(t, dir, "checkout", "-q", "-b", "feature")
+	writeFile(t, dir, "edited.go", "package a\n\nfunc f() {}\n")
+	writeFile(t, dir, "assets/logo.png", "\x89PNG\x00\x01\x02")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "feature")
+
+	files, err := getChangedFiles(diffOptions{Base: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups := groupBySemantic(files)
+	if last := groups[len(groups)-1]; last.Name != "Assets" || len(last.Files) != 1 || last.Files[0].Path != "assets/logo.png" {
+		t.Fatalf("groups = %+v, want logo.png in Assets", groups)
+	}
+	src, err := newSplitContext("feature", "main", modeBranch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.out, src.auto, src.local = io.Discard, true, true
+	if err := executePlan(newPlan(src, modeBranch, groups), files, src, "text"); err != nil {
+		t.Fatal(err)
+	}
+	if got := runGit(t, dir, "diff", "--name-only", "main", "review/assets"); got != "assets/logo.png" {
+		t.Errorf("review/assets changes %q", got)
+	}
+	if got := runGit(t, dir, "rev-parse", "review/assets:assets/logo.png"); got != runGit(t, dir, "rev-parse", "feature:assets/logo.png") {
+		t.Errorf("review/assets has a different logo.png")
+	}
+}
+
+// unusualPaths are file names that break line- or whitespace-based parsing
+// and pathspec matching.
+var unusualPaths = []string{
+	"docs/My Design.md",
+	"docs/設計書.md",
+	"data/tab\there.txt",
+	"data/*.txt",
+	"data/:colon.txt",
+}
+
+func TestExecutePlan_UnusualPaths(t *testing.T) {
+	dir := newTestRepo(t)
+	runGit(t, dir, "checkout", "-q", "-b", "feature")
+	for _, p := range unusualPaths {
+		writeFile(t, dir, p, "content of "+p+"\n")
+	}
+	writeFile(t, dir, "data/plain.txt", "plain\n")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "feature")
+
+	files, err := getChangedFiles(diffOptions{Base: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]bool{}
+	for _, f := range files {
+		got[f.Path] = true
+		if f.LinesAdded != 1 {
+			t.Errorf("%q: %d lines added, want 1", f.Path, f.LinesAdded)
+		}
+	}
+	for _, p := range append(unusualPaths, "data/plain.txt") {
+		if !got[p] {
+			t.Errorf("getChangedFiles() lacks %q: %+v", p, files)
+		}
+	}
+
+	// one child branch per unusual path, plain.txt in a branch of its own
+	p := &Plan{Version: planVersion, Parent: "feature", Mode: "branch"}
+	for i, path := range unusualPaths {
+		p.Groups = append(p.Groups, PlanGroup{Name: path, Branch: fmt.Sprintf("split/%d", i), Order: i + 1, Files: []string{path}})
+	}
+	p.Groups = append(p.Groups, PlanGroup{Name: "plain", Branch: "split/plain", Order: len(unusualPaths) + 1, Files: []string{"data/plain.txt"}})
+	src, err := newSplitContext("feature", "main", modeBranch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.out, src.auto, src.local = io.Discard, true, true
+	if err := executePlan(p, files, src, "json"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, path := range unusualPaths {
+		branch := fmt.Sprintf("split/%d", i)
+		changed, err := branchFiles("main", branch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changed) != 1 || changed[0] != path {
+			t.Errorf("%s changes %q, want only %q", branch, changed, path)
+		}
+	}
+	if drift, err := driftedFiles("split/3", "feature", []string{"data/*.txt"}); err != nil || len(drift) != 0 {
+		t.Errorf("driftedFiles() = %q, %v; want no drift", drift, err)
+	}
+}
@@ -1,19 +1,39 @@
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
-	"os/exec"
+	"io"
+	"os"
 	"strings"
 
 	"github.com/spf13/cobra"
 )
 
+var (
+	statusBase      string
+	statusModeFlags diffModeFlags
+	statusOutput    string
+)
+
 // ChildPR represents a child pull request with its review status.
 type ChildPR struct {
-	Number         int    `json:"number"`
-	Title          string `json:"title"`
-	ReviewDecision string `json:"reviewDecision"`
+	Number            int           `json:"number"`
+	Title             string        `json:"title"`
+	ReviewDecision    string        `json:"reviewDecision"`
+	HeadRefName       string        `json:"headRefName"`
+	State             string        `json:"state"`
+	Mergeable         string        `json:"mergeable"`
+	StatusCheckRollup []CheckStatus `json:"statusCheckRollup"`
+}
+
+// CheckStatus is one entry of a PR's status check rollup: either a check run
+// (Status/Conclusion) or a commit status (State).
+type CheckStatus struct {
+	Name       string `json:"name"`
+	Context    string `json:"context"`
+	Status     string `json:"status"`
+	Conclusion string `json:"conclusion"`
+	State      string `json:"state"`
 }
 
 var statusCmd = &cobra.Command{
@@ -22,80 +42,134 @@ var statusCmd = &cobra.Command{
 	Long: `Display the current branch, child PR statuses, and a summary of changes.
 
 Examples:
-  prki status`,
+  prki status
+  prki status --worktree
+  prki status --output json`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateOutput(statusOutput); err != nil {
+			return err
+		}
 		branch, err := getCurrentBranch()
 		if err != nil {
 			return fmt.Errorf("failed to get current branch: %w", err)
 		}
 
-		fmt.Printf("Current branch: %s\n\n", branch)
+		prs, prErr := fetchChildPRs(branch)
+		files, filesErr := getChangedFiles(diffOptions{Base: statusBase, Mode: statusModeFlags.mode()})
+		report := newStatusReport(branch, prs, prErr, files, filesErr)
+		return writeReport(os.Stdout, statusOutput, report, func(w io.Writer) error {
+			writeStatusText(w, report)
+			return nil
+		})
+	},
+}
 
-		prs, err := fetchChildPRs(branch)
-		if err != nil {
-			fmt.Printf("Parent PR: %s\n", branch)
-			fmt.Printf("  (Could not fetch child PR status: %v)\n", err)
-		} else if len(prs) == 0 {
-			fmt.Printf("Parent PR: %s\n", branch)
-			fmt.Println("  (No child PRs found)")
-		} else {
-			fmt.Printf("Parent PR: %s\n", branch)
-			for i, pr := range prs {
-				connector := "├─"
-				if i == len(prs)-1 {
-					connector = "└─"
-				}
-				fmt.Printf("  %s Child PR #%d: %s [%s]\n", connector, pr.Number, pr.Title, reviewLabel(pr.ReviewDecision))
-			}
+// statusReport is the output of prki status.
+type statusReport struct {
+	reportHeader `yaml:",inline"`
+	Branch       string        `json:"branch" yaml:"branch"`
+	ChildPRs     []childPRView `json:"childPRs" yaml:"childPRs"`
+	// ChildPRError is set when the child PRs could not be fetched.
+	ChildPRError string          `json:"childPRError,omitempty" yaml:"childPRError,omitempty"`
+	NextActions  nextActionsView `json:"nextActions" yaml:"nextActions"`
+	Changes      *changeSummary  `json:"changes" yaml:"changes"` // nil when changes could not be read
+}
 
-			toFix, toMerge := nextActions(prs)
-			if len(toFix) > 0 || len(toMerge) > 0 {
-				fmt.Println("\nNext actions:")
-				for _, pr := range toFix {
-					fmt.Printf("  • Fix changes requested: %s\n", pr.Title)
-				}
-				for _, pr := range toMerge {
-					fmt.Printf("  • Ready to merge: %s\n", pr.Title)
-				}
-			}
+type nextActionsView struct {
+	Fix   []int `json:"fix" yaml:"fix"`     // PR numbers with changes requested
+	Merge []int `json:"merge" yaml:"merge"` // approved PR numbers
+}
+
+type changeSummary struct {
+	Files int `json:"files" yaml:"files"`
+	Lines int `json:"lines" yaml:"lines"`
+}
+
+func newStatusReport(branch string, prs []ChildPR, prErr error, files []FileChange, filesErr error) statusReport {
+	r := statusReport{
+		reportHeader: newReportHeader("status"),
+		Branch:       branch,
+		ChildPRs:     newChildPRViews(prs),
+		NextActions:  nextActionsView{Fix: []int{}, Merge: []int{}},
+	}
+	if prErr != nil {
+		r.ChildPRError = prErr.Error()
+	}
+	toFix, toMerge := nextActions(prs)
+	for _, pr := range toFix {
+		r.NextActions.Fix = append(r.NextActions.Fix, pr.Number)
+	}
+	for _, pr := range toMerge {
+		r.NextActions.Merge = append(r.NextActions.Merge, pr.Number)
+	}
+	if filesErr == nil {
+		r.Changes = &changeSummary{Files: len(files)}
+		for _, f := range files {
+			r.Changes.Lines += f.TotalLines()
 		}
+	}
+	return r
+}
 
-		fmt.Println("\nCurrent changes:")
-		files, err := getChangedFiles("")
-		if err != nil {
-			fmt.Println("  Could not retrieve changed files")
-			return nil
+func writeStatusText(w io.Writer, r statusReport) {
+	fmt.Fprintf(w, "Current branch: %s\n\n", r.Branch)
+
+	fmt.Fprintf(w, "Parent PR: %s\n", r.Branch)
+	switch {
+	case r.ChildPRError != "":
+		fmt.Fprintf(w, "  (Could not fetch child PR status: %s)\n", r.ChildPRError)
+	case len(r.ChildPRs) == 0:
+		fmt.Fprintln(w, "  (No child PRs found)")
+	default:
+		titles := map[int]string{}
+		for i, pr := range r.ChildPRs {
+			connector := "├─"
+			if i == len(r.ChildPRs)-1 {
+				connector = "└─"
+			}
+			fmt.Fprintf(w, "  %s Child PR #%d: %s [%s]\n", connector, pr.Number, pr.Title, reviewLabel(pr.ReviewDecision))
+			titles[pr.Number] = pr.Title
 		}
-		if len(files) == 0 {
-			fmt.Println("  No changes")
-		} else {
-			totalLines := 0
-			for _, f := range files {
-				totalLines += f.TotalLines()
+
+		if len(r.NextActions.Fix) > 0 || len(r.NextActions.Merge) > 0 {
+			fmt.Fprintln(w, "\nNext actions:")
+			for _, n := range r.NextActions.Fix {
+				fmt.Fprintf(w, "  • Fix changes requested: %s\n", titles[n])
+			}
+			for _, n := range r.NextActions.Merge {
+				fmt.Fprintf(w, "  • Ready to merge: %s\n", titles[n])
 			}
-			fmt.Printf("  %d files, %d lines\n", len(files), totalLines)
 		}
-		return nil
-	},
+	}
+
+	fmt.Fprintln(w, "\nCurrent changes:")
+	switch {
+	case r.Changes == nil:
+		fmt.Fprintln(w, "  Could not retrieve changed files")
+	case r.Changes.Files == 0:
+		fmt.Fprintln(w, "  No changes")
+	default:
+		fmt.Fprintf(w, "  %d files, %d lines\n", r.Changes.Files, r.Changes.Lines)
+	}
 }
 
-// fetchChildPRs uses the gh CLI to list PRs whose base is the given branch.
+// fetchChildPRs lists the open PRs whose base is the given branch.
 func fetchChildPRs(branch string) ([]ChildPR, error) {
-	if _, err := exec.LookPath("gh"); err != nil {
-		return nil, fmt.Errorf("gh CLI not found (https://cli.github.com)")
-	}
-	out, err := exec.Command("gh", "pr", "list",
-		"--base", branch,
-		"--json", "number,title,reviewDecision",
-	).Output()
+	return listChildPRs(branch, "open")
+}
+
+// listChildPRs lists the child PRs of branch in the given state (open,
+// merged, closed or all). When branch has a split tree, those are the PRs
+// the split opened, in group order; otherwise, the PRs whose base is branch.
+func listChildPRs(branch, state string) ([]ChildPR, error) {
+	tree, err := loadTree(branch)
 	if err != nil {
-		return nil, fmt.Errorf("gh pr list failed: %w", err)
+		return nil, err
 	}
-	var prs []ChildPR
-	if err := json.Unmarshal(out, &prs); err != nil {
-		return nil, fmt.Errorf("failed to parse gh output: %w", err)
+	if tree != nil {
+		return tree.childPRs(currentForge(nil), state)
 	}
-	return prs, nil
+	return currentForge(nil).ListPRs(branch, state)
 }
 
 // reviewLabel converts a GitHub review decision string to a human-readable label.
@@ -124,5 +198,10 @@ func nextActions(prs []ChildPR) (toFix []ChildPR, toMerge []ChildPR) {
 }
 
 func init() {
+	statusCmd.Flags().StringVar(&statusBase, "base", "", "Base branch to compare against (default: origin's default branch)")
+	statusModeFlags.register(statusCmd)
+	addOutputFlag(statusCmd, &statusOutput)
+	statusCmd.MarkFlagsMutuallyExclusive("base", "staged", "unstaged", "worktree")
+
 	rootCmd.AddCommand(statusCmd)
 }
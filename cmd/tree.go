@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// splitTree is the parent/child tree a split created. It is committed as
+// tree.json to refs/prki/tree/<parent> and pushed next to the child
+// branches, so every clone knows the children of a parent without asking
+// the forge which PRs happen to target it. Each split of the same parent
+// adds a commit, so earlier trees stay in the ref's history.
+type splitTree struct {
+	Version     int         `json:"version"`
+	Parent      string      `json:"parent"`
+	Base        string      `json:"base,omitempty"` // branch the parent PR targets; empty for uncommitted changes
+	MergeBase   string      `json:"mergeBase"`      // commit the child branches start from
+	SplitCommit string      `json:"splitCommit"`    // commit the child contents were taken from
+	Children    []treeChild `json:"children"`
+}
+
+// treeChild lists the files of a child like a plan group does: whole files
+// in Files, files split by hunks in Hunks.
+type treeChild struct {
+	Group    string            `json:"group"`
+	Order    int               `json:"order"`
+	Branch   string            `json:"branch"`
+	Commit   string            `json:"commit,omitempty"`
+	PR       int               `json:"pr,omitempty"` // 0 when no PR was opened
+	Files    []string          `json:"files"`
+	Hunks    []PlanHunks       `json:"hunks,omitempty"`
+	OldPaths map[string]string `json:"oldPaths,omitempty"` // path before a rename or copy, by path
+}
+
+const (
+	treeVersion = 1
+	treeFile    = "tree.json"
+)
+
+// treeRef is the ref holding the split tree of parent.
+func treeRef(parent string) string {
+	return "refs/prki/tree/" + parent
+}
+
+// newSplitTree describes the child branches results created from src.
+func newSplitTree(src splitContext, results []splitResult) *splitTree {
+	t := &splitTree{
+		Version:     treeVersion,
+		Parent:      src.parentBranch,
+		Base:        src.baseBranch,
+		MergeBase:   src.base,
+		SplitCommit: src.contents,
+		Children:    []treeChild{},
+	}
+	for _, r := range results {
+		if r.err != nil {
+			continue
+		}
+		c := treeChild{Group: r.group.Name, Order: r.group.Order, Branch: r.branch, Commit: r.commit, Files: []string{}}
+		for _, f := range r.group.Files {
+			if f.Partial() {
+				c.Hunks = append(c.Hunks, PlanHunks{File: f.Path, Hunks: f.HunkIndexes()})
+			} else {
+				c.Files = append(c.Files, f.Path)
+			}
+			if f.OldPath != "" {
+				if c.OldPaths == nil {
+					c.OldPaths = map[string]string{}
+				}
+				c.OldPaths[f.Path] = f.OldPath
+			}
+		}
+		if r.prURL != "" {
+			c.PR, _ = prNumberFromURL(r.prURL)
+		}
+		t.Children = append(t.Children, c)
+	}
+	return t
+}
+
+// saveSplitTree records the children results created from src.
+func saveSplitTree(src splitContext, results []splitResult) error {
+	t := newSplitTree(src, results)
+	commit, err := activeGit.RevParse(src.contents)
+	switch {
+	case err == nil:
+		t.SplitCommit = commit
+	case src.dryRun == nil: // in dry-run mode, a snapshot is only a placeholder
+		return err
+	}
+	fmt.Fprintf(src.out, "  Recording the split tree in %s...\n", treeRef(t.Parent))
+	return saveTree(src, t)
+}
+
+// saveTree commits t on top of the parent's tree ref and pushes the ref,
+// unless the split is local. Failing to push only warns: the tree is still
+// there locally.
+func saveTree(src splitContext, t *splitTree) error {
+	ref := treeRef(t.Parent)
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	repo := src.repo()
+	previous, _ := repo.RevParse(ref)
+	commit, err := repo.CommitTree(TreeCommit{
+		Parent:  previous,
+		Files:   map[string][]byte{treeFile: append(data, '\n')},
+		Message: "prki split of " + t.Parent,
+	})
+	if err != nil {
+		return err
+	}
+	// fails if another split moved the ref meanwhile
+	if err := repo.UpdateRef(ref, commit, previous); err != nil {
+		return err
+	}
+	if err := src.journal.record(journalAction{Kind: actionTree, Branch: ref, Commit: commit, Previous: previous}); err != nil {
+		return err
+	}
+
+	if src.local {
+		return nil
+	}
+	if err := repo.Push(ref, ref, ""); err != nil {
+		fmt.Fprintf(src.out, "  ⚠  Could not push the split tree (%v); run `git push origin %s` to share it.\n", err, ref)
+		return nil
+	}
+	return src.journal.record(journalAction{Kind: actionTreePush, Branch: ref, Commit: commit, Previous: previous})
+}
+
+// loadTree returns the split tree of parent, fetching its ref from origin
+// when there is none locally. It returns nil when parent was never split.
+func loadTree(parent string) (*splitTree, error) {
+	if parent == "" || parent == "HEAD" {
+		return nil, nil
+	}
+	ref := treeRef(parent)
+	if !refExists(ref) {
+		// fine to fail: offline, or no tree on origin either
+		_ = gitSilent("fetch", "--quiet", "--no-tags", "origin", "+"+ref+":"+ref)
+		if !refExists(ref) {
+			return nil, nil
+		}
+	}
+	data, err := gitOutput("show", ref+":"+treeFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the split tree of %s: %w", parent, err)
+	}
+	var t splitTree
+	if err := json.Unmarshal([]byte(data), &t); err != nil {
+		return nil, fmt.Errorf("%s: invalid split tree: %w", ref, err)
+	}
+	if t.Version > treeVersion {
+		return nil, fmt.Errorf("%s: split tree version %d is newer than this prki supports (%d); upgrade prki", ref, t.Version, treeVersion)
+	}
+	return &t, nil
+}
+
+// childPRs fetches the PRs of the tree's children in state (open, merged,
+// closed or all), wherever they point now.
+func (t *splitTree) childPRs(forge Forge, state string) ([]ChildPR, error) {
+	prs := []ChildPR{}
+	for _, c := range t.Children {
+		if c.PR == 0 {
+			continue
+		}
+		pr, err := forge.ChildPR(c.PR)
+		if err != nil {
+			return nil, err
+		}
+		if prInState(pr, state) {
+			prs = append(prs, pr)
+		}
+	}
+	return prs, nil
+}
+
+// prInState reports whether pr is in state; closed includes merged, as in
+// gh pr list.
+func prInState(pr ChildPR, state string) bool {
+	switch strings.ToLower(state) {
+	case "open":
+		return strings.EqualFold(pr.State, "OPEN")
+	case "merged":
+		return strings.EqualFold(pr.State, "MERGED")
+	case "closed":
+		return !strings.EqualFold(pr.State, "OPEN")
+	}
+	return true
+}
+
+// child returns the child of t that pr was opened for, or nil when there is
+// none or no tree.
+func (t *splitTree) child(pr ChildPR) *treeChild {
+	if t == nil {
+		return nil
+	}
+	for i, c := range t.Children {
+		if (c.PR != 0 && c.PR == pr.Number) || (c.PR == 0 && c.Branch == pr.HeadRefName) {
+			return &t.Children[i]
+		}
+	}
+	return nil
+}
+
+// orderByBranch maps the tree's child branches to their group order.
+func (t *splitTree) orderByBranch() map[string]int {
+	order := map[string]int{}
+	for _, c := range t.Children {
+		order[c.Branch] = c.Order
+	}
+	return order
+}
+
+// restoreTreeRef points ref back at previous, or deletes it when the split
+// created it, unless it moved since the split.
+func restoreTreeRef(ref, commit, previous string) error {
+	if !refExists(ref) {
+		return nil // already gone
+	}
+	return activeGit.UpdateRef(ref, previous, commit)
+}
+
+// restoreRemoteTreeRef is restoreTreeRef for origin.
+func restoreRemoteTreeRef(ref, commit, previous string) error {
+	return activeGit.Push(ref, previous, commit)
+}
@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func sampleTree(base string) *splitTree {
+	return &splitTree{
+		Version:     treeVersion,
+		Parent:      "feature",
+		Base:        "main",
+		MergeBase:   base,
+		SplitCommit: base,
+		Children: []treeChild{
+			{Group: "Code", Order: 1, Branch: "split/code", PR: 3, Files: []string{"edited.go"}},
+			{Group: "Docs", Order: 2, Branch: "split/docs", Files: []string{"README.md"}},
+		},
+	}
+}
+
+func TestSaveTree_RoundTrip(t *testing.T) {
+	dir, origin := newTestRepoWithOrigin(t)
+	base := runGit(t, dir, "rev-parse", "HEAD")
+	ref := treeRef("feature")
+	src := splitContext{parentBranch: "feature", out: io.Discard}
+
+	want := sampleTree(base)
+	if err := saveTree(src, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadTree("feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loadTree() =\n%+v\nwant\n%+v", got, want)
+	}
+	if local, remote := runGit(t, dir, "rev-parse", ref), runGit(t, origin, "rev-parse", ref); local != remote {
+		t.Errorf("%s: local %s, origin %s", ref, local, remote)
+	}
+
+	// a second split of the same parent keeps the first in the history
+	want.Children = want.Children[:1]
+	if err := saveTree(src, want); err != nil {
+		t.Fatal(err)
+	}
+	if got := runGit(t, dir, "rev-list", "--count", ref); got != "2" {
+		t.Errorf("%s has %s commits, want 2", ref, got)
+	}
+
+	// another clone fetches the tree from origin
+	runGit(t, dir, "update-ref", "-d", ref)
+	got, err = loadTree("feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loadTree() after fetch =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestSaveTree_RoundTripHunksAndRenames(t *testing.T) {
+	dir := newTestRepo(t)
+	base := runGit(t, dir, "rev-parse", "HEAD")
+	_, hunks := parseHunks(sampleHunkDiff)
+	calc := FileChange{Path: "calc.go", Status: statusModified, Hunks: hunks, hunkCount: len(hunks)}
+	src := splitContext{parentBranch: "feature", baseBranch: "main", base: base, contents: base, out: io.Discard}
+	results := []splitResult{
+		{group: FileGroup{Name: "Refactoring", Order: 1, Files: []FileChange{
+			calc.withHunks([]Hunk{hunks[0], hunks[2]}),
+			{Path: "pkg/new.go", OldPath: "old.go", Status: statusRenamed},
+		}}, branch: "split/refactoring", commit: base},
+		{group: FileGroup{Name: "Core", Order: 2, Files: []FileChange{calc.withHunks(hunks[1:2])}}, branch: "split/core", commit: base},
+	}
+
+	want := newSplitTree(src, results)
+	wantChildren := []treeChild{
+		{Group: "Refactoring", Order: 1, Branch: "split/refactoring", Commit: base, Files: []string{"pkg/new.go"},
+			Hunks: []PlanHunks{{File: "calc.go", Hunks: []int{1, 3}}}, OldPaths: map[string]string{"pkg/new.go": "old.go"}},
+		{Group: "Core", Order: 2, Branch: "split/core", Commit: base, Files: []string{},
+			Hunks: []PlanHunks{{File: "calc.go", Hunks: []int{2}}}},
+	}
+	if !reflect.DeepEqual(want.Children, wantChildren) {
+		t.Fatalf("newSplitTree() children =\n%+v\nwant\n%+v", want.Children, wantChildren)
+	}
+	if err := saveTree(src, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadTree("feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loadTree() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestLoadTree(t *testing.T) {
+	dir := newTestRepo(t)
+	for _, parent := range []string{"", "HEAD", "feature"} {
+		if got, err := loadTree(parent); got != nil || err != nil {
+			t.Errorf("loadTree(%q) = %+v, %v; want no tree", parent, got, err)
+		}
+	}
+
+	newer := sampleTree(runGit(t, dir, "rev-parse", "HEAD"))
+	newer.Version = treeVersion + 1
+	if err := saveTree(splitContext{out: io.Discard}, newer); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadTree("feature"); err == nil || !strings.Contains(err.Error(), "upgrade prki") {
+		t.Errorf("loadTree() of a newer tree: %v", err)
+	}
+}
+
+func TestSaveTree_DryRun(t *testing.T) {
+	dir := newTestRepo(t)
+	var out bytes.Buffer
+	src := splitContext{parentBranch: "feature", out: &out}
+	src.enableDryRun()
+	if err := saveTree(src, sampleTree(runGit(t, dir, "rev-parse", "HEAD"))); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"update-index --add --cacheinfo '100644,<blob-1>,tree.json'\n",
+		"$ git commit-tree <tree-1> -m 'prki split of feature'\n",
+		"$ git update-ref refs/prki/tree/feature <commit-1>\n",
+		"$ git push --quiet origin refs/prki/tree/feature\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("dry run output does not contain %q:\n%s", want, out.String())
+		}
+	}
+	if refExists(treeRef("feature")) {
+		t.Error("dry run created the tree ref")
+	}
+}
+
+func TestJournalRollback_RestoresTree(t *testing.T) {
+	dir, origin := newTestRepoWithOrigin(t)
+	ref := treeRef("feature")
+	tree := sampleTree(runGit(t, dir, "rev-parse", "HEAD"))
+	if err := saveTree(splitContext{out: io.Discard}, tree); err != nil {
+		t.Fatal(err)
+	}
+	first := runGit(t, dir, "rev-parse", ref)
+
+	// rolling back a re-split restores the previous tree
+	j, err := startJournal("feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := saveTree(splitContext{out: io.Discard, journal: j}, tree); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.rollback(io.Discard, closedByRollback); err != nil {
+		t.Fatal(err)
+	}
+	for _, repo := range []string{dir, origin} {
+		if got := runGit(t, repo, "rev-parse", ref); got != first {
+			t.Errorf("%s: %s is at %s after rollback, want %s", repo, ref, got, first)
+		}
+	}
+
+	// rolling back the first split removes the ref
+	runGit(t, dir, "update-ref", "-d", ref)
+	runGit(t, origin, "update-ref", "-d", ref)
+	if j, err = startJournal("feature"); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveTree(splitContext{out: io.Discard, journal: j}, tree); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.rollback(io.Discard, closedByRollback); err != nil {
+		t.Fatal(err)
+	}
+	for _, repo := range []string{dir, origin} {
+		if got := runGit(t, repo, "for-each-ref", "refs/prki/"); got != "" {
+			t.Errorf("%s: refs left after rollback: %s", repo, got)
+		}
+	}
+}
+
+func TestPRInState(t *testing.T) {
+	tests := []struct {
+		state string
+		want  []bool // for OPEN, MERGED, CLOSED
+	}{
+		{"all", []bool{true, true, true}},
+		{"open", []bool{true, false, false}},
+		{"merged", []bool{false, true, false}},
+		{"closed", []bool{false, true, true}},
+	}
+	for _, tt := range tests {
+		for i, prState := range []string{"OPEN", "MERGED", "CLOSED"} {
+			if got := prInState(ChildPR{State: prState}, tt.state); got != tt.want[i] {
+				t.Errorf("prInState(%s, %q) = %v, want %v", prState, tt.state, got, tt.want[i])
+			}
+		}
+	}
+}